@@ -9,12 +9,21 @@ import (
 	"syscall"
 	"time"
 
+	"tinygo/internal/analytics"
 	"tinygo/internal/config"
 	"tinygo/internal/database"
+	"tinygo/internal/domains"
+	"tinygo/internal/hits"
+	"tinygo/internal/live"
 	"tinygo/internal/logger"
 	"tinygo/internal/shortener"
 	"tinygo/internal/storage"
 	httphandler "tinygo/internal/transport/http"
+	"tinygo/pkg/feistel"
+	"tinygo/pkg/geoip"
+	"tinygo/pkg/random"
+	"tinygo/pkg/useragent"
+	"tinygo/pkg/wordfilter"
 )
 
 func main() {
@@ -38,8 +47,113 @@ func main() {
 	// Create store
 	store := storage.NewGormStore()
 
+	// Derive lookup keys for the configured case mode, refusing to start when
+	// existing codes would become ambiguous.
+	store.SetCaseInsensitive(cfg.CaseInsensitiveCodes)
+	if collisions, err := store.MigrateCodeKeys(context.Background()); err != nil {
+		for _, c := range collisions {
+			logger.Log.Errorf("codes collide case-insensitively as %q: %v", c.Key, c.Codes)
+		}
+		logger.Log.Fatalf("migrate code keys: %v", err)
+	}
+
 	svc := shortener.NewService(store, cfg.BaseURL, cfg.CodeLength)
-	router := httphandler.NewMux(svc, cfg)
+	domainSvc := domains.NewService(store, cfg.Domains)
+	domainSvc.SetResolver(domains.NewResolver(cfg.DomainVerification.Resolver))
+	domainSvc.SetRecordPrefix(cfg.DomainVerification.RecordPrefix)
+	svc.SetDomains(domainSvc)
+	alphabet, _ := random.Lookup(cfg.CodeAlphabet)
+	svc.SetAlphabet(alphabet)
+	if cfg.CaseInsensitiveCodes && alphabet.MixedCase() {
+		logger.Log.Warnf("code_alphabet %s mixes upper and lower case; with case_insensitive_codes consider lowercase or crockford", alphabet.Name())
+	}
+	if cfg.CodeStrategy == shortener.StrategySequential {
+		codec, err := feistel.New([]byte(cfg.Sequence.Secret), alphabet, cfg.Sequence.MinLength)
+		if err != nil {
+			logger.Log.Fatalf("init sequential codes: %v", err)
+		}
+		svc.RegisterGenerator(shortener.StrategySequential, shortener.NewSequentialGenerator(store, codec))
+	}
+	svc.RegisterGenerator(shortener.StrategyWords, shortener.NewWordsGenerator(random.WordOptions{
+		Words:     cfg.Words.Count,
+		Separator: cfg.Words.Separator,
+		Digits:    cfg.Words.Digits,
+	}))
+	if cfg.Hash.Secret != "" {
+		length := cfg.Hash.Length
+		if length == 0 {
+			length = svc.CodeLength()
+		}
+		svc.RegisterGenerator(shortener.StrategyHash, shortener.NewHashGenerator([]byte(cfg.Hash.Secret), alphabet, length))
+	}
+	if err := svc.SetStrategy(cfg.CodeStrategy); err != nil {
+		logger.Log.Fatalf("set code strategy: %v", err)
+	}
+	if cfg.AdaptiveLength.Enabled {
+		svc.SetAdaptiveLength(shortener.AdaptiveLength{
+			GrowAfterRetries: cfg.AdaptiveLength.GrowAfterRetries,
+			MaxLength:        cfg.AdaptiveLength.MaxLength,
+			MaxUtilization:   cfg.AdaptiveLength.MaxUtilization,
+		})
+		if err := svc.Calibrate(context.Background()); err != nil {
+			logger.Log.Fatalf("calibrate code length: %v", err)
+		}
+	}
+	logger.Log.Info("code generation", "strategy", cfg.CodeStrategy, "alphabet", alphabet.Name(), "length", svc.CodeLength())
+	if cfg.WordFilter.Enabled {
+		filter, err := wordfilter.Load(cfg.WordFilter.Builtin, cfg.WordFilter.Paths...)
+		if err != nil {
+			logger.Log.Fatalf("load word filter: %v", err)
+		}
+		svc.SetFilter(filter)
+		logger.Log.Info("word filter enabled", "words", filter.Len())
+	}
+	agents, err := useragent.Load(cfg.Analytics.UARules)
+	if err != nil {
+		logger.Log.Fatalf("load user agent rules: %v", err)
+	}
+	var analyticsSvc *analytics.Service
+	if cfg.Analytics.Enabled {
+		analyticsSvc = analytics.NewService(store)
+		analyticsSvc.SetUserAgentParser(agents)
+		if cfg.Analytics.VisitorSecret != "" {
+			analyticsSvc.SetVisitorSecret(cfg.Analytics.VisitorSecret)
+		} else if err := analyticsSvc.LoadVisitorSecret(context.Background()); err != nil {
+			logger.Log.Fatalf("load visitor secret: %v", err)
+		}
+		if cfg.Analytics.GeoIPDB != "" {
+			geo, err := geoip.Open(cfg.Analytics.GeoIPDB)
+			if err != nil {
+				logger.Log.Fatalf("open geoip database: %v", err)
+			}
+			analyticsSvc.SetGeoIP(geo)
+			logger.Log.Info("geoip enabled", "database", geo.Type)
+		}
+	}
+	var hitQueue *hits.Queue
+	if cfg.HitQueue.Enabled {
+		hitQueue, err = hits.New(svc, analyticsSvc, hits.Options{
+			Size:          cfg.HitQueue.Size,
+			FlushInterval: time.Duration(cfg.HitQueue.FlushIntervalMS) * time.Millisecond,
+			BatchSize:     cfg.HitQueue.BatchSize,
+			Policy:        hits.Policy(cfg.HitQueue.DropPolicy),
+		})
+		if err != nil {
+			logger.Log.Fatalf("start hit queue: %v", err)
+		}
+		logger.Log.Info("hit queue enabled", "size", cfg.HitQueue.Size, "drop_policy", cfg.HitQueue.DropPolicy)
+	}
+	// Roll clicks up and apply retention in the background
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if analyticsSvc != nil && cfg.Analytics.Rollups {
+		go compactClicks(jobs, analyticsSvc, time.Duration(cfg.Analytics.RetentionDays)*24*time.Hour)
+	}
+	var broker *live.Broker
+	if cfg.Live.Enabled {
+		broker = live.NewBroker(live.Options{Buffer: cfg.Live.Buffer, MaxSubscribers: cfg.Live.MaxSubscribers})
+	}
+	router := httphandler.NewMux(httphandler.Services{Links: svc, Domains: domainSvc, Analytics: analyticsSvc, Agents: agents, Hits: hitQueue, Live: broker}, cfg)
 
 	srv := &http.Server{
 		Addr:         cfg.Addr,
@@ -60,9 +174,44 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
+	stopJobs()
+	// End live streams, which Shutdown would otherwise wait for
+	if broker != nil {
+		broker.Close()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Log.Errorf("shutdown error: %v", err)
 	}
+	// Write the hits queued by the last requests
+	if hitQueue != nil {
+		if err := hitQueue.Close(ctx); err != nil {
+			logger.Log.Errorf("flush hit queue: %v", err)
+		}
+	}
+}
+
+// rollupInterval is the time between click compaction runs.
+const rollupInterval = 10 * time.Minute
+
+// compactClicks rolls clicks up and deletes expired ones at start and
+// then every rollupInterval until ctx is done.
+func compactClicks(ctx context.Context, svc *analytics.Service, retention time.Duration) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		res, err := svc.Compact(ctx, time.Now(), retention)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Log.Warnf("compact clicks: %v", err)
+		case res.RolledUp > 0 || res.Deleted > 0:
+			logger.Log.Info("clicks compacted", "rollups", res.RolledUp, "deleted", res.Deleted, "rolled_until", res.Mark.RolledUntil)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Referrer categories.
+const (
+	CategoryDirect = "direct"
+	CategorySearch = "search"
+	CategorySocial = "social"
+	CategoryEmail  = "email"
+	CategoryOther  = "other"
+)
+
+// Known referrer hosts per category. An entry matches the host and its
+// subdomains; an entry ending in a dot matches any top-level domain, such
+// as "google." for google.com and google.co.uk.
+var referrerHosts = []struct {
+	category string
+	hosts    []string
+}{
+	// Checked first: webmail runs on subdomains of search and social sites
+	{CategoryEmail, []string{
+		"mail.google.com", "inbox.google.com", "outlook.live.com", "outlook.office.com",
+		"outlook.office365.com", "mail.yahoo.com", "mail.aol.com", "mail.proton.me",
+		"mail.zoho.com", "mail.yandex.ru", "mail.qq.com", "mail.163.com", "mail.126.com",
+		"icloud.com", "fastmail.com", "gmx.net", "web.de",
+		"com.google.android.gm", "com.microsoft.office.outlook",
+	}},
+	{CategorySearch, []string{
+		"google.", "bing.com", "duckduckgo.com", "search.yahoo.com", "yahoo.co.jp",
+		"baidu.com", "yandex.", "ecosia.org", "search.brave.com", "startpage.com",
+		"qwant.com", "naver.com", "sogou.com", "so.com", "sm.cn", "seznam.cz",
+		"kagi.com", "perplexity.ai", "com.google.android.googlequicksearchbox",
+	}},
+	{CategorySocial, []string{
+		"facebook.com", "fb.com", "fb.me", "messenger.com", "instagram.com",
+		"t.co", "twitter.com", "x.com", "linkedin.com", "lnkd.in", "reddit.com",
+		"redd.it", "youtube.com", "youtu.be", "tiktok.com", "pinterest.", "pin.it",
+		"tumblr.com", "quora.com", "weibo.com", "weibo.cn", "t.cn", "zhihu.com",
+		"douban.com", "vk.com", "ok.ru", "telegram.org", "t.me", "whatsapp.com",
+		"wa.me", "discord.com", "discordapp.com", "slack.com", "teams.microsoft.com",
+		"news.ycombinator.com", "mastodon.social", "threads.net", "bsky.app",
+		"snapchat.com", "line.me", "kakao.com", "xiaohongshu.com", "bilibili.com",
+		"com.reddit.frontpage", "com.linkedin.android", "com.slack",
+	}},
+}
+
+// ParseReferrer returns the host of a referrer, without port and "www.",
+// and its category. Android app referrers (android-app://package/) are
+// categorized by package name.
+func ParseReferrer(referrer string) (host, category string) {
+	referrer = strings.TrimSpace(referrer)
+	if referrer == "" {
+		return "", CategoryDirect
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return "", CategoryOther
+	}
+	host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	host = strings.TrimPrefix(host, "www.")
+	for _, group := range referrerHosts {
+		for _, pattern := range group.hosts {
+			if hostMatches(host, pattern) {
+				return host, group.category
+			}
+		}
+	}
+	return host, CategoryOther
+}
+
+// hostMatches reports whether host is pattern or a subdomain of it. A
+// pattern ending in a dot stands for the name under any public suffix of
+// one or two labels.
+func hostMatches(host, pattern string) bool {
+	name, anyTLD := strings.CutSuffix(pattern, ".")
+	if !anyTLD {
+		return host == pattern || strings.HasSuffix(host, "."+pattern)
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if label == name {
+			if rest := len(labels) - i - 1; rest == 1 || rest == 2 && len(labels[i+1]) <= 3 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReferrerCount is the number of clicks from one referrer host.
+type ReferrerCount struct {
+	Host     string `json:"host"`
+	Category string `json:"category"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// CategoryCount is the number of clicks from one referrer category.
+type CategoryCount struct {
+	Category string `json:"category"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// ReferrerStats breaks a link's clicks down by referrer. Direct clicks
+// have no host and are only counted in their category.
+type ReferrerStats struct {
+	Total      int64           `json:"total"`
+	Hosts      []ReferrerCount `json:"hosts"`
+	Categories []CategoryCount `json:"categories"`
+}
+
+// Referrers breaks the clicks matching q down by referrer host and
+// category, most clicks first.
+func (s *Service) Referrers(ctx context.Context, q Query) (ReferrerStats, error) {
+	counts, err := s.Breakdown(ctx, q, DimReferrerHost, DimReferrerCategory)
+	if err != nil {
+		return ReferrerStats{}, err
+	}
+	stats := ReferrerStats{Hosts: []ReferrerCount{}, Categories: []CategoryCount{}}
+	categories := make(map[string]int)
+	for _, c := range counts {
+		host, category := c.Values[0], c.Values[1]
+		stats.Total += c.Clicks
+		if host != "" {
+			stats.Hosts = append(stats.Hosts, ReferrerCount{Host: host, Category: category, Clicks: c.Clicks})
+		}
+		if i, ok := categories[category]; ok {
+			stats.Categories[i].Clicks += c.Clicks
+			continue
+		}
+		categories[category] = len(stats.Categories)
+		stats.Categories = append(stats.Categories, CategoryCount{Category: category, Clicks: c.Clicks})
+	}
+	sortByClicks(stats.Categories, func(c CategoryCount) (int64, string) { return c.Clicks, c.Category })
+	return stats, nil
+}
@@ -0,0 +1,348 @@
+package analytics
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// RollupDelay is how long after the end of an hour its clicks are rolled
+// up, leaving time for clicks written late, such as by a hit queue; the
+// configuration keeps the queue's flush interval well below it.
+const RollupDelay = 5 * time.Minute
+
+// ValueSeparator joins the dimension values of a rollup.
+const ValueSeparator = "\x1f"
+
+// Period is the time span a rollup covers.
+type Period string
+
+const (
+	PeriodHour Period = "hour"
+	// PeriodDay rollups cover UTC days.
+	PeriodDay Period = "day"
+)
+
+// Rollup is the number of clicks of one link and class in one period with
+// one combination of values of a group of dimensions.
+type Rollup struct {
+	ID     uint64    `gorm:"primaryKey" json:"-"`
+	Domain string    `gorm:"size:253;not null;default:'';uniqueIndex:idx_rollups_key,priority:1" json:"domain,omitempty"`
+	Code   string    `gorm:"size:32;not null;uniqueIndex:idx_rollups_key,priority:2" json:"code"`
+	Period Period    `gorm:"size:8;not null;uniqueIndex:idx_rollups_key,priority:3;index:idx_rollups_start,priority:1" json:"period"`
+	Start  time.Time `gorm:"not null;uniqueIndex:idx_rollups_key,priority:4;index:idx_rollups_start,priority:2" json:"start"`
+	Class  string    `gorm:"size:16;not null;default:'';uniqueIndex:idx_rollups_key,priority:5" json:"class,omitempty"`
+	// Group names the dimensions of Values, one of RollupGroups
+	Group string `gorm:"column:dims;size:16;not null;default:'';uniqueIndex:idx_rollups_key,priority:6" json:"group,omitempty"`
+	// Values are the values of the group's dimensions joined by
+	// ValueSeparator
+	Values string `gorm:"column:dim_values;size:512;not null;default:'';uniqueIndex:idx_rollups_key,priority:7" json:"values,omitempty"`
+	Clicks int64  `gorm:"not null" json:"clicks"`
+}
+
+// TableName returns the table name for the Rollup model
+func (Rollup) TableName() string {
+	return "click_rollups"
+}
+
+// RollupMark records the progress of rollups and retention. Both times
+// are on the hour; RawSince is never after RolledUntil.
+type RollupMark struct {
+	ID uint `gorm:"primaryKey" json:"-"`
+	// RolledUntil is the end of the last hour rolled up; zero before the
+	// first rollup.
+	RolledUntil time.Time `json:"rolled_until"`
+	// RawSince is the time clicks are kept from; older ones were deleted.
+	// Zero while every click is kept.
+	RawSince time.Time `json:"raw_since"`
+}
+
+// TableName returns the table name for the RollupMark model
+func (RollupMark) TableName() string {
+	return "rollup_marks"
+}
+
+// RollupGroup is a group of dimensions rolled up together. The class is
+// part of every rollup and needs no group.
+type RollupGroup struct {
+	Name string
+	Dims []Dimension
+}
+
+// RollupGroups are the dimension groups rolled up; the unnamed one only
+// counts clicks. Breakdowns by dimensions of a single group are answered
+// from rollups.
+var RollupGroups = []RollupGroup{
+	{Name: ""},
+	{Name: "referrer", Dims: []Dimension{DimReferrerHost, DimReferrerCategory}},
+	{Name: "browser", Dims: []Dimension{DimBrowser, DimBrowserVersion}},
+	{Name: "os", Dims: []Dimension{DimOS}},
+	{Name: "device", Dims: []Dimension{DimDevice}},
+	{Name: "geo", Dims: []Dimension{DimCountry, DimRegion, DimCity}},
+}
+
+// rollupGroupFor returns the group that covers dims, apart from the class,
+// and the index in the group of each of dims, -1 for the class.
+func rollupGroupFor(dims []Dimension) (RollupGroup, []int, bool) {
+groups:
+	for _, g := range RollupGroups {
+		index := make([]int, len(dims))
+		for i, d := range dims {
+			index[i] = -1
+			if d == DimClass {
+				continue
+			}
+			for j, gd := range g.Dims {
+				if gd == d {
+					index[i] = j
+				}
+			}
+			if index[i] < 0 {
+				continue groups
+			}
+		}
+		return g, index, true
+	}
+	return RollupGroup{}, nil, false
+}
+
+// Compaction is the outcome of a Compact run.
+type Compaction struct {
+	// RolledUp is the number of rollups written.
+	RolledUp int
+	// Deleted is the number of raw clicks deleted.
+	Deleted int64
+	Mark    RollupMark
+}
+
+// Compact rolls the clicks of every hour that ended RollupDelay before now
+// up into hourly and daily rollups, then deletes the clicks older than
+// retention that are rolled up. A retention of zero keeps every click.
+func (s *Service) Compact(ctx context.Context, now time.Time, retention time.Duration) (Compaction, error) {
+	var res Compaction
+	mark, err := s.store.RollupMark(ctx)
+	if err != nil {
+		return res, err
+	}
+	until := now.Add(-RollupDelay).UTC().Truncate(time.Hour)
+	if mark.RolledUntil.Before(until) {
+		rollups, err := s.rollupHours(ctx, mark.RolledUntil, until)
+		if err != nil {
+			return res, err
+		}
+		saved, err := s.store.SaveRollups(ctx, rollups, mark.RolledUntil, until)
+		if err != nil {
+			return res, err
+		}
+		if !saved {
+			// Another process is compacting; leave retention to it.
+			res.Mark, err = s.store.RollupMark(ctx)
+			return res, err
+		}
+		res.RolledUp = len(rollups)
+		mark.RolledUntil = until
+	}
+	if retention > 0 {
+		before := now.Add(-retention).UTC().Truncate(time.Hour)
+		if before.After(mark.RolledUntil) {
+			before = mark.RolledUntil
+		}
+		if before.After(mark.RawSince) {
+			if res.Deleted, err = s.store.DeleteClicks(ctx, before); err != nil {
+				return res, err
+			}
+			mark.RawSince = before
+		}
+	}
+	res.Mark = mark
+	return res, nil
+}
+
+// rollupHours returns the hourly rollups of the clicks in [from, to), from
+// possibly zero, and the daily rollups summing them.
+func (s *Service) rollupHours(ctx context.Context, from, to time.Time) ([]Rollup, error) {
+	var hours, days []Rollup
+	index := make(map[Rollup]int)
+	for _, g := range RollupGroups {
+		rollups, err := s.store.RollupHours(ctx, from, to, g.Dims)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			r.Group = g.Name
+			hours = append(hours, r)
+
+			day := r
+			day.Period, day.Start, day.Clicks = PeriodDay, r.Start.Truncate(24*time.Hour), 0
+			i, ok := index[day]
+			if !ok {
+				i = len(days)
+				index[day] = i
+				days = append(days, day)
+			}
+			days[i].Clicks += r.Clicks
+		}
+	}
+	return append(hours, days...), nil
+}
+
+// span is a part of the time range of a query; zero bounds are open.
+type span struct {
+	from, to time.Time
+}
+
+func (sp span) query(q Query) Query {
+	q.From, q.To = sp.from, sp.to
+	return q
+}
+
+// split divides the time range of q into the parts answered from raw
+// clicks and the part answered from rollups, if any. Rollups cover whole
+// hours: a partial hour at either end is read from raw clicks when they
+// are kept, and counted whole otherwise.
+func split(q Query, mark RollupMark) (raw []span, rolled span, ok bool) {
+	if mark.RolledUntil.IsZero() {
+		return []span{{q.From, q.To}}, span{}, false
+	}
+	from, to := q.From.UTC(), q.To.UTC()
+	if !q.From.IsZero() {
+		rolled.from = from.Truncate(time.Hour)
+		if !from.Before(mark.RawSince) && rolled.from.Before(from) {
+			rolled.from = rolled.from.Add(time.Hour)
+		}
+	}
+	rolled.to = mark.RolledUntil
+	if !q.To.IsZero() && to.Before(mark.RolledUntil) {
+		rolled.to = to.Truncate(time.Hour)
+		if to.Before(mark.RawSince) && rolled.to.Before(to) {
+			rolled.to = rolled.to.Add(time.Hour)
+		}
+	}
+	if !rolled.from.IsZero() && !rolled.from.Before(rolled.to) {
+		return []span{{q.From, q.To}}, span{}, false
+	}
+	if !rolled.from.IsZero() && q.From.Before(rolled.from) {
+		raw = append(raw, span{q.From, rolled.from})
+	}
+	if q.To.IsZero() || rolled.to.Before(to) {
+		raw = append(raw, span{rolled.to, q.To})
+	}
+	return raw, rolled, true
+}
+
+// periods divides a rolled-up span into the whole UTC days within it and
+// the hours around them.
+func periods(sp span) map[Period][]span {
+	first := sp.from.Truncate(24 * time.Hour)
+	if first.Before(sp.from) {
+		first = first.Add(24 * time.Hour)
+	}
+	last := sp.to.Truncate(24 * time.Hour)
+	if !sp.from.IsZero() && !first.Before(last) {
+		return map[Period][]span{PeriodHour: {sp}}
+	}
+	out := map[Period][]span{PeriodDay: {{sp.from, last}}}
+	if !sp.from.IsZero() && sp.from.Before(first) {
+		out[PeriodHour] = append(out[PeriodHour], span{sp.from, first})
+	}
+	if last.Before(sp.to) {
+		out[PeriodHour] = append(out[PeriodHour], span{last, sp.to})
+	}
+	return out
+}
+
+// breakdown counts the clicks matching q per combination of values of
+// dims, from rollups where clicks are rolled up and raw clicks elsewhere.
+func (s *Service) breakdown(ctx context.Context, q Query, dims []Dimension) ([]Count, error) {
+	mark, err := s.store.RollupMark(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, rolled, ok := split(q, mark)
+	group, index, covered := rollupGroupFor(dims)
+	if ok && !covered {
+		// Only raw clicks know this combination of dimensions.
+		raw, ok = []span{{q.From, q.To}}, false
+	}
+
+	var counts []Count
+	seen := make(map[string]int)
+	add := func(c Count) {
+		key := strings.Join(c.Values, ValueSeparator)
+		if i, ok := seen[key]; ok {
+			counts[i].Clicks += c.Clicks
+			return
+		}
+		seen[key] = len(counts)
+		counts = append(counts, c)
+	}
+	for _, sp := range raw {
+		part, err := s.store.Breakdown(ctx, sp.query(q), dims)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range part {
+			add(c)
+		}
+	}
+	if !ok {
+		return counts, nil
+	}
+	for period, spans := range periods(rolled) {
+		for _, sp := range spans {
+			rollups, err := s.store.SumRollups(ctx, sp.query(q), period, group.Name, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range rollups {
+				values := strings.Split(r.Values, ValueSeparator)
+				c := Count{Values: make([]string, len(dims)), Clicks: r.Clicks}
+				for i, j := range index {
+					switch {
+					case j < 0:
+						c.Values[i] = r.Class
+					case j < len(values):
+						c.Values[i] = values[j]
+					}
+				}
+				add(c)
+			}
+		}
+	}
+	return counts, nil
+}
+
+// histogram counts the clicks matching q per step like Store.Histogram,
+// from hourly rollups where clicks are rolled up. Steps shorter than an
+// hour are read from raw clicks wherever they are kept; the rolled-up
+// hours whose clicks are deleted count in the step they start.
+func (s *Service) histogram(ctx context.Context, q Query, step time.Duration) ([]Bucket, error) {
+	mark, err := s.store.RollupMark(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if step%time.Hour != 0 && mark.RawSince.Before(mark.RolledUntil) {
+		// An hour may straddle two buckets, as in zones with half-hour
+		// offsets.
+		mark.RolledUntil = mark.RawSince
+	}
+	raw, rolled, ok := split(q, mark)
+	var buckets []Bucket
+	for _, sp := range raw {
+		part, err := s.store.Histogram(ctx, sp.query(q), step)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, part...)
+	}
+	if ok {
+		rollups, err := s.store.SumRollups(ctx, rolled.query(q), PeriodHour, "", true)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			buckets = append(buckets, Bucket{Start: r.Start.Truncate(step), Clicks: r.Clicks})
+		}
+	}
+	return buckets, nil
+}
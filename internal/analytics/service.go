@@ -0,0 +1,321 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tinygo/pkg/geoip"
+	"tinygo/pkg/useragent"
+)
+
+const (
+	// DefaultPageSize is the number of clicks returned when no limit is set.
+	DefaultPageSize = 100
+	// MaxPageSize caps the number of clicks of a single page.
+	MaxPageSize = 1000
+)
+
+// Service records and queries click events.
+type Service struct {
+	store  Store
+	agents *useragent.Parser
+	geo    *geoip.DB
+	// secret salts the visitor hashes
+	secret []byte
+	now    func() time.Time
+}
+
+// NewService creates a click analytics service on top of store. User-Agents
+// are classified with the built-in rules until SetUserAgentParser is called.
+// The visitor secret is random until SetVisitorSecret or LoadVisitorSecret
+// is called.
+func NewService(store Store) *Service {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("analytics: visitor secret: %v", err))
+	}
+	return &Service{store: store, agents: useragent.Builtin(), secret: secret, now: time.Now}
+}
+
+// SetVisitorSecret sets the secret unique visitor hashes are salted with.
+// Keeping it across restarts keeps counting a returning visitor once per
+// day.
+func (s *Service) SetVisitorSecret(secret string) {
+	s.secret = []byte(secret)
+}
+
+// LoadVisitorSecret switches to the visitor secret kept in the store, which
+// is the current random one on the first start.
+func (s *Service) LoadVisitorSecret(ctx context.Context) error {
+	secret, err := s.store.VisitorSecret(ctx, s.secret)
+	if err != nil {
+		return err
+	}
+	s.secret = secret
+	return nil
+}
+
+// SetUserAgentParser sets the parser that classifies the User-Agent of
+// recorded clicks.
+func (s *Service) SetUserAgentParser(p *useragent.Parser) {
+	s.agents = p
+}
+
+// SetGeoIP sets the database clicks are located with. Without one, clicks
+// have no location and geo breakdowns are unavailable.
+func (s *Service) SetGeoIP(db *geoip.DB) {
+	s.geo = db
+}
+
+// HasGeoIP reports whether clicks are located.
+func (s *Service) HasGeoIP() bool {
+	return s.geo != nil
+}
+
+// Record stores a click and, for human clicks, adds its visitor to the
+// link's sketch of the day. The User-Agent is parsed unless the caller
+// already set Device and the other fields derived from it. The IP is
+// anonymized, overlong fields are truncated to their column sizes and the
+// timestamp, now if missing, is stored in UTC.
+func (s *Service) Record(ctx context.Context, c Click) error {
+	return s.RecordBatch(ctx, []Click{c})
+}
+
+// RecordBatch records clicks like Record, saving them in one write and
+// merging one visitor sketch per link and day.
+func (s *Service) RecordBatch(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	batch := make([]Click, len(clicks))
+	var visitors visitorBatch
+	for i, c := range clicks {
+		if c.At.IsZero() {
+			c.At = s.now()
+		}
+		c.At = c.At.UTC()
+		if s.geo != nil {
+			loc := s.geo.Locate(c.IP)
+			c.Country = truncate(loc.Country, 2)
+			c.Region = truncate(loc.Region, 128)
+			c.City = truncate(loc.City, 128)
+		}
+		if c.Device == "" {
+			s.classify(&c)
+		}
+		if c.Class == useragent.Human {
+			day, hash := s.visitorHash(c)
+			visitors.add(c.Domain, c.Code, day, hash)
+		}
+		c.IP = AnonymizeIP(c.IP)
+		c.Referrer = truncate(c.Referrer, 1024)
+		c.UserAgent = truncate(c.UserAgent, 512)
+		c.Destination = truncate(c.Destination, 2048)
+		c.ReferrerHost, c.ReferrerCategory = ParseReferrer(c.Referrer)
+		c.ReferrerHost = truncate(c.ReferrerHost, 253)
+		c.Browser = truncate(c.Browser, 64)
+		c.BrowserVersion = truncate(c.BrowserVersion, 16)
+		c.OS = truncate(c.OS, 64)
+		batch[i] = c
+	}
+	sketches, err := visitors.encode()
+	if err != nil {
+		return err
+	}
+	if err := s.store.RecordClicks(ctx, batch); err != nil {
+		return err
+	}
+	return s.store.MergeVisitors(ctx, sketches)
+}
+
+// classify sets the fields derived from the User-Agent of c.
+func (s *Service) classify(c *Click) {
+	agent := s.agents.Parse(c.UserAgent)
+	c.Browser, c.BrowserVersion = agent.Browser, agent.BrowserVersion
+	c.OS, c.Device = agent.OS, agent.Device
+	if c.Class == "" {
+		c.Class = agent.Class
+	}
+}
+
+// Page is a page of clicks. NextCursor is empty on the last page.
+type Page struct {
+	Clicks     []Click `json:"clicks"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Clicks returns a page of a link's clicks, newest first, starting after
+// cursor; an empty cursor starts at the newest click.
+func (s *Service) Clicks(ctx context.Context, q Query, cursor string) (Page, error) {
+	if cursor != "" {
+		before, err := decodeCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		q.Before = before
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	q.Limit = min(q.Limit, MaxPageSize)
+	limit := q.Limit
+	// Fetch one more to learn whether there is a next page.
+	q.Limit++
+	clicks, err := s.store.Clicks(ctx, q)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Clicks: clicks}
+	if len(clicks) > limit {
+		page.Clicks = clicks[:limit]
+		page.NextCursor = encodeCursor(page.Clicks[limit-1].ID)
+	}
+	return page, nil
+}
+
+// Count returns the number of stored clicks matching q, ignoring its
+// paging; clicks deleted for retention are not counted.
+func (s *Service) Count(ctx context.Context, q Query) (int64, error) {
+	return s.store.CountClicks(ctx, q)
+}
+
+// Breakdown counts the clicks matching q per combination of values of
+// dims, most clicks first.
+func (s *Service) Breakdown(ctx context.Context, q Query, dims ...Dimension) ([]Count, error) {
+	for _, d := range dims {
+		if !d.Valid() {
+			return nil, fmt.Errorf("%w: %s", ErrDimension, d)
+		}
+	}
+	counts, err := s.breakdown(ctx, q, dims)
+	if err != nil {
+		return nil, err
+	}
+	sortByClicks(counts, func(c Count) (int64, string) { return c.Clicks, strings.Join(c.Values, "\x00") })
+	return counts, nil
+}
+
+// Item is the number of clicks with one value of a dimension. Items, if
+// any, break these clicks down further by the next dimension.
+type Item struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+	Items  []Item `json:"items,omitempty"`
+}
+
+// Tree is a nested breakdown of clicks.
+type Tree struct {
+	Total int64  `json:"total"`
+	Items []Item `json:"items"`
+}
+
+// Tree breaks the clicks matching q down by the first of dims, each value
+// by the second and so on. Every level is sorted by clicks, most first.
+func (s *Service) Tree(ctx context.Context, q Query, dims ...Dimension) (Tree, error) {
+	counts, err := s.Breakdown(ctx, q, dims...)
+	if err != nil {
+		return Tree{}, err
+	}
+	tree := Tree{Items: nest(counts, 0)}
+	for _, c := range counts {
+		tree.Total += c.Clicks
+	}
+	return tree, nil
+}
+
+// nest groups counts by their value at depth into items.
+func nest(counts []Count, depth int) []Item {
+	if len(counts) == 0 || depth >= len(counts[0].Values) {
+		return []Item{}
+	}
+	var (
+		items  []Item
+		groups = map[string][]Count{}
+	)
+	for _, c := range counts {
+		v := c.Values[depth]
+		if _, ok := groups[v]; !ok {
+			items = append(items, Item{Value: v})
+		}
+		groups[v] = append(groups[v], c)
+	}
+	last := depth == len(counts[0].Values)-1
+	for i := range items {
+		for _, c := range groups[items[i].Value] {
+			items[i].Clicks += c.Clicks
+		}
+		if !last {
+			items[i].Items = nest(groups[items[i].Value], depth+1)
+		}
+	}
+	sortByClicks(items, func(it Item) (int64, string) { return it.Clicks, it.Value })
+	return items
+}
+
+// sortByClicks sorts counts by clicks, descending, then by key.
+func sortByClicks[T any](counts []T, key func(T) (int64, string)) {
+	slices.SortFunc(counts, func(a, b T) int {
+		ca, ka := key(a)
+		cb, kb := key(b)
+		if ca != cb {
+			return cmp.Compare(cb, ca)
+		}
+		return strings.Compare(ka, kb)
+	})
+}
+
+// AnonymizeIP masks the host part of an address: the last octet of IPv4
+// addresses and all but the /48 prefix of IPv6 ones. Invalid addresses
+// return an empty string.
+func AnonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+func encodeCursor(id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(id, 10)))
+}
+
+func decodeCursor(cursor string) (uint64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrCursor, cursor)
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrCursor, cursor)
+	}
+	return id, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
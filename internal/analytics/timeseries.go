@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	// Time zones must resolve on hosts without a zoneinfo database.
+	_ "time/tzdata"
+)
+
+var (
+	// ErrInterval is returned for an unknown time series interval.
+	ErrInterval = errors.New("unknown interval")
+	// ErrTooManyBuckets is returned for time series longer than
+	// MaxBuckets.
+	ErrTooManyBuckets = errors.New("too many buckets")
+)
+
+// MaxBuckets caps the length of a time series.
+const MaxBuckets = 5000
+
+// Interval is the bucket size of a time series.
+type Interval string
+
+const (
+	IntervalHour Interval = "hour"
+	IntervalDay  Interval = "day"
+	// IntervalWeek buckets start on Monday.
+	IntervalWeek Interval = "week"
+)
+
+// DefaultSpan returns the time a series covers when no start is given.
+func (i Interval) DefaultSpan() time.Duration {
+	switch i {
+	case IntervalHour:
+		return 24 * time.Hour
+	case IntervalWeek:
+		return 12 * 7 * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// start returns the start of the bucket containing t, in the location of t.
+func (i Interval) start(t time.Time) time.Time {
+	if i == IntervalHour {
+		// Truncated in absolute time: local times repeated at the end of
+		// daylight saving time are ambiguous.
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	}
+	y, m, d := t.Date()
+	if i == IntervalWeek {
+		d -= (int(t.Weekday()) + 6) % 7
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// next returns the start of the bucket after the one starting at t.
+func (i Interval) next(t time.Time) time.Time {
+	switch i {
+	case IntervalHour:
+		// The repeated hour at the end of daylight saving time is a
+		// bucket of its own.
+		return i.start(t.Add(time.Hour))
+	case IntervalWeek:
+		return i.start(t.AddDate(0, 0, 7))
+	}
+	return i.start(t.AddDate(0, 0, 1))
+}
+
+// Bucket is the number of clicks from Start until the start of the next
+// bucket.
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// Series is a zero-filled time series of clicks.
+type Series struct {
+	Interval Interval  `json:"interval"`
+	TZ       string    `json:"tz"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Total    int64     `json:"total"`
+	Buckets  []Bucket  `json:"buckets"`
+}
+
+// Timeseries counts the clicks matching q per interval in loc. The series
+// starts with the bucket containing q.From and ends with the one
+// containing q.To, both required; every bucket is present, empty ones
+// with zero clicks.
+//
+// Stores count clicks per step of UTC time; the steps are then summed
+// into buckets, which keeps daylight saving time and zones with
+// non-hourly offsets correct.
+func (s *Service) Timeseries(ctx context.Context, q Query, interval Interval, loc *time.Location) (Series, error) {
+	switch interval {
+	case IntervalHour, IntervalDay, IntervalWeek:
+	default:
+		return Series{}, fmt.Errorf("%w: %s", ErrInterval, interval)
+	}
+	if q.From.IsZero() || q.To.IsZero() || !q.From.Before(q.To) {
+		return Series{}, errors.New("time series needs a range")
+	}
+	series := Series{Interval: interval, TZ: loc.String(), Buckets: []Bucket{}}
+	// Bucket boundaries; the last one ends the series.
+	var bounds []time.Time
+	for t := interval.start(q.From.In(loc)); ; t = interval.next(t) {
+		bounds = append(bounds, t)
+		if !t.Before(q.To) {
+			break
+		}
+		if len(bounds) > MaxBuckets {
+			return Series{}, fmt.Errorf("%w: more than %d", ErrTooManyBuckets, MaxBuckets)
+		}
+	}
+	series.From, series.To = bounds[0], bounds[len(bounds)-1]
+	step := time.Hour
+	for _, b := range bounds {
+		if b.Unix()%int64(time.Hour/time.Second) != 0 {
+			step = 15 * time.Minute
+			break
+		}
+	}
+
+	q.From, q.To = series.From, series.To
+	counts, err := s.histogram(ctx, q, step)
+	if err != nil {
+		return Series{}, err
+	}
+	for _, b := range bounds[:len(bounds)-1] {
+		series.Buckets = append(series.Buckets, Bucket{Start: b})
+	}
+	for _, c := range counts {
+		// The last boundary not after the step start
+		i := sort.Search(len(bounds), func(i int) bool { return bounds[i].After(c.Start) }) - 1
+		if i < 0 || i >= len(series.Buckets) {
+			continue
+		}
+		series.Buckets[i].Clicks += c.Clicks
+		series.Total += c.Clicks
+	}
+	return series, nil
+}
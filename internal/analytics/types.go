@@ -0,0 +1,213 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrCursor is returned for a malformed pagination cursor.
+	ErrCursor = errors.New("invalid cursor")
+	// ErrDimension is returned for an unknown breakdown dimension.
+	ErrDimension = errors.New("unknown dimension")
+)
+
+// Click is a single redirect of a short link. The IP is anonymized before
+// it is stored.
+type Click struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	Domain      string    `gorm:"size:253;not null;default:'';index:idx_clicks_link,priority:1" json:"domain,omitempty"`
+	Code        string    `gorm:"size:32;not null;index:idx_clicks_link,priority:2" json:"code"`
+	At          time.Time `gorm:"not null;index:idx_clicks_link,priority:3;index:idx_clicks_at" json:"at"`
+	Referrer    string    `gorm:"size:1024" json:"referrer,omitempty"`
+	UserAgent   string    `gorm:"size:512" json:"user_agent,omitempty"`
+	IP          string    `gorm:"size:45" json:"ip,omitempty"`
+	Destination string    `gorm:"size:2048" json:"destination"`
+
+	// Derived from Referrer when the click is recorded
+	ReferrerHost     string `gorm:"size:253;not null;default:''" json:"referrer_host,omitempty"`
+	ReferrerCategory string `gorm:"size:16;not null;default:''" json:"referrer_category,omitempty"`
+
+	// Derived from UserAgent when the click is recorded
+	Browser        string `gorm:"size:64;not null;default:''" json:"browser,omitempty"`
+	BrowserVersion string `gorm:"size:16;not null;default:''" json:"browser_version,omitempty"`
+	OS             string `gorm:"size:64;not null;default:''" json:"os,omitempty"`
+	Device         string `gorm:"size:16;not null;default:''" json:"device,omitempty"`
+	// Class is human, bot or preview (link unfurlers)
+	Class string `gorm:"size:16;not null;default:''" json:"class,omitempty"`
+
+	// Looked up from the IP, before it is anonymized, when a GeoIP
+	// database is configured
+	Country string `gorm:"size:2;not null;default:''" json:"country,omitempty"`
+	Region  string `gorm:"size:128;not null;default:''" json:"region,omitempty"`
+	City    string `gorm:"size:128;not null;default:''" json:"city,omitempty"`
+}
+
+// TableName returns the table name for the Click model
+func (Click) TableName() string {
+	return "clicks"
+}
+
+// VisitorSketch is the HyperLogLog sketch of the visitors of one link on
+// one UTC day. Sketches of the same link merge across days.
+type VisitorSketch struct {
+	Domain string `gorm:"primaryKey;size:253;not null;default:''" json:"domain,omitempty"`
+	Code   string `gorm:"primaryKey;size:32" json:"code"`
+	// Day is the date in YYYY-MM-DD form
+	Day string `gorm:"primaryKey;size:10" json:"day"`
+	// Sketch is an encoded hll.Sketch
+	Sketch []byte `gorm:"not null" json:"sketch"`
+}
+
+// TableName returns the table name for the VisitorSketch model
+func (VisitorSketch) TableName() string {
+	return "visitor_sketches"
+}
+
+// VisitorSecret is the secret visitor hashes are salted with when none is
+// configured, kept so that restarts do not count visitors again.
+type VisitorSecret struct {
+	ID     uint   `gorm:"primaryKey" json:"-"`
+	Secret []byte `gorm:"not null" json:"-"`
+}
+
+// TableName returns the table name for the VisitorSecret model
+func (VisitorSecret) TableName() string {
+	return "visitor_secrets"
+}
+
+// Dimension is a click attribute that breakdowns group by. Its value is
+// the column name.
+type Dimension string
+
+const (
+	DimReferrerHost     Dimension = "referrer_host"
+	DimReferrerCategory Dimension = "referrer_category"
+	DimBrowser          Dimension = "browser"
+	DimBrowserVersion   Dimension = "browser_version"
+	DimOS               Dimension = "os"
+	DimDevice           Dimension = "device"
+	DimClass            Dimension = "class"
+	DimCountry          Dimension = "country"
+	DimRegion           Dimension = "region"
+	DimCity             Dimension = "city"
+)
+
+// Valid reports whether d is a known dimension.
+func (d Dimension) Valid() bool {
+	switch d {
+	case DimReferrerHost, DimReferrerCategory, DimBrowser, DimBrowserVersion, DimOS, DimDevice, DimClass,
+		DimCountry, DimRegion, DimCity:
+		return true
+	}
+	return false
+}
+
+// Value returns the value of dimension d of the click.
+func (c Click) Value(d Dimension) string {
+	switch d {
+	case DimReferrerHost:
+		return c.ReferrerHost
+	case DimReferrerCategory:
+		return c.ReferrerCategory
+	case DimBrowser:
+		return c.Browser
+	case DimBrowserVersion:
+		return c.BrowserVersion
+	case DimOS:
+		return c.OS
+	case DimDevice:
+		return c.Device
+	case DimClass:
+		return c.Class
+	case DimCountry:
+		return c.Country
+	case DimRegion:
+		return c.Region
+	case DimCity:
+		return c.City
+	}
+	return ""
+}
+
+// Count is the number of clicks with one combination of dimension values,
+// in the order of the dimensions queried.
+type Count struct {
+	Values []string
+	Clicks int64
+}
+
+// Query selects the clicks of one link, newest first.
+type Query struct {
+	Domain string
+	// Code is the link's code; empty selects the clicks of all links,
+	// whatever the domain.
+	Code string
+	// Class keeps clicks of one request class (human, bot or preview);
+	// empty keeps all.
+	Class string
+	// From is inclusive and To exclusive; zero times leave the range open.
+	From time.Time
+	To   time.Time
+	// Before keeps clicks with a smaller ID, for keyset pagination; zero
+	// starts at the newest click.
+	Before uint64
+	// Offset skips clicks, for clients that page by number.
+	Offset int
+	Limit  int
+}
+
+// Days returns the first and last UTC day, in YYYY-MM-DD form, touched by
+// the time range of q; open bounds are empty.
+func (q Query) Days() (first, last string) {
+	if !q.From.IsZero() {
+		first = q.From.UTC().Format(time.DateOnly)
+	}
+	if !q.To.IsZero() {
+		last = q.To.Add(-time.Nanosecond).UTC().Format(time.DateOnly)
+	}
+	return first, last
+}
+
+// Store defines persistence behaviors for Click records.
+type Store interface {
+	// RecordClicks saves new clicks and assigns their IDs.
+	RecordClicks(ctx context.Context, clicks []Click) error
+	Clicks(ctx context.Context, q Query) ([]Click, error)
+	// CountClicks counts the clicks matching q, ignoring its paging.
+	CountClicks(ctx context.Context, q Query) (int64, error)
+	// Breakdown counts the clicks matching q, ignoring its paging, per
+	// combination of values of the valid dimensions dims.
+	Breakdown(ctx context.Context, q Query, dims []Dimension) ([]Count, error)
+	// Histogram counts the clicks matching q, ignoring its paging, per
+	// step of UTC time since the Unix epoch. Empty steps are left out.
+	Histogram(ctx context.Context, q Query, step time.Duration) ([]Bucket, error)
+	// MergeVisitors merges each sketch into the stored sketch of the same
+	// link and day, creating it if there is none.
+	MergeVisitors(ctx context.Context, sketches []VisitorSketch) error
+	// VisitorSketches returns the sketches of the link of q for the days
+	// its time range touches, ordered by day.
+	VisitorSketches(ctx context.Context, q Query) ([]VisitorSketch, error)
+	// VisitorSecret returns the stored visitor secret, storing candidate
+	// first if there is none, so that concurrent first starts agree.
+	VisitorSecret(ctx context.Context, candidate []byte) ([]byte, error)
+	// RollupMark returns the progress of rollups and retention.
+	RollupMark(ctx context.Context) (RollupMark, error)
+	// RollupHours counts the clicks in [from, to), from possibly zero, per
+	// link, UTC hour, class and combination of values of dims, as hourly
+	// rollups without a group.
+	RollupHours(ctx context.Context, from, to time.Time, dims []Dimension) ([]Rollup, error)
+	// SaveRollups adds rollups of the hours from from until until to the
+	// stored ones with the same key and moves RolledUntil to until,
+	// atomically. It saves nothing and returns false if RolledUntil is no
+	// longer from, as when another process rolled these hours up.
+	SaveRollups(ctx context.Context, rollups []Rollup, from, until time.Time) (bool, error)
+	// DeleteClicks deletes the clicks before before and moves RawSince to
+	// it.
+	DeleteClicks(ctx context.Context, before time.Time) (int64, error)
+	// SumRollups sums the rollups of period and group matching the link,
+	// class and time range of q per class and values and, with perStart,
+	// per start.
+	SumRollups(ctx context.Context, q Query, period Period, group string, perStart bool) ([]Rollup, error)
+}
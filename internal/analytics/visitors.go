@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"tinygo/pkg/hll"
+)
+
+// DayVisitors is the approximate number of unique visitors of one UTC day.
+type DayVisitors struct {
+	Day            string `json:"day"`
+	UniqueVisitors uint64 `json:"unique_visitors"`
+}
+
+// VisitorStats summarizes the visits of a link. Unique visitor counts are
+// estimates within about 1.6%. Visitor hashes change daily, so a visitor
+// returning on another day counts once per day in UniqueVisitors.
+type VisitorStats struct {
+	Clicks         int64         `json:"clicks"`
+	UniqueVisitors uint64        `json:"unique_visitors"`
+	Days           []DayVisitors `json:"days"`
+}
+
+// Visitors returns the clicks and unique visitors of the link of q. Unique
+// visitors are kept per day, so they cover every UTC day the time range of
+// q touches; days without visits are omitted.
+func (s *Service) Visitors(ctx context.Context, q Query) (VisitorStats, error) {
+	counts, err := s.breakdown(ctx, q, nil)
+	if err != nil {
+		return VisitorStats{}, err
+	}
+	var clicks int64
+	for _, c := range counts {
+		clicks += c.Clicks
+	}
+	sketches, err := s.store.VisitorSketches(ctx, q)
+	if err != nil {
+		return VisitorStats{}, err
+	}
+	stats := VisitorStats{Clicks: clicks, Days: make([]DayVisitors, 0, len(sketches))}
+	total := hll.New()
+	for _, vs := range sketches {
+		day := hll.New()
+		if err := day.UnmarshalBinary(vs.Sketch); err != nil {
+			return VisitorStats{}, err
+		}
+		total.Merge(day)
+		stats.Days = append(stats.Days, DayVisitors{Day: vs.Day, UniqueVisitors: day.Count()})
+	}
+	stats.UniqueVisitors = total.Count()
+	return stats, nil
+}
+
+// MergeSketches merges two encoded visitor sketches. Stores use it to
+// update stored sketches.
+func MergeSketches(a, b []byte) ([]byte, error) {
+	sa, sb := hll.New(), hll.New()
+	if err := sa.UnmarshalBinary(a); err != nil {
+		return nil, err
+	}
+	if err := sb.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	sa.Merge(sb)
+	return sa.MarshalBinary()
+}
+
+// visitorHash returns the day of a visit and the hash of its visitor. The
+// visitor is the pair of IP, before it is anonymized, and User-Agent,
+// hashed with a salt derived from the secret and the day: the hash
+// identifies nobody and cannot be linked across days.
+func (s *Service) visitorHash(c Click) (string, uint64) {
+	day := c.At.UTC().Format(time.DateOnly)
+	salt := hmac.New(sha256.New, s.secret)
+	salt.Write([]byte(day))
+	h := hmac.New(sha256.New, salt.Sum(nil))
+	h.Write([]byte(c.IP))
+	h.Write([]byte{0})
+	h.Write([]byte(c.UserAgent))
+	return day, binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// visitorBatch collects the visitors of a batch of clicks into one sketch
+// per link and day.
+type visitorBatch struct {
+	keys     []visitorDay
+	sketches map[visitorDay]*hll.Sketch
+}
+
+type visitorDay struct{ domain, code, day string }
+
+func (b *visitorBatch) add(domain, code, day string, hash uint64) {
+	key := visitorDay{domain, code, day}
+	sketch, ok := b.sketches[key]
+	if !ok {
+		if b.sketches == nil {
+			b.sketches = make(map[visitorDay]*hll.Sketch)
+		}
+		sketch = hll.New()
+		b.sketches[key] = sketch
+		b.keys = append(b.keys, key)
+	}
+	sketch.Add(hash)
+}
+
+// encode returns the sketches in the order their link and day were added.
+func (b *visitorBatch) encode() ([]VisitorSketch, error) {
+	out := make([]VisitorSketch, 0, len(b.keys))
+	for _, key := range b.keys {
+		data, err := b.sketches[key].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, VisitorSketch{Domain: key.domain, Code: key.code, Day: key.day, Sketch: data})
+	}
+	return out, nil
+}
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"tinygo/internal/config"
@@ -16,6 +18,9 @@ import (
 // Store holds the session store
 var Store *sessions.CookieStore
 
+// apiKeys holds the keys accepted by token-authenticated APIs
+var apiKeys []string
+
 // Init initializes the authentication system
 func Init(cfg config.AuthConfig) {
 	// Generate a random session key if not provided
@@ -38,7 +43,34 @@ func Init(cfg config.AuthConfig) {
 		SameSite: http.SameSiteLaxMode,
 	}
 
-	logger.Log.Info("authentication system initialized")
+	apiKeys = nil
+	for _, k := range cfg.APIKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			apiKeys = append(apiKeys, k)
+		}
+	}
+
+	logger.Log.Info("authentication system initialized", "api_keys", len(apiKeys))
+}
+
+// ValidAPIKey reports whether key is one of the configured API keys
+func ValidAPIKey(key string) bool {
+	return MatchAPIKey(func(k string) bool {
+		return subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1
+	})
+}
+
+// MatchAPIKey reports whether match accepts any configured API key, for
+// schemes that sign requests with the key instead of sending it
+func MatchAPIKey(match func(key string) bool) bool {
+	found := false
+	for _, k := range apiKeys {
+		// Check every key so timing does not reveal which one matched
+		if match(k) {
+			found = true
+		}
+	}
+	return found
 }
 
 // IsAuthenticated checks if the user is authenticated
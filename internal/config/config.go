@@ -4,26 +4,76 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+
+	"tinygo/pkg/random"
 )
 
 // Config holds runtime configuration for the server.
 // Environment variables override file values when provided.
 type Config struct {
-	Addr       string `json:"addr" yaml:"addr" mapstructure:"addr"`
-	BaseURL    string `json:"base_url" yaml:"base_url" mapstructure:"base_url"`
-	DataFile   string `json:"data_file" yaml:"data_file" mapstructure:"data_file"`
-	CodeLength int    `json:"code_length" yaml:"code_length" mapstructure:"code_length"`
-	LogLevel   string `json:"log_level" yaml:"log_level" mapstructure:"log_level"`
-	LogFormat  string `json:"log_format" yaml:"log_format" mapstructure:"log_format"`
+	Addr         string `json:"addr" yaml:"addr" mapstructure:"addr"`
+	BaseURL      string `json:"base_url" yaml:"base_url" mapstructure:"base_url"`
+	DataFile     string `json:"data_file" yaml:"data_file" mapstructure:"data_file"`
+	CodeLength   int    `json:"code_length" yaml:"code_length" mapstructure:"code_length"`
+	CodeAlphabet string `json:"code_alphabet" yaml:"code_alphabet" mapstructure:"code_alphabet"`
+	CodeStrategy string `json:"code_strategy" yaml:"code_strategy" mapstructure:"code_strategy"`
+	LogLevel     string `json:"log_level" yaml:"log_level" mapstructure:"log_level"`
+	LogFormat    string `json:"log_format" yaml:"log_format" mapstructure:"log_format"`
+
+	// Extra branded domains served besides the base_url host; each one is
+	// its own code namespace
+	Domains []string `json:"domains" yaml:"domains" mapstructure:"domains"`
+
+	// DNS verification of domains added through the API
+	DomainVerification DomainVerificationConfig `json:"domain_verification" yaml:"domain_verification" mapstructure:"domain_verification"`
+
+	// Resolve codes regardless of letter case
+	CaseInsensitiveCodes bool `json:"case_insensitive_codes" yaml:"case_insensitive_codes" mapstructure:"case_insensitive_codes"`
 
 	// Database configuration
 	Database DatabaseConfig `json:"database" yaml:"database" mapstructure:"database"`
 
 	// Authentication configuration
 	Auth AuthConfig `json:"auth" yaml:"auth" mapstructure:"auth"`
+
+	// Sequential code generation
+	Sequence SequenceConfig `json:"sequence" yaml:"sequence" mapstructure:"sequence"`
+
+	// Content-hash code generation
+	Hash HashConfig `json:"hash" yaml:"hash" mapstructure:"hash"`
+
+	// Word-based code generation
+	Words WordsConfig `json:"words" yaml:"words" mapstructure:"words"`
+
+	// Automatic growth of the random code length
+	AdaptiveLength AdaptiveLengthConfig `json:"adaptive_length" yaml:"adaptive_length" mapstructure:"adaptive_length"`
+
+	// Offensive-word filter for short codes
+	WordFilter WordFilterConfig `json:"word_filter" yaml:"word_filter" mapstructure:"word_filter"`
+
+	// Click event recording
+	Analytics AnalyticsConfig `json:"analytics" yaml:"analytics" mapstructure:"analytics"`
+
+	// Separate counting of bot and link preview redirects
+	BotFilter BotFilterConfig `json:"bot_filter" yaml:"bot_filter" mapstructure:"bot_filter"`
+
+	// Background batching of hit counters and click events
+	HitQueue HitQueueConfig `json:"hit_queue" yaml:"hit_queue" mapstructure:"hit_queue"`
+	// Live click streams
+	Live LiveConfig `json:"live" yaml:"live" mapstructure:"live"`
+}
+
+// DomainVerificationConfig holds configuration for verifying custom domains
+type DomainVerificationConfig struct {
+	// DNS server queried for verification records as host:port; empty uses
+	// the system resolver
+	Resolver     string `json:"resolver" yaml:"resolver" mapstructure:"resolver"`
+	RecordPrefix string `json:"record_prefix" yaml:"record_prefix" mapstructure:"record_prefix"`
 }
 
 // DatabaseConfig holds database configuration
@@ -39,17 +89,118 @@ type AuthConfig struct {
 	Password      string `json:"password" yaml:"password" mapstructure:"password"`
 	SessionKey    string `json:"session_key" yaml:"session_key" mapstructure:"session_key"`
 	SessionMaxAge int    `json:"session_max_age" yaml:"session_max_age" mapstructure:"session_max_age"`
+	// Keys accepted by the token-authenticated compatibility APIs
+	APIKeys []string `json:"api_keys" yaml:"api_keys" mapstructure:"api_keys"`
+}
+
+// SequenceConfig holds configuration for sequential obfuscated codes
+type SequenceConfig struct {
+	Secret    string `json:"secret" yaml:"secret" mapstructure:"secret"`
+	MinLength int    `json:"min_length" yaml:"min_length" mapstructure:"min_length"`
+}
+
+// HashConfig holds configuration for deterministic content-hash codes
+type HashConfig struct {
+	Secret string `json:"secret" yaml:"secret" mapstructure:"secret"`
+	Length int    `json:"length" yaml:"length" mapstructure:"length"`
+}
+
+// WordsConfig holds configuration for pronounceable word-based codes
+type WordsConfig struct {
+	Count     int    `json:"count" yaml:"count" mapstructure:"count"`
+	Separator string `json:"separator" yaml:"separator" mapstructure:"separator"`
+	Digits    int    `json:"digits" yaml:"digits" mapstructure:"digits"`
+}
+
+// AdaptiveLengthConfig holds configuration for growing the code length when
+// the keyspace gets crowded
+type AdaptiveLengthConfig struct {
+	Enabled          bool    `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	GrowAfterRetries int     `json:"grow_after_retries" yaml:"grow_after_retries" mapstructure:"grow_after_retries"`
+	MaxLength        int     `json:"max_length" yaml:"max_length" mapstructure:"max_length"`
+	MaxUtilization   float64 `json:"max_utilization" yaml:"max_utilization" mapstructure:"max_utilization"`
+}
+
+// WordFilterConfig holds the offensive-word filter configuration
+type WordFilterConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Builtin bool     `json:"builtin" yaml:"builtin" mapstructure:"builtin"`
+	Paths   []string `json:"paths" yaml:"paths" mapstructure:"paths"`
+}
+
+// AnalyticsConfig holds the click analytics configuration
+type AnalyticsConfig struct {
+	// Record an event for every redirect
+	Enabled bool `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// Take the client IP from X-Forwarded-For; only safe behind a proxy
+	// that sets it
+	TrustProxy bool `json:"trust_proxy" yaml:"trust_proxy" mapstructure:"trust_proxy"`
+	// Proxies in front that append to X-Forwarded-For; the client IP is
+	// the entry this many from the right
+	TrustedHops int `json:"trusted_hops" yaml:"trusted_hops" mapstructure:"trusted_hops"`
+	// Rule file checked before the built-in User-Agent rules
+	UARules string `json:"ua_rules" yaml:"ua_rules" mapstructure:"ua_rules"`
+	// MaxMind DB (GeoLite2/GeoIP2 country or city) clicks are located
+	// with; empty disables geo analytics
+	GeoIPDB string `json:"geoip_db" yaml:"geoip_db" mapstructure:"geoip_db"`
+	// Secret the daily unique visitor salts are derived from; generated
+	// and stored on the first start if empty
+	VisitorSecret string `json:"visitor_secret" yaml:"visitor_secret" mapstructure:"visitor_secret"`
+	// Roll clicks up into hourly and daily counts in the background
+	Rollups bool `json:"rollups" yaml:"rollups" mapstructure:"rollups"`
+	// Days raw click events are kept once rolled up; 0 keeps them forever
+	RetentionDays int `json:"retention_days" yaml:"retention_days" mapstructure:"retention_days"`
+}
+
+// BotFilterConfig holds the classification of redirects into human, bot
+// and link preview requests
+type BotFilterConfig struct {
+	// Count only human redirects in hit_count and the others in
+	// bot_hit_count; disabled, every redirect counts as human
+	Enabled bool `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// Answer HEAD requests without counting or recording them
+	IgnoreHead bool `json:"ignore_head" yaml:"ignore_head" mapstructure:"ignore_head"`
+}
+
+// HitQueueConfig holds the batching of redirect counting
+type HitQueueConfig struct {
+	// Count redirects in the background and write them in batches;
+	// disabled, every redirect writes its counters and click before
+	// responding
+	Enabled bool `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// Number of redirects the queue holds
+	Size int `json:"size" yaml:"size" mapstructure:"size"`
+	// Milliseconds between batch writes
+	FlushIntervalMS int `json:"flush_interval_ms" yaml:"flush_interval_ms" mapstructure:"flush_interval_ms"`
+	// Write a batch early once it holds this many redirects
+	BatchSize int `json:"batch_size" yaml:"batch_size" mapstructure:"batch_size"`
+	// What happens to redirects while the queue is full: drop, block or sync
+	DropPolicy string `json:"drop_policy" yaml:"drop_policy" mapstructure:"drop_policy"`
+}
+
+// LiveConfig holds the streaming of redirects as server-sent events
+type LiveConfig struct {
+	// Serve /api/live and /api/links/{code}/live
+	Enabled bool `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// Events a client may fall behind before it is disconnected
+	Buffer int `json:"buffer" yaml:"buffer" mapstructure:"buffer"`
+	// Maximum concurrent streams; 0 is unlimited
+	MaxSubscribers int `json:"max_subscribers" yaml:"max_subscribers" mapstructure:"max_subscribers"`
+	// Seconds between keepalive comments on idle streams
+	KeepaliveSeconds int `json:"keepalive_seconds" yaml:"keepalive_seconds" mapstructure:"keepalive_seconds"`
 }
 
 // Default returns sane defaults for local development.
 func Default() Config {
 	return Config{
-		Addr:       ":8080",
-		BaseURL:    "http://localhost:8080",
-		DataFile:   filepath.Join("data", "links.json"),
-		CodeLength: 7,
-		LogLevel:   "info",
-		LogFormat:  "text",
+		Addr:         ":8080",
+		BaseURL:      "http://localhost:8080",
+		DataFile:     filepath.Join("data", "links.json"),
+		CodeLength:   7,
+		CodeAlphabet: random.Base62.Name(),
+		CodeStrategy: "random",
+		LogLevel:     "info",
+		LogFormat:    "text",
 		Database: DatabaseConfig{
 			Driver:   "sqlite",
 			DSN:      "data/tinygo.db",
@@ -61,6 +212,48 @@ func Default() Config {
 			SessionKey:    "tinygo_session",
 			SessionMaxAge: 3600, // 1 hour
 		},
+		DomainVerification: DomainVerificationConfig{
+			RecordPrefix: "_tinygo-verify",
+		},
+		Sequence: SequenceConfig{
+			MinLength: 4,
+		},
+		Words: WordsConfig{
+			Count:     2,
+			Separator: "-",
+			Digits:    2,
+		},
+		AdaptiveLength: AdaptiveLengthConfig{
+			Enabled:          true,
+			GrowAfterRetries: 2,
+			MaxLength:        12,
+			MaxUtilization:   0.05,
+		},
+		WordFilter: WordFilterConfig{
+			Enabled: true,
+			Builtin: true,
+		},
+		Analytics: AnalyticsConfig{
+			Enabled:     true,
+			TrustedHops: 1,
+			Rollups:     true,
+		},
+		BotFilter: BotFilterConfig{
+			Enabled: true,
+		},
+		HitQueue: HitQueueConfig{
+			Enabled:         true,
+			Size:            10000,
+			FlushIntervalMS: 1000,
+			BatchSize:       500,
+			DropPolicy:      "drop",
+		},
+		Live: LiveConfig{
+			Enabled:          true,
+			Buffer:           64,
+			MaxSubscribers:   100,
+			KeepaliveSeconds: 15,
+		},
 	}
 }
 
@@ -99,6 +292,12 @@ func Load() (Config, error) {
 			cfg.CodeLength = n
 		}
 	}
+	if v := os.Getenv("CODE_ALPHABET"); v != "" {
+		cfg.CodeAlphabet = v
+	}
+	if v := os.Getenv("CODE_STRATEGY"); v != "" {
+		cfg.CodeStrategy = v
+	}
 	if v := os.Getenv("LOG_LEVEL"); v != "" {
 		cfg.LogLevel = v
 	}
@@ -144,12 +343,81 @@ func merge(dst *Config, src Config) {
 	if src.CodeLength > 0 {
 		dst.CodeLength = src.CodeLength
 	}
+	if src.CodeAlphabet != "" {
+		dst.CodeAlphabet = src.CodeAlphabet
+	}
+	if src.CodeStrategy != "" {
+		dst.CodeStrategy = src.CodeStrategy
+	}
+	if src.Sequence.Secret != "" {
+		dst.Sequence.Secret = src.Sequence.Secret
+	}
+	if src.Sequence.MinLength > 0 {
+		dst.Sequence.MinLength = src.Sequence.MinLength
+	}
+	if src.Hash.Secret != "" {
+		dst.Hash.Secret = src.Hash.Secret
+	}
+	if src.Hash.Length > 0 {
+		dst.Hash.Length = src.Hash.Length
+	}
 	if src.LogLevel != "" {
 		dst.LogLevel = src.LogLevel
 	}
 	if src.LogFormat != "" {
 		dst.LogFormat = src.LogFormat
 	}
+	if len(src.Domains) > 0 {
+		dst.Domains = src.Domains
+	}
+	if src.DomainVerification.Resolver != "" {
+		dst.DomainVerification.Resolver = src.DomainVerification.Resolver
+	}
+	if src.DomainVerification.RecordPrefix != "" {
+		dst.DomainVerification.RecordPrefix = src.DomainVerification.RecordPrefix
+	}
+	if len(src.Auth.APIKeys) > 0 {
+		dst.Auth.APIKeys = src.Auth.APIKeys
+	}
+	if len(src.WordFilter.Paths) > 0 {
+		dst.WordFilter.Paths = src.WordFilter.Paths
+	}
+	if src.Analytics.TrustedHops > 0 {
+		dst.Analytics.TrustedHops = src.Analytics.TrustedHops
+	}
+	if src.Analytics.UARules != "" {
+		dst.Analytics.UARules = src.Analytics.UARules
+	}
+	if src.Analytics.GeoIPDB != "" {
+		dst.Analytics.GeoIPDB = src.Analytics.GeoIPDB
+	}
+	if src.Analytics.VisitorSecret != "" {
+		dst.Analytics.VisitorSecret = src.Analytics.VisitorSecret
+	}
+	if src.Analytics.RetentionDays > 0 {
+		dst.Analytics.RetentionDays = src.Analytics.RetentionDays
+	}
+	if src.HitQueue.Size > 0 {
+		dst.HitQueue.Size = src.HitQueue.Size
+	}
+	if src.HitQueue.FlushIntervalMS > 0 {
+		dst.HitQueue.FlushIntervalMS = src.HitQueue.FlushIntervalMS
+	}
+	if src.HitQueue.BatchSize > 0 {
+		dst.HitQueue.BatchSize = src.HitQueue.BatchSize
+	}
+	if src.HitQueue.DropPolicy != "" {
+		dst.HitQueue.DropPolicy = src.HitQueue.DropPolicy
+	}
+	if src.Live.Buffer > 0 {
+		dst.Live.Buffer = src.Live.Buffer
+	}
+	if src.Live.MaxSubscribers > 0 {
+		dst.Live.MaxSubscribers = src.Live.MaxSubscribers
+	}
+	if src.Live.KeepaliveSeconds > 0 {
+		dst.Live.KeepaliveSeconds = src.Live.KeepaliveSeconds
+	}
 }
 
 // Validate checks if the configuration is valid
@@ -160,8 +428,102 @@ func (c *Config) Validate() error {
 	if c.BaseURL == "" {
 		return fmt.Errorf("base_url cannot be empty")
 	}
-	if c.CodeLength < 3 || c.CodeLength > 32 {
-		return fmt.Errorf("code_length must be between 3 and 32")
+	for _, d := range c.Domains {
+		if d == "" || strings.ContainsAny(d, "/ ") {
+			return fmt.Errorf("invalid domain: %q", d)
+		}
+	}
+	if r := c.DomainVerification.Resolver; r != "" {
+		if _, _, err := net.SplitHostPort(r); err != nil {
+			return fmt.Errorf("domain_verification.resolver must be host:port: %w", err)
+		}
+	}
+	if p := c.DomainVerification.RecordPrefix; p == "" || strings.ContainsAny(p, ". ") {
+		return fmt.Errorf("domain_verification.record_prefix must be a single DNS label")
+	}
+	// A code length of 0 derives the length from the alphabet
+	if c.CodeLength != 0 && (c.CodeLength < 3 || c.CodeLength > 32) {
+		return fmt.Errorf("code_length must be 0 or between 3 and 32")
+	}
+	if _, ok := random.Lookup(c.CodeAlphabet); !ok {
+		return fmt.Errorf("invalid code_alphabet: %s (want one of %v)", c.CodeAlphabet, random.Presets())
+	}
+	switch c.CodeStrategy {
+	case "random":
+	case "sequential":
+		if c.Sequence.Secret == "" {
+			return fmt.Errorf("sequence.secret is required for the sequential code strategy - set TINYGO_SEQUENCE_SECRET environment variable")
+		}
+		// Shorter codes would not pass code validation
+		if c.Sequence.MinLength < 3 || c.Sequence.MinLength > 32 {
+			return fmt.Errorf("sequence.min_length must be between 3 and 32")
+		}
+	case "words":
+	case "hash":
+		if c.Hash.Secret == "" {
+			return fmt.Errorf("hash.secret is required for the hash code strategy - set TINYGO_HASH_SECRET environment variable")
+		}
+	default:
+		return fmt.Errorf("invalid code_strategy: %s", c.CodeStrategy)
+	}
+	if c.Hash.Length != 0 && (c.Hash.Length < 3 || c.Hash.Length > 32) {
+		return fmt.Errorf("hash.length must be 0 or between 3 and 32")
+	}
+	if c.Words.Count < 1 {
+		return fmt.Errorf("words.count must be positive")
+	}
+	if c.Words.Separator != "" && c.Words.Separator != "-" && c.Words.Separator != "_" {
+		return fmt.Errorf("words.separator must be \"-\", \"_\" or empty")
+	}
+	if c.Words.Digits < 0 {
+		return fmt.Errorf("words.digits cannot be negative")
+	}
+	wordOpts := random.WordOptions{Words: c.Words.Count, Separator: c.Words.Separator, Digits: c.Words.Digits}
+	if wordOpts.MaxLength() > 32 {
+		return fmt.Errorf("words codes may reach %d characters, the limit is 32", wordOpts.MaxLength())
+	}
+	if c.AdaptiveLength.Enabled {
+		if c.AdaptiveLength.GrowAfterRetries < 1 {
+			return fmt.Errorf("adaptive_length.grow_after_retries must be positive")
+		}
+		if c.AdaptiveLength.MaxLength < 3 || c.AdaptiveLength.MaxLength > 32 {
+			return fmt.Errorf("adaptive_length.max_length must be between 3 and 32")
+		}
+		if c.AdaptiveLength.MaxUtilization < 0 || c.AdaptiveLength.MaxUtilization > 1 {
+			return fmt.Errorf("adaptive_length.max_utilization must be between 0 and 1")
+		}
+	}
+	if c.Analytics.TrustProxy && c.Analytics.TrustedHops < 1 {
+		return fmt.Errorf("analytics.trusted_hops must be at least 1")
+	}
+	if c.Analytics.RetentionDays < 0 {
+		return fmt.Errorf("analytics.retention_days cannot be negative")
+	}
+	if c.Analytics.RetentionDays > 0 && !c.Analytics.Rollups {
+		return fmt.Errorf("analytics.retention_days needs analytics.rollups; deleted clicks would be lost from stats")
+	}
+	if c.HitQueue.Enabled {
+		if c.HitQueue.Size < 1 || c.HitQueue.FlushIntervalMS < 1 || c.HitQueue.BatchSize < 1 {
+			return fmt.Errorf("hit_queue.size, flush_interval_ms and batch_size must be positive")
+		}
+		// Queued clicks must be written well before their hour is rolled
+		// up, five minutes after it ends; later ones are never counted.
+		if c.HitQueue.FlushIntervalMS > 60000 {
+			return fmt.Errorf("hit_queue.flush_interval_ms must not exceed 60000")
+		}
+		switch c.HitQueue.DropPolicy {
+		case "drop", "block", "sync":
+		default:
+			return fmt.Errorf("invalid hit_queue.drop_policy: %s (want drop, block or sync)", c.HitQueue.DropPolicy)
+		}
+	}
+	if c.Live.Enabled {
+		if c.Live.Buffer < 1 || c.Live.KeepaliveSeconds < 1 {
+			return fmt.Errorf("live.buffer and keepalive_seconds must be positive")
+		}
+		if c.Live.MaxSubscribers < 0 {
+			return fmt.Errorf("live.max_subscribers must not be negative")
+		}
 	}
 
 	validLogLevels := map[string]bool{
@@ -191,6 +553,11 @@ func (c *Config) Validate() error {
 	if c.Auth.SessionMaxAge <= 0 {
 		return fmt.Errorf("auth.session_max_age must be positive")
 	}
+	for _, k := range c.Auth.APIKeys {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("auth.api_keys cannot contain empty keys")
+		}
+	}
 
 	return nil
 }
@@ -17,7 +17,24 @@ func LoadWithViper() (Config, error) {
 	viper.SetDefault("addr", ":8080")
 	viper.SetDefault("base_url", "http://localhost:8080")
 	viper.SetDefault("data_file", "data/links.json")
+	viper.SetDefault("domains", []string{})
+	viper.SetDefault("domain_verification.resolver", "")
+	viper.SetDefault("domain_verification.record_prefix", "_tinygo-verify")
 	viper.SetDefault("code_length", 7)
+	viper.SetDefault("code_alphabet", "base62")
+	viper.SetDefault("code_strategy", "random")
+	viper.SetDefault("case_insensitive_codes", false)
+	viper.SetDefault("sequence.secret", "")
+	viper.SetDefault("sequence.min_length", 4)
+	viper.SetDefault("hash.secret", "")
+	viper.SetDefault("hash.length", 0)
+	viper.SetDefault("words.count", 2)
+	viper.SetDefault("words.separator", "-")
+	viper.SetDefault("words.digits", 2)
+	viper.SetDefault("adaptive_length.enabled", true)
+	viper.SetDefault("adaptive_length.grow_after_retries", 2)
+	viper.SetDefault("adaptive_length.max_length", 12)
+	viper.SetDefault("adaptive_length.max_utilization", 0.05)
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("log_format", "text")
 	viper.SetDefault("database.driver", "sqlite")
@@ -29,6 +46,37 @@ func LoadWithViper() (Config, error) {
 	viper.SetDefault("auth.password", "")
 	viper.SetDefault("auth.session_key", "tinygo_session")
 	viper.SetDefault("auth.session_max_age", 3600)
+	viper.SetDefault("auth.api_keys", []string{})
+
+	// Word filter defaults
+	viper.SetDefault("word_filter.enabled", true)
+	viper.SetDefault("word_filter.builtin", true)
+	viper.SetDefault("word_filter.paths", []string{})
+
+	// Analytics defaults
+	viper.SetDefault("analytics.enabled", true)
+	viper.SetDefault("analytics.trust_proxy", false)
+	viper.SetDefault("analytics.trusted_hops", 1)
+	viper.SetDefault("analytics.ua_rules", "")
+	viper.SetDefault("analytics.geoip_db", "")
+	viper.SetDefault("analytics.visitor_secret", "")
+	viper.SetDefault("analytics.rollups", true)
+	viper.SetDefault("analytics.retention_days", 0)
+
+	// Bot filter defaults
+	viper.SetDefault("bot_filter.enabled", true)
+	viper.SetDefault("bot_filter.ignore_head", false)
+
+	// Hit queue defaults
+	viper.SetDefault("hit_queue.enabled", true)
+	viper.SetDefault("hit_queue.size", 10000)
+	viper.SetDefault("hit_queue.flush_interval_ms", 1000)
+	viper.SetDefault("hit_queue.batch_size", 500)
+	viper.SetDefault("hit_queue.drop_policy", "drop")
+	viper.SetDefault("live.enabled", true)
+	viper.SetDefault("live.buffer", 64)
+	viper.SetDefault("live.max_subscribers", 100)
+	viper.SetDefault("live.keepalive_seconds", 15)
 
 	// Set config file
 	viper.SetConfigName("config")
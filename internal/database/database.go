@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"tinygo/internal/analytics"
 	"tinygo/internal/config"
+	"tinygo/internal/domains"
 	"tinygo/internal/logger"
 	"tinygo/internal/shortener"
 
@@ -39,6 +41,8 @@ func Init(cfg config.DatabaseConfig) error {
 
 	gormConfig := &gorm.Config{
 		Logger: gormlogger.Default.LogMode(gormLogLevel),
+		// Map driver errors such as unique violations to gorm errors
+		TranslateError: true,
 	}
 
 	// Connect to database
@@ -73,7 +77,18 @@ func Init(cfg config.DatabaseConfig) error {
 
 // autoMigrate runs database migrations
 func autoMigrate() error {
-	return DB.AutoMigrate(&shortener.Link{})
+	if err := DB.AutoMigrate(&shortener.Link{}, &shortener.Counter{}, &domains.Domain{}, &analytics.Click{}, &analytics.VisitorSketch{}, &analytics.VisitorSecret{}, &analytics.Rollup{}, &analytics.RollupMark{}); err != nil {
+		return err
+	}
+	// Codes used to be unique on their own; they are now unique per domain.
+	for _, name := range []string{"idx_links_code", "idx_links_code_key"} {
+		if DB.Migrator().HasIndex(&shortener.Link{}, name) {
+			if err := DB.Migrator().DropIndex(&shortener.Link{}, name); err != nil {
+				return fmt.Errorf("drop index %s: %w", name, err)
+			}
+		}
+	}
+	return nil
 }
 
 // Close closes the database connection
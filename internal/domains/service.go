@@ -0,0 +1,306 @@
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"tinygo/internal/shortener"
+)
+
+// cacheTTL bounds how long redirects may act on stale domain settings, for
+// example after another instance verified or removed a domain.
+const cacheTTL = 30 * time.Second
+
+// maxCacheEntries bounds the domain cache, which is keyed by the Host
+// header of every request.
+const maxCacheEntries = 1024
+
+// recordValuePrefix precedes the token in the verification TXT record.
+const recordValuePrefix = "tinygo-verification="
+
+var domainRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Service manages custom domains and decides which hosts are served. Hosts
+// from the static configuration are always served; domains added through
+// the API only once verified.
+type Service struct {
+	store        Store
+	static       map[string]bool
+	resolver     *net.Resolver
+	recordPrefix string
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	domain  Domain
+	found   bool
+	expires time.Time
+}
+
+// NewService creates a domain Service. static lists the configured domains
+// that need no verification.
+func NewService(store Store, static []string) *Service {
+	s := &Service{
+		store:        store,
+		static:       make(map[string]bool, len(static)),
+		resolver:     net.DefaultResolver,
+		recordPrefix: "_tinygo-verify",
+		cache:        make(map[string]cacheEntry),
+	}
+	for _, h := range static {
+		if h = shortener.NormalizeHost(h); h != "" {
+			s.static[h] = true
+		}
+	}
+	return s
+}
+
+// SetResolver sets the resolver used for TXT lookups.
+func (s *Service) SetResolver(r *net.Resolver) {
+	s.resolver = r
+}
+
+// SetRecordPrefix sets the label the verification record lives under.
+func (s *Service) SetRecordPrefix(prefix string) {
+	s.recordPrefix = prefix
+}
+
+// NewResolver returns a resolver that sends all queries to the DNS server at
+// addr ("host:port"). An empty addr returns the system resolver.
+func NewResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// RecordName returns the DNS name the verification TXT record must be
+// published at.
+func (s *Service) RecordName(name string) string {
+	return s.recordPrefix + "." + name
+}
+
+// RecordValue returns the expected content of the verification TXT record.
+func RecordValue(d Domain) string {
+	return recordValuePrefix + d.Token
+}
+
+// Add registers a new, unverified domain with a fresh verification token.
+func (s *Service) Add(ctx context.Context, name, rootRedirect, notFoundURL string) (Domain, error) {
+	name = shortener.NormalizeHost(name)
+	if !domainRegexp.MatchString(name) || len(name) > 253 {
+		return Domain{}, ErrInvalidDomain
+	}
+	if !validOptionalURL(rootRedirect) || !validOptionalURL(notFoundURL) {
+		return Domain{}, ErrInvalidURL
+	}
+	token, err := newToken()
+	if err != nil {
+		return Domain{}, fmt.Errorf("generate token: %w", err)
+	}
+	d, err := s.store.CreateDomain(ctx, Domain{
+		Name:         name,
+		Token:        token,
+		RootRedirect: rootRedirect,
+		NotFoundURL:  notFoundURL,
+	})
+	if err != nil {
+		return Domain{}, err
+	}
+	s.invalidate(name)
+	return d, nil
+}
+
+// Get returns a domain by name.
+func (s *Service) Get(ctx context.Context, name string) (Domain, bool, error) {
+	return s.store.GetDomain(ctx, shortener.NormalizeHost(name))
+}
+
+// List returns all domains added through the API.
+func (s *Service) List(ctx context.Context) ([]Domain, error) {
+	return s.store.ListDomains(ctx)
+}
+
+// Update changes the root redirect and not-found page of a domain. Nil
+// values are left unchanged; empty strings clear them.
+func (s *Service) Update(ctx context.Context, name string, rootRedirect, notFoundURL *string) (Domain, error) {
+	d, ok, err := s.Get(ctx, name)
+	if err != nil {
+		return Domain{}, err
+	}
+	if !ok {
+		return Domain{}, ErrNotFound
+	}
+	if rootRedirect != nil {
+		if !validOptionalURL(*rootRedirect) {
+			return Domain{}, ErrInvalidURL
+		}
+		d.RootRedirect = *rootRedirect
+	}
+	if notFoundURL != nil {
+		if !validOptionalURL(*notFoundURL) {
+			return Domain{}, ErrInvalidURL
+		}
+		d.NotFoundURL = *notFoundURL
+	}
+	if err := s.store.UpdateDomain(ctx, d); err != nil {
+		return Domain{}, err
+	}
+	s.invalidate(d.Name)
+	return d, nil
+}
+
+// Delete removes a domain. Its links stay stored but are no longer served.
+func (s *Service) Delete(ctx context.Context, name string) error {
+	name = shortener.NormalizeHost(name)
+	if err := s.store.DeleteDomain(ctx, name); err != nil {
+		return err
+	}
+	s.invalidate(name)
+	return nil
+}
+
+// Verify looks up the verification TXT record of a domain and activates the
+// domain when it carries the expected token.
+func (s *Service) Verify(ctx context.Context, name string) (Domain, error) {
+	d, ok, err := s.Get(ctx, name)
+	if err != nil {
+		return Domain{}, err
+	}
+	if !ok {
+		return Domain{}, ErrNotFound
+	}
+	if d.Verified {
+		return d, nil
+	}
+	records, err := s.resolver.LookupTXT(ctx, s.RecordName(d.Name))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return d, ErrNotVerified
+		}
+		return d, fmt.Errorf("%w: %v", ErrLookup, err)
+	}
+	want := RecordValue(d)
+	for _, r := range records {
+		if strings.TrimSpace(r) == want {
+			now := time.Now()
+			d.Verified = true
+			d.VerifiedAt = &now
+			if err := s.store.UpdateDomain(ctx, d); err != nil {
+				return Domain{}, err
+			}
+			s.invalidate(d.Name)
+			return d, nil
+		}
+	}
+	return d, ErrNotVerified
+}
+
+// Served reports whether host is a configured or verified domain. It
+// implements shortener.Domains.
+func (s *Service) Served(ctx context.Context, host string) (bool, error) {
+	if s.static[host] {
+		return true, nil
+	}
+	d, ok, err := s.lookup(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	return ok && d.Verified, nil
+}
+
+// Settings returns the verified domain serving host, for its root redirect
+// and not-found page.
+func (s *Service) Settings(ctx context.Context, host string) (Domain, bool, error) {
+	d, ok, err := s.lookup(ctx, shortener.NormalizeHost(host))
+	if err != nil || !ok || !d.Verified {
+		return Domain{}, false, err
+	}
+	return d, true, nil
+}
+
+// lookup returns a domain through the cache.
+func (s *Service) lookup(ctx context.Context, host string) (Domain, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	e, ok := s.cache[host]
+	s.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.domain, e.found, nil
+	}
+	d, found, err := s.store.GetDomain(ctx, host)
+	if err != nil {
+		return Domain{}, false, err
+	}
+	s.mu.Lock()
+	s.remember(host, cacheEntry{domain: d, found: found, expires: now.Add(cacheTTL)}, now)
+	s.mu.Unlock()
+	return d, found, nil
+}
+
+// remember caches e for host. A full cache first drops its expired entries;
+// if it is still full, unknown hosts, which any client can make up, are
+// not cached and known ones replace another entry.
+func (s *Service) remember(host string, e cacheEntry, now time.Time) {
+	if _, ok := s.cache[host]; !ok && len(s.cache) >= maxCacheEntries {
+		for h, old := range s.cache {
+			if !now.Before(old.expires) {
+				delete(s.cache, h)
+			}
+		}
+		if len(s.cache) >= maxCacheEntries {
+			if !e.found {
+				return
+			}
+			for h := range s.cache {
+				delete(s.cache, h)
+				break
+			}
+		}
+	}
+	s.cache[host] = e
+}
+
+func (s *Service) invalidate(host string) {
+	s.mu.Lock()
+	delete(s.cache, host)
+	s.mu.Unlock()
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validOptionalURL reports whether raw is empty or an absolute http(s) URL.
+func validOptionalURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
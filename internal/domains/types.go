@@ -0,0 +1,44 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("domain not found")
+	ErrExists        = errors.New("domain already exists")
+	ErrInvalidDomain = errors.New("invalid domain name")
+	ErrInvalidURL    = errors.New("invalid url")
+	ErrNotVerified   = errors.New("verification record not found")
+	ErrLookup        = errors.New("dns lookup failed")
+)
+
+// Domain is a custom domain added through the API. It serves links only
+// once ownership has been proven with a DNS TXT record.
+type Domain struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Name         string     `gorm:"uniqueIndex;size:253;not null" json:"name"`
+	Token        string     `gorm:"size:64;not null" json:"token"`
+	Verified     bool       `gorm:"not null;default:false" json:"verified"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+	RootRedirect string     `gorm:"size:2048" json:"root_redirect,omitempty"`
+	NotFoundURL  string     `gorm:"size:2048" json:"not_found_url,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table name for the Domain model
+func (Domain) TableName() string {
+	return "domains"
+}
+
+// Store defines persistence behaviors for Domain records.
+type Store interface {
+	CreateDomain(ctx context.Context, d Domain) (Domain, error)
+	GetDomain(ctx context.Context, name string) (Domain, bool, error)
+	ListDomains(ctx context.Context) ([]Domain, error)
+	UpdateDomain(ctx context.Context, d Domain) error
+	DeleteDomain(ctx context.Context, name string) error
+}
@@ -0,0 +1,258 @@
+// Package hits counts redirects in the background. Redirects are queued in
+// memory and written in batches: the counters of each link summed into a
+// single update and the click events saved in one insert.
+package hits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+)
+
+// ErrPolicy is returned for an unknown drop policy.
+var ErrPolicy = errors.New("unknown drop policy")
+
+// Policy decides what happens to a redirect that finds the queue full.
+type Policy string
+
+const (
+	// PolicyDrop discards the redirect; it is neither counted nor
+	// recorded.
+	PolicyDrop Policy = "drop"
+	// PolicyBlock makes the redirect wait for room in the queue.
+	PolicyBlock Policy = "block"
+	// PolicySync writes the redirect right away, as without a queue.
+	PolicySync Policy = "sync"
+)
+
+// Options configures a Queue. Zero values take the defaults.
+type Options struct {
+	// Size is the number of redirects the queue holds, 10000 by default.
+	Size int
+	// FlushInterval is the time between writes, one second by default.
+	FlushInterval time.Duration
+	// BatchSize writes a batch early once it holds this many redirects,
+	// 500 by default.
+	BatchSize int
+	// Policy is PolicyDrop by default.
+	Policy Policy
+}
+
+// Hit is a redirect to count.
+type Hit struct {
+	// Domain is the stored domain of the link, empty for the default one.
+	Domain string
+	Code   string
+	// Bot counts the redirect in the bot hit count.
+	Bot bool
+	At  time.Time
+	// Click is the event to record; nil records none.
+	Click *analytics.Click
+}
+
+// Queue counts redirects in batches. It is safe for concurrent use.
+type Queue struct {
+	links  *shortener.Service
+	clicks *analytics.Service
+	opts   Options
+
+	// mu guards closing hits against concurrent sends.
+	mu      sync.RWMutex
+	closed  bool
+	hits    chan Hit
+	flush   chan chan error
+	done    chan struct{}
+	err     error // of the final write
+	dropped atomic.Int64
+}
+
+// New starts a queue writing counters to links and, if clicks is not nil,
+// click events to clicks. Close must be called to write the last batch.
+func New(links *shortener.Service, clicks *analytics.Service, opts Options) (*Queue, error) {
+	if opts.Size <= 0 {
+		opts.Size = 10000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = PolicyDrop
+	case PolicyDrop, PolicyBlock, PolicySync:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrPolicy, opts.Policy)
+	}
+	q := &Queue{
+		links:  links,
+		clicks: clicks,
+		opts:   opts,
+		hits:   make(chan Hit, opts.Size),
+		flush:  make(chan chan error),
+		done:   make(chan struct{}),
+	}
+	go q.run()
+	return q, nil
+}
+
+// Add queues a redirect. A full queue applies the drop policy; with
+// PolicyBlock, Add gives up when ctx is done. Redirects added after Close
+// are written right away.
+func (q *Queue) Add(ctx context.Context, h Hit) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return q.write(ctx, []Hit{h})
+	}
+	select {
+	case q.hits <- h:
+		return nil
+	default:
+	}
+	switch q.opts.Policy {
+	case PolicyBlock:
+		select {
+		case q.hits <- h:
+			return nil
+		case <-ctx.Done():
+			q.dropped.Add(1)
+			return ctx.Err()
+		}
+	case PolicySync:
+		return q.write(ctx, []Hit{h})
+	}
+	q.dropped.Add(1)
+	return nil
+}
+
+// Flush writes the redirects queued so far.
+func (q *Queue) Flush(ctx context.Context) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return nil
+	}
+	reply := make(chan error, 1)
+	select {
+	case q.flush <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops queueing and writes the remaining redirects, waiting until
+// they are written or ctx is done.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.hits)
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+		return q.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of redirects discarded because the queue was
+// full.
+func (q *Queue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// run collects queued redirects and writes them on every tick, whenever a
+// batch is full and on Flush, until the queue is closed.
+func (q *Queue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []Hit
+	var reported int64
+	write := func() error {
+		err := q.write(context.Background(), pending)
+		pending = pending[:0]
+		if err != nil {
+			logger.Log.Warnf("write hits: %v", err)
+		}
+		if dropped := q.dropped.Load(); dropped > reported {
+			logger.Log.Warnf("hit queue full: dropped %d redirects", dropped-reported)
+			reported = dropped
+		}
+		return err
+	}
+	for {
+		select {
+		case h, ok := <-q.hits:
+			if !ok {
+				q.err = write()
+				return
+			}
+			pending = append(pending, h)
+			if len(pending) >= q.opts.BatchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case reply := <-q.flush:
+			for n := len(q.hits); n > 0; n-- {
+				pending = append(pending, <-q.hits)
+			}
+			reply <- write()
+		}
+	}
+}
+
+// write sums the redirects per link into one counter update and records
+// their clicks.
+func (q *Queue) write(ctx context.Context, hits []Hit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	var counts []shortener.Hits
+	index := make(map[[2]string]int)
+	var clicks []analytics.Click
+	for _, h := range hits {
+		key := [2]string{h.Domain, h.Code}
+		i, ok := index[key]
+		if !ok {
+			i = len(counts)
+			index[key] = i
+			counts = append(counts, shortener.Hits{Domain: h.Domain, Code: h.Code})
+		}
+		if h.Bot {
+			counts[i].Bot++
+		} else {
+			counts[i].Human++
+			if h.At.After(counts[i].LastAccessAt) {
+				counts[i].LastAccessAt = h.At
+			}
+		}
+		if h.Click != nil {
+			clicks = append(clicks, *h.Click)
+		}
+	}
+	err := q.links.AddHits(ctx, counts)
+	if q.clicks != nil {
+		err = errors.Join(err, q.clicks.RecordBatch(ctx, clicks))
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+// Package live fans redirects out to the clients watching them in real
+// time. Publishing never blocks a redirect: every subscriber has its own
+// buffer, and a subscriber that lets it fill up is evicted.
+package live
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooManySubscribers is returned when the subscriber limit is reached.
+var ErrTooManySubscribers = errors.New("too many live subscribers")
+
+// ErrClosed is returned when subscribing to a closed broker.
+var ErrClosed = errors.New("live broker closed")
+
+// Event is a redirect as streamed to subscribers. It carries no client
+// address.
+type Event struct {
+	// ID increases by one with every published event.
+	ID uint64 `json:"id"`
+	// Domain is the stored domain of the link, empty for the default one.
+	Domain         string    `json:"domain,omitempty"`
+	Code           string    `json:"code"`
+	At             time.Time `json:"at"`
+	Class          string    `json:"class"`
+	Referrer       string    `json:"referrer,omitempty"`
+	Browser        string    `json:"browser,omitempty"`
+	BrowserVersion string    `json:"browser_version,omitempty"`
+	OS             string    `json:"os,omitempty"`
+	Device         string    `json:"device,omitempty"`
+}
+
+// Options configures a Broker. Zero values take the defaults.
+type Options struct {
+	// Buffer is the number of events a subscriber may fall behind before
+	// it is evicted, 64 by default.
+	Buffer int
+	// MaxSubscribers limits concurrent subscribers; zero is unlimited.
+	MaxSubscribers int
+}
+
+// Subscription receives the events of one link, or of all links.
+type Subscription struct {
+	domain, code string
+	all          bool
+	events       chan Event
+	evicted      atomic.Bool
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the subscription is cancelled, evicted or the broker is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Evicted reports whether the subscription was dropped for falling behind.
+func (s *Subscription) Evicted() bool {
+	return s.evicted.Load()
+}
+
+func (s *Subscription) wants(e Event) bool {
+	return s.all || (e.Domain == s.domain && e.Code == s.code)
+}
+
+// Broker is an in-process publish/subscribe hub. It is safe for concurrent
+// use.
+type Broker struct {
+	opts Options
+
+	mu      sync.Mutex
+	closed  bool
+	subs    map[*Subscription]struct{}
+	seq     uint64
+	evicted atomic.Int64
+}
+
+// NewBroker returns a broker without subscribers.
+func NewBroker(opts Options) *Broker {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	return &Broker{opts: opts, subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to the events of the link code on
+// domain, the stored domain.
+func (b *Broker) Subscribe(domain, code string) (*Subscription, error) {
+	return b.subscribe(&Subscription{domain: domain, code: code})
+}
+
+// SubscribeAll returns a subscription to the events of every link.
+func (b *Broker) SubscribeAll() (*Subscription, error) {
+	return b.subscribe(&Subscription{all: true})
+}
+
+func (b *Broker) subscribe(s *Subscription) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.opts.MaxSubscribers > 0 && len(b.subs) >= b.opts.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	s.events = make(chan Event, b.opts.Buffer)
+	b.subs[s] = struct{}{}
+	return s, nil
+}
+
+// Unsubscribe cancels s. Cancelling it again, or after it was evicted, is
+// a no-op.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+// remove closes the events of s; b.mu must be held.
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.events)
+	}
+}
+
+// Publish numbers e and delivers it to the subscribers that want it,
+// evicting those whose buffer is full. It never blocks.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	e.ID = b.seq
+	for s := range b.subs {
+		if !s.wants(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			s.evicted.Store(true)
+			b.evicted.Add(1)
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Evicted returns the number of subscriptions evicted for falling behind.
+func (b *Broker) Evicted() int64 {
+	return b.evicted.Load()
+}
+
+// Close ends every subscription and stops accepting new ones, so that
+// streams finish before the server shuts down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.remove(s)
+	}
+}
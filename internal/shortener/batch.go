@@ -0,0 +1,134 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBatchAborted marks items of an all-or-nothing batch that were not
+// created because another item failed.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// BatchStore is implemented by stores that can create many links at once.
+type BatchStore interface {
+	// CreateBatch creates links in a single transaction and returns one
+	// error per link. Links that were created get their timestamps filled
+	// in. With atomic set, either all links are created or none.
+	CreateBatch(ctx context.Context, links []Link, atomic bool) ([]error, error)
+}
+
+// BatchItem is a single request of a batch.
+type BatchItem struct {
+	LongURL string
+	ShortenOptions
+}
+
+// BatchResult is the outcome of a single batch item.
+type BatchResult struct {
+	Link Link
+	Err  error
+}
+
+// ShortenBatch creates a short link for each item. Items fail
+// independently unless atomic is set, in which case either every item
+// succeeds or no link is created and the items that would have succeeded
+// report ErrBatchAborted. The returned error is only set when the store
+// failed as a whole.
+func (s *Service) ShortenBatch(ctx context.Context, items []BatchItem, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(items))
+	drafts := make([]*draft, len(items))
+	pending := make([]int, 0, len(items))
+	failed := false
+	for i, it := range items {
+		d, err := s.newDraft(ctx, it.LongURL, it.ShortenOptions)
+		if err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		drafts[i] = d
+		pending = append(pending, i)
+	}
+
+	for len(pending) > 0 && !(atomic && failed) {
+		links := make([]Link, 0, len(pending))
+		submitted := make([]int, 0, len(pending))
+		for _, i := range pending {
+			if err := s.nextCode(ctx, drafts[i]); err != nil {
+				results[i].Err = err
+				failed = true
+				continue
+			}
+			links = append(links, drafts[i].link)
+			submitted = append(submitted, i)
+		}
+		if atomic && failed {
+			break
+		}
+		errs, err := s.createBatch(ctx, links, atomic)
+		if err != nil {
+			return nil, err
+		}
+		// An atomic batch with any error was rolled back: links without an
+		// error of their own are submitted again unchanged.
+		committed := true
+		if atomic {
+			for _, err := range errs {
+				committed = committed && err == nil
+			}
+		}
+
+		pending = pending[:0]
+		for j, i := range submitted {
+			if errs[j] == nil && !committed {
+				pending = append(pending, i)
+				continue
+			}
+			drafts[i].link = links[j]
+			done, l, err := s.settle(ctx, drafts[i], errs[j])
+			switch {
+			case !done:
+				pending = append(pending, i)
+			case err != nil:
+				results[i].Err = err
+				failed = true
+			default:
+				results[i].Link = l
+			}
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = BatchResult{Err: ErrBatchAborted}
+			}
+		}
+	}
+	return results, nil
+}
+
+// createBatch creates links through the store's BatchStore implementation,
+// or one by one when it has none.
+func (s *Service) createBatch(ctx context.Context, links []Link, atomic bool) ([]error, error) {
+	if bs, ok := s.store.(BatchStore); ok {
+		return bs.CreateBatch(ctx, links, atomic)
+	}
+	errs := make([]error, len(links))
+	failed := false
+	for i, l := range links {
+		errs[i] = s.store.Create(ctx, l)
+		failed = failed || errs[i] != nil
+	}
+	if atomic && failed {
+		// Undo the links that were created.
+		for i, l := range links {
+			if errs[i] == nil {
+				if err := s.store.Delete(ctx, l.Domain, l.Code); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,38 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrCaseCollision indicates existing codes that become ambiguous when case
+// is ignored.
+var ErrCaseCollision = errors.New("codes collide when case is ignored")
+
+// CodeCollision lists codes of a domain sharing a case-insensitive lookup
+// key.
+type CodeCollision struct {
+	Domain string   `json:"domain,omitempty"`
+	Key    string   `json:"key"`
+	Codes  []string `json:"codes"`
+}
+
+// CaseInsensitiveStore is implemented by stores that can match codes
+// case-insensitively.
+type CaseInsensitiveStore interface {
+	// SetCaseInsensitive switches how lookup keys are derived from codes.
+	SetCaseInsensitive(enabled bool)
+	// MigrateCodeKeys rewrites the lookup keys of existing links for the
+	// current mode. If codes would collide it changes nothing and returns
+	// the collisions along with ErrCaseCollision.
+	MigrateCodeKeys(ctx context.Context) ([]CodeCollision, error)
+}
+
+// LookupKey returns the key a code is stored and matched under.
+func LookupKey(code string, foldCase bool) string {
+	if foldCase {
+		return strings.ToLower(code)
+	}
+	return code
+}
@@ -0,0 +1,44 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// ErrUnknownDomain indicates a domain that is not served by this deployment.
+var ErrUnknownDomain = errors.New("unknown domain")
+
+// Domains reports which hosts are served as their own code namespace.
+type Domains interface {
+	Served(ctx context.Context, host string) (bool, error)
+}
+
+// StaticDomains serves a fixed set of hosts.
+type StaticDomains map[string]bool
+
+// NewStaticDomains creates StaticDomains from a list of host names.
+func NewStaticDomains(hosts []string) StaticDomains {
+	d := make(StaticDomains, len(hosts))
+	for _, h := range hosts {
+		if h = NormalizeHost(h); h != "" {
+			d[h] = true
+		}
+	}
+	return d
+}
+
+// Served reports whether host is in the set.
+func (d StaticDomains) Served(ctx context.Context, host string) (bool, error) {
+	return d[host], nil
+}
+
+// NormalizeHost lowercases a host name and strips any port and trailing dot.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
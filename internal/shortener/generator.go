@@ -0,0 +1,147 @@
+package shortener
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"tinygo/pkg/feistel"
+	"tinygo/pkg/random"
+)
+
+// Code generation strategies.
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategyHash       = "hash"
+	StrategyWords      = "words"
+)
+
+// Generator produces candidate codes for new links. Candidates may still
+// collide with existing codes; Service retries on conflict, passing the
+// number of candidates rejected so far as attempt.
+type Generator interface {
+	Generate(ctx context.Context, longURL string, attempt int) (string, error)
+}
+
+// Deterministic is implemented by generators whose codes depend only on the
+// URL. When such a code is already taken by the same URL, Service returns
+// the existing link instead of retrying.
+type Deterministic interface {
+	Deterministic() bool
+}
+
+// GeneratorFunc adapts a function to the Generator interface.
+type GeneratorFunc func(ctx context.Context, longURL string, attempt int) (string, error)
+
+// Generate calls f.
+func (f GeneratorFunc) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	return f(ctx, longURL, attempt)
+}
+
+// Sequencer is implemented by stores that hand out monotonic sequence
+// numbers. Every call returns a number never returned before.
+type Sequencer interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+// sequentialGenerator derives codes from a store sequence with a keyed
+// permutation, so codes never collide and are as short as possible.
+type sequentialGenerator struct {
+	seq   Sequencer
+	codec *feistel.Codec
+}
+
+// NewSequentialGenerator creates a Generator that obfuscates sequence numbers
+// from seq with codec.
+func NewSequentialGenerator(seq Sequencer, codec *feistel.Codec) Generator {
+	return &sequentialGenerator{seq: seq, codec: codec}
+}
+
+func (g *sequentialGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	n, err := g.seq.NextSequence(ctx)
+	if err != nil {
+		return "", fmt.Errorf("next sequence: %w", err)
+	}
+	return g.codec.Encode(n), nil
+}
+
+// hashGenerator derives codes from a keyed hash of the canonical URL, so the
+// same URL maps to the same code in every environment sharing the key.
+type hashGenerator struct {
+	key      []byte
+	alphabet random.Alphabet
+	length   int
+}
+
+// NewHashGenerator creates a Generator producing length-character codes from
+// an HMAC of the canonical URL. Each further attempt extends the code by one
+// character, so collisions resolve the same way everywhere.
+func NewHashGenerator(key []byte, alphabet random.Alphabet, length int) Generator {
+	return &hashGenerator{key: key, alphabet: alphabet, length: length}
+}
+
+func (g *hashGenerator) Deterministic() bool { return true }
+
+func (g *hashGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	canonical, err := CanonicalURL(longURL)
+	if err != nil {
+		return "", err
+	}
+	length := g.length + attempt
+	if length > maxCodeLength {
+		return "", fmt.Errorf("hash code exceeds %d characters", maxCodeLength)
+	}
+
+	// Draw characters from an HMAC stream in counter mode, discarding bytes
+	// that would bias the modulo. Earlier characters never depend on length,
+	// so longer codes extend shorter ones.
+	n := g.alphabet.Len()
+	limit := 256 - 256%n
+	chars := g.alphabet.Chars()
+	out := make([]byte, 0, length)
+	mac := hmac.New(sha256.New, g.key)
+	var block [8]byte
+	for counter := uint64(0); len(out) < length; counter++ {
+		mac.Reset()
+		binary.BigEndian.PutUint64(block[:], counter)
+		_, _ = mac.Write(block[:])
+		_, _ = mac.Write([]byte(canonical))
+		for _, b := range mac.Sum(nil) {
+			if int(b) >= limit {
+				continue
+			}
+			out = append(out, chars[int(b)%n])
+			if len(out) == length {
+				break
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// wordsGenerator produces pronounceable codes like "brave-otter-42".
+type wordsGenerator struct {
+	opts random.WordOptions
+}
+
+// NewWordsGenerator creates a Generator producing word-based codes. Every
+// second retry adds a digit to the suffix to widen the keyspace.
+func NewWordsGenerator(opts random.WordOptions) Generator {
+	return &wordsGenerator{opts: opts}
+}
+
+func (g *wordsGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	opts := g.opts
+	for extra := attempt / 2; extra > 0; extra-- {
+		widened := opts
+		widened.Digits++
+		if widened.MaxLength() > maxCodeLength {
+			break
+		}
+		opts = widened
+	}
+	return random.Words(opts)
+}
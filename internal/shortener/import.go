@@ -0,0 +1,139 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrConflictPolicy indicates an unknown import conflict policy.
+var ErrConflictPolicy = errors.New("unknown conflict policy")
+
+// ConflictPolicy decides what happens to an imported link whose code is
+// already taken.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing link.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing link with the imported one.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename imports the link under a newly generated code.
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ParseConflictPolicy returns the policy named s; empty means skip.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrConflictPolicy, s)
+	}
+}
+
+// ImportOutcome is what importing a single link did.
+type ImportOutcome string
+
+const (
+	ImportCreated     ImportOutcome = "created"
+	ImportSkipped     ImportOutcome = "skipped"
+	ImportOverwritten ImportOutcome = "overwritten"
+	ImportRenamed     ImportOutcome = "renamed"
+)
+
+// Import stores a link exported elsewhere, keeping its code, stats and
+// timestamps. Conflicts with existing codes are resolved by policy. With
+// dryRun set the link is only validated and checked for conflicts; renamed
+// links then have no code yet.
+func (s *Service) Import(ctx context.Context, l Link, policy ConflictPolicy, dryRun bool) (Link, ImportOutcome, error) {
+	if !isValidURL(l.LongURL) {
+		return Link{}, "", ErrInvalidURL
+	}
+	if !s.codeRegexp.MatchString(l.Code) {
+		return Link{}, "", fmt.Errorf("%w: %q", ErrInvalidCode, l.Code)
+	}
+	if s.filter.BlockedToken(l.Code) {
+		return Link{}, "", fmt.Errorf("%w: %q", ErrBlockedCode, l.Code)
+	}
+	l.ID = 0
+	l.Domain = s.namespace(l.Domain)
+	if l.Domain != "" {
+		ok := false
+		if s.domains != nil {
+			var err error
+			if ok, err = s.domains.Served(ctx, l.Domain); err != nil {
+				return Link{}, "", err
+			}
+		}
+		if !ok {
+			return Link{}, "", fmt.Errorf("%w: %s", ErrUnknownDomain, l.Domain)
+		}
+	}
+
+	_, exists, err := s.store.Get(ctx, l.Domain, l.Code)
+	if err != nil {
+		return Link{}, "", err
+	}
+	if !exists {
+		if !dryRun {
+			if err := s.store.Create(ctx, l); err != nil {
+				return Link{}, "", err
+			}
+			s.created()
+		}
+		return l, ImportCreated, nil
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return l, ImportSkipped, nil
+	case ConflictOverwrite:
+		if !dryRun {
+			if err := s.store.Update(ctx, l); err != nil {
+				return Link{}, "", err
+			}
+		}
+		return l, ImportOverwritten, nil
+	case ConflictRename:
+		if dryRun {
+			l.Code = ""
+			return l, ImportRenamed, nil
+		}
+		d, err := s.newDraft(ctx, l.LongURL, ShortenOptions{Domain: l.Domain})
+		if err != nil {
+			return Link{}, "", err
+		}
+		d.link = l
+		for {
+			if err := s.nextCode(ctx, d); err != nil {
+				return Link{}, "", err
+			}
+			if done, renamed, err := s.settle(ctx, d, s.store.Create(ctx, d.link)); done {
+				return renamed, ImportRenamed, err
+			}
+		}
+	default:
+		return Link{}, "", fmt.Errorf("%w: %s", ErrConflictPolicy, policy)
+	}
+}
+
+// Walk visits all links, streaming them from the store when it supports
+// it.
+func (s *Service) Walk(ctx context.Context, fn func(Link) error) error {
+	if w, ok := s.store.(Walker); ok {
+		return w.Walk(ctx, fn)
+	}
+	links, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
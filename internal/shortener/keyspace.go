@@ -0,0 +1,159 @@
+package shortener
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// AdaptiveLength configures automatic growth of the random code length.
+type AdaptiveLength struct {
+	// GrowAfterRetries grows the length once a create needs at least this
+	// many retries. Zero disables growth.
+	GrowAfterRetries int
+	// MaxLength caps the grown length.
+	MaxLength int
+	// MaxUtilization is the share of the current keyspace that may be in
+	// use before the length grows. Utilization follows the stored links,
+	// counted by Calibrate, so it carries over restarts.
+	MaxUtilization float64
+}
+
+// KeyspaceStats describes how crowded the code keyspace is.
+type KeyspaceStats struct {
+	Strategy      string  `json:"strategy"`
+	Alphabet      string  `json:"alphabet"`
+	AlphabetSize  int     `json:"alphabet_size"`
+	CodeLength    int     `json:"code_length"`
+	MaxLength     int     `json:"max_length,omitempty"`
+	Keyspace      float64 `json:"keyspace"`
+	Links         int64   `json:"links"`
+	Utilization   float64 `json:"utilization"`
+	Attempts      int64   `json:"attempts"`
+	Collisions    int64   `json:"collisions"`
+	CollisionRate float64 `json:"collision_rate"`
+	Exhausted     int64   `json:"exhausted"`
+	Grown         int64   `json:"grown"`
+}
+
+// codeStats counts create attempts since startup.
+type codeStats struct {
+	mu         sync.Mutex
+	attempts   int64
+	collisions int64
+	exhausted  int64
+	grown      int64
+}
+
+func (c *codeStats) attempt(collision bool) {
+	c.mu.Lock()
+	c.attempts++
+	if collision {
+		c.collisions++
+	}
+	c.mu.Unlock()
+}
+
+func (c *codeStats) exhaust() {
+	c.mu.Lock()
+	c.exhausted++
+	c.mu.Unlock()
+}
+
+// SetAdaptiveLength enables automatic growth of the random code length.
+func (s *Service) SetAdaptiveLength(a AdaptiveLength) {
+	if a.MaxLength <= 0 || a.MaxLength > maxCodeLength {
+		a.MaxLength = maxCodeLength
+	}
+	s.adaptive = a
+}
+
+// growLength increases the code length by one if it is still from. It
+// reports whether the length is now longer than from.
+func (s *Service) growLength(from int) bool {
+	if from >= s.adaptive.MaxLength {
+		return false
+	}
+	if s.codeLength.CompareAndSwap(int64(from), int64(from+1)) {
+		s.stats.mu.Lock()
+		s.stats.grown++
+		s.stats.mu.Unlock()
+		return true
+	}
+	return s.CodeLength() > from
+}
+
+// Calibrate counts the stored links and grows the code length until the
+// share of the keyspace in use is below MaxUtilization. Creates keep the
+// count and grow the length further as the keyspace fills up, so a
+// restarted server picks up where adaptive growth left off.
+func (s *Service) Calibrate(ctx context.Context) error {
+	if s.adaptive.GrowAfterRetries <= 0 || s.adaptive.MaxUtilization <= 0 {
+		return nil
+	}
+	n, err := s.store.Count(ctx)
+	if err != nil {
+		return err
+	}
+	s.links.Store(n)
+	s.counted.Store(true)
+	for s.crowded() {
+		// Each pass grows the length by one
+	}
+	return nil
+}
+
+// created counts a new link and grows the code length once the links fill
+// more than MaxUtilization of the keyspace.
+func (s *Service) created() {
+	s.links.Add(1)
+	if s.counted.Load() {
+		s.crowded()
+	}
+}
+
+// crowded grows the code length by one if the links fill more than
+// MaxUtilization of its keyspace, and reports whether it did.
+func (s *Service) crowded() bool {
+	length := s.CodeLength()
+	return float64(s.links.Load())/s.keyspace(length) > s.adaptive.MaxUtilization && s.growLength(length)
+}
+
+// KeyspaceStats reports keyspace utilization and collision counters.
+// Utilization counts all links against the current keyspace, so it is an
+// upper bound when links of other lengths exist.
+func (s *Service) KeyspaceStats(ctx context.Context) (KeyspaceStats, error) {
+	n, err := s.store.Count(ctx)
+	if err != nil {
+		return KeyspaceStats{}, err
+	}
+	length := s.CodeLength()
+	ks := KeyspaceStats{
+		Strategy:     s.strategy,
+		Alphabet:     s.alphabet.Name(),
+		AlphabetSize: s.alphabet.Len(),
+		CodeLength:   length,
+		Keyspace:     s.keyspace(length),
+		Links:        n,
+	}
+	if s.adaptive.GrowAfterRetries > 0 {
+		ks.MaxLength = s.adaptive.MaxLength
+	}
+	ks.Utilization = float64(n) / ks.Keyspace
+
+	s.stats.mu.Lock()
+	ks.Attempts = s.stats.attempts
+	ks.Collisions = s.stats.collisions
+	ks.Exhausted = s.stats.exhausted
+	ks.Grown = s.stats.grown
+	s.stats.mu.Unlock()
+	if ks.Attempts > 0 {
+		ks.CollisionRate = float64(ks.Collisions) / float64(ks.Attempts)
+	}
+	return ks, nil
+}
+
+// keyspace returns the number of distinct random codes of the given length.
+func (s *Service) keyspace(length int) float64 {
+	return math.Pow(float64(s.alphabet.Len()), float64(length))
+}
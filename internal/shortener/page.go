@@ -0,0 +1,119 @@
+package shortener
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrPageOrder is returned for an unknown page ordering.
+var ErrPageOrder = errors.New("unknown page order")
+
+// PageOrder is the field links of a page are sorted by.
+type PageOrder string
+
+const (
+	OrderCreated PageOrder = "created_at"
+	OrderCode    PageOrder = "code"
+	OrderURL     PageOrder = "long_url"
+	OrderTitle   PageOrder = "title"
+	OrderHits    PageOrder = "hit_count"
+)
+
+// PageQuery selects one page of links.
+type PageQuery struct {
+	// Search keeps links whose code, URL or title contains it, ignoring case.
+	Search string
+	// OrderBy defaults to OrderCreated.
+	OrderBy PageOrder
+	Desc    bool
+	Offset  int
+	// Limit caps the page size; zero or less returns all remaining links.
+	Limit int
+}
+
+// Pager is implemented by stores that can filter, sort and slice links
+// without loading all of them. Page returns the page and the number of
+// links matching the query in total.
+type Pager interface {
+	Page(ctx context.Context, q PageQuery) ([]Link, int64, error)
+}
+
+// Page returns one page of links and the total number of matching links.
+func (s *Service) Page(ctx context.Context, q PageQuery) ([]Link, int64, error) {
+	switch q.OrderBy {
+	case "":
+		q.OrderBy = OrderCreated
+	case OrderCreated, OrderCode, OrderURL, OrderTitle, OrderHits:
+	default:
+		return nil, 0, fmt.Errorf("%w: %s", ErrPageOrder, q.OrderBy)
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	if p, ok := s.store.(Pager); ok {
+		return p.Page(ctx, q)
+	}
+
+	links, err := s.store.List(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Search != "" {
+		term := strings.ToLower(q.Search)
+		matched := links[:0]
+		for _, l := range links {
+			if strings.Contains(strings.ToLower(l.Code), term) ||
+				strings.Contains(strings.ToLower(l.LongURL), term) ||
+				strings.Contains(strings.ToLower(l.Title), term) {
+				matched = append(matched, l)
+			}
+		}
+		links = matched
+	}
+	less := pageLess(q.OrderBy)
+	sort.SliceStable(links, func(i, j int) bool {
+		if q.Desc {
+			return less(links[j], links[i])
+		}
+		return less(links[i], links[j])
+	})
+	total := int64(len(links))
+	if q.Offset >= len(links) {
+		return []Link{}, total, nil
+	}
+	links = links[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(links) {
+		links = links[:q.Limit]
+	}
+	return links, total, nil
+}
+
+// pageLess orders links by the given field, then by ID and code.
+func pageLess(order PageOrder) func(a, b Link) bool {
+	var by func(a, b Link) int
+	switch order {
+	case OrderCode:
+		by = func(a, b Link) int { return strings.Compare(a.Code, b.Code) }
+	case OrderURL:
+		by = func(a, b Link) int { return strings.Compare(a.LongURL, b.LongURL) }
+	case OrderTitle:
+		by = func(a, b Link) int { return strings.Compare(a.Title, b.Title) }
+	case OrderHits:
+		by = func(a, b Link) int { return cmp.Compare(a.HitCount, b.HitCount) }
+	default:
+		by = func(a, b Link) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	}
+	return func(a, b Link) bool {
+		if c := by(a, b); c != 0 {
+			return c < 0
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Code < b.Code
+	}
+}
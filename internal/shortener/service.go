@@ -6,92 +6,391 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"tinygo/pkg/random"
+	"tinygo/pkg/wordfilter"
+)
+
+// Custom codes may use the alphabet characters plus these separators.
+const (
+	customCodeExtra = "_-"
+	minCodeLength   = 3
+	maxCodeLength   = 32
 )
 
 var (
-	codeRegexp     = regexp.MustCompile(`^[0-9A-Za-z_-]{3,32}$`)
 	ErrInvalidURL  = errors.New("invalid url")
 	ErrInvalidCode = errors.New("invalid code")
+	ErrBlockedCode = errors.New("code contains a blocked word")
+	ErrStrategy    = errors.New("unknown code strategy")
+	ErrCodeExists  = errors.New("code already exists")
+	ErrExhausted   = errors.New("exceeded retries to create short link")
 )
 
+// maxFilterAttempts bounds how many generated codes may be rejected by the
+// word filter before giving up.
+const maxFilterAttempts = 100
+
 // Service contains business logic for creating and resolving short links.
 type Service struct {
 	store      Store
-	codeLength int
+	codeLength atomic.Int64
+	autoLength bool
+	alphabet   random.Alphabet
+	codeRegexp *regexp.Regexp
 	baseURL    string
+	baseHost   string
+	domains    Domains
 	maxRetry   int
+	filter     *wordfilter.Filter
+	generators map[string]Generator
+	strategy   string
+	adaptive   AdaptiveLength
+	stats      codeStats
+	// links counts the stored links from Calibrate on; zero until then
+	links   atomic.Int64
+	counted atomic.Bool
 }
 
-// NewService creates a shortener Service.
+// NewService creates a shortener Service generating base62 codes.
+// A codeLength of zero derives the length from the alphabet.
 func NewService(store Store, baseURL string, codeLength int) *Service {
-	return &Service{
+	s := &Service{
 		store:      store,
-		codeLength: codeLength,
+		autoLength: codeLength <= 0,
 		baseURL:    baseURL,
+		baseHost:   hostOf(baseURL),
 		maxRetry:   5,
+		generators: make(map[string]Generator),
+		strategy:   StrategyRandom,
+	}
+	s.codeLength.Store(int64(codeLength))
+	s.SetAlphabet(random.Base62)
+	s.RegisterGenerator(StrategyRandom, GeneratorFunc(s.randomCode))
+	s.RegisterGenerator(StrategyWords, NewWordsGenerator(random.DefaultWordOptions()))
+	return s
+}
+
+// RegisterGenerator makes a code generation strategy available under name.
+func (s *Service) RegisterGenerator(name string, g Generator) {
+	s.generators[name] = g
+}
+
+// SetStrategy selects the registered strategy used for generated codes.
+func (s *Service) SetStrategy(name string) error {
+	if _, ok := s.generators[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrStrategy, name)
+	}
+	s.strategy = name
+	return nil
+}
+
+// SetAlphabet sets the alphabet generated codes are drawn from. Custom code
+// validation follows the alphabet, and when the code length was not set
+// explicitly it is derived from the alphabet as well.
+func (s *Service) SetAlphabet(a random.Alphabet) {
+	s.alphabet = a
+	s.codeRegexp = a.Pattern(customCodeExtra, minCodeLength, maxCodeLength)
+	if s.autoLength {
+		s.codeLength.Store(int64(a.DefaultLength()))
+	}
+}
+
+// CodeLength returns the length of generated codes.
+func (s *Service) CodeLength() int {
+	return int(s.codeLength.Load())
+}
+
+// SetFilter sets the word filter applied to generated and custom codes.
+// A nil filter disables filtering.
+func (s *Service) SetFilter(f *wordfilter.Filter) {
+	s.filter = f
+}
+
+// SetDomains sets the extra domains served besides the BaseURL host. Each
+// domain is its own code namespace.
+func (s *Service) SetDomains(d Domains) {
+	s.domains = d
+}
+
+// DomainForHost maps a request host to the domain namespace it serves. The
+// BaseURL host and hosts that are not served map to the default namespace.
+func (s *Service) DomainForHost(ctx context.Context, host string) (string, error) {
+	host = s.namespace(host)
+	if host == "" || s.domains == nil {
+		return "", nil
+	}
+	ok, err := s.domains.Served(ctx, host)
+	if err != nil || !ok {
+		return "", err
 	}
+	return host, nil
+}
+
+// namespace normalizes a domain name, mapping the BaseURL host to the
+// default namespace.
+func (s *Service) namespace(domain string) string {
+	domain = NormalizeHost(domain)
+	if domain == s.baseHost {
+		return ""
+	}
+	return domain
+}
+
+// ShortenOptions customizes a single Shorten call.
+type ShortenOptions struct {
+	// Domain is the served domain the code belongs to; empty uses the
+	// BaseURL host.
+	Domain string
+	// CustomCode is used verbatim instead of a generated code.
+	CustomCode string
+	// Strategy selects a registered generator; empty uses the default.
+	Strategy string
+	// Title is an optional human-readable name for the link.
+	Title string
 }
 
 // Shorten creates a short link optionally with a custom code.
 func (s *Service) Shorten(ctx context.Context, longURL, customCode string) (Link, error) {
+	return s.ShortenWith(ctx, longURL, ShortenOptions{CustomCode: customCode})
+}
+
+// ShortenWith creates a short link using the given options.
+func (s *Service) ShortenWith(ctx context.Context, longURL string, opts ShortenOptions) (Link, error) {
+	d, err := s.newDraft(ctx, longURL, opts)
+	if err != nil {
+		return Link{}, err
+	}
+	for {
+		if err := s.nextCode(ctx, d); err != nil {
+			return Link{}, err
+		}
+		if done, l, err := s.settle(ctx, d, s.store.Create(ctx, d.link)); done {
+			return l, err
+		}
+	}
+}
+
+// draft is a link being created together with its code generation state.
+type draft struct {
+	link          Link
+	custom        bool
+	gen           Generator
+	deterministic bool
+	// Only random codes grow; other strategies control their own length.
+	adaptive bool
+	// needCode is set when the link needs a new generated code.
+	needCode bool
+	attempt  int
+	tries    int
+	retries  int
+}
+
+// newDraft validates a shorten request and prepares its draft.
+func (s *Service) newDraft(ctx context.Context, longURL string, opts ShortenOptions) (*draft, error) {
 	if !isValidURL(longURL) {
-		return Link{}, ErrInvalidURL
+		return nil, ErrInvalidURL
 	}
-	var code string
-	if customCode != "" {
-		if !codeRegexp.MatchString(customCode) {
-			return Link{}, ErrInvalidCode
+	domain := s.namespace(opts.Domain)
+	if domain != "" {
+		ok := false
+		if s.domains != nil {
+			var err error
+			if ok, err = s.domains.Served(ctx, domain); err != nil {
+				return nil, err
+			}
 		}
-		code = customCode
-	} else {
-		var err error
-		code, err = random.Code(s.codeLength)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownDomain, domain)
+		}
+	}
+	d := &draft{link: Link{Domain: domain, LongURL: longURL, Title: opts.Title}}
+	if opts.CustomCode != "" {
+		opts.CustomCode = s.alphabet.Normalize(opts.CustomCode)
+		if !s.codeRegexp.MatchString(opts.CustomCode) {
+			return nil, ErrInvalidCode
+		}
+		if s.filter.BlockedToken(opts.CustomCode) {
+			return nil, ErrBlockedCode
+		}
+		d.link.Code = opts.CustomCode
+		d.custom = true
+		return d, nil
+	}
+
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = s.strategy
+	}
+	g, ok := s.generators[strategy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStrategy, strategy)
+	}
+	det, ok := g.(Deterministic)
+	d.gen = g
+	d.deterministic = ok && det.Deterministic()
+	d.adaptive = strategy == StrategyRandom && s.adaptive.GrowAfterRetries > 0
+	d.needCode = true
+	return d, nil
+}
+
+// nextCode generates a new candidate code for d if it needs one.
+func (s *Service) nextCode(ctx context.Context, d *draft) error {
+	if !d.needCode {
+		return nil
+	}
+	code, next, err := s.generate(ctx, d.gen, d.link.LongURL, d.attempt)
+	if err != nil {
+		return fmt.Errorf("generate code: %w", err)
+	}
+	d.attempt = next + 1
+	d.link.Code = code
+	d.needCode = false
+	return nil
+}
+
+// settle handles the outcome of creating d's link. It reports whether the
+// draft is finished, with the resulting link or error; otherwise d needs a
+// new code and another create.
+func (s *Service) settle(ctx context.Context, d *draft, err error) (bool, Link, error) {
+	if d.custom {
 		if err != nil {
-			return Link{}, fmt.Errorf("generate code: %w", err)
+			return true, Link{}, err
+		}
+		s.created()
+		return true, d.link, nil
+	}
+	s.stats.attempt(errors.Is(err, ErrCodeExists))
+	if err == nil {
+		if d.adaptive && d.retries >= s.adaptive.GrowAfterRetries {
+			s.growLength(len(d.link.Code))
 		}
+		s.created()
+		return true, d.link, nil
 	}
+	if d.deterministic && errors.Is(err, ErrCodeExists) {
+		// The same URL shortened before resolves to the same link.
+		existing, found, gerr := s.store.Get(ctx, d.link.Domain, d.link.Code)
+		if gerr != nil {
+			return true, Link{}, gerr
+		}
+		if found && sameURL(existing.LongURL, d.link.LongURL) {
+			return true, existing, nil
+		}
+	}
+	// If code exists, retry with a new candidate.
+	d.retries++
+	d.tries++
+	d.needCode = true
+	if d.tries >= s.maxRetry {
+		// Out of retries: grow and give the longer codes a full round.
+		if d.adaptive && s.growLength(len(d.link.Code)) {
+			d.tries, d.retries = 0, 0
+			return false, Link{}, nil
+		}
+		s.stats.exhaust()
+		return true, Link{}, ErrExhausted
+	}
+	return false, Link{}, nil
+}
 
-	l := Link{Code: code, LongURL: longURL}
-	// If code exists, retry generate when not custom.
-	for i := 0; i < s.maxRetry; i++ {
-		if err := s.store.Create(ctx, l); err != nil {
-			if customCode != "" {
-				return Link{}, err
-			}
-			// re-generate and retry
-			c, gerr := random.Code(s.codeLength)
-			if gerr != nil {
-				return Link{}, fmt.Errorf("regenerate code: %w", gerr)
-			}
-			l.Code = c
-			continue
+// generate returns a code from g that passes the word filter, starting at
+// the given attempt. It also returns the attempt the code was produced at.
+func (s *Service) generate(ctx context.Context, g Generator, longURL string, attempt int) (string, int, error) {
+	for i := 0; i < maxFilterAttempts; i++ {
+		code, err := g.Generate(ctx, longURL, attempt)
+		if err != nil {
+			return "", attempt, err
+		}
+		if !s.filter.Blocked(code) {
+			return code, attempt, nil
 		}
-		return l, nil
+		attempt++
 	}
-	return Link{}, fmt.Errorf("exceeded retries to create short link")
+	return "", attempt, ErrBlockedCode
+}
+
+// randomCode draws a code from the configured alphabet and length.
+func (s *Service) randomCode(ctx context.Context, longURL string, attempt int) (string, error) {
+	return s.alphabet.Code(s.CodeLength())
 }
 
-// Resolve returns link by code without mutating stats.
-func (s *Service) Resolve(ctx context.Context, code string) (Link, bool, error) {
-	return s.store.Get(ctx, code)
+// Resolve returns link by domain and code without mutating stats. Codes
+// are looked up in the alphabet's spelling, as custom codes are stored.
+func (s *Service) Resolve(ctx context.Context, domain, code string) (Link, bool, error) {
+	return s.store.Get(ctx, s.namespace(domain), s.alphabet.Normalize(code))
 }
 
 // Hit increments hit counter and returns updated link.
-func (s *Service) Hit(ctx context.Context, code string) (Link, error) {
-	return s.store.IncrementHit(ctx, code)
+func (s *Service) Hit(ctx context.Context, domain, code string) (Link, error) {
+	return s.store.IncrementHit(ctx, s.namespace(domain), s.alphabet.Normalize(code))
+}
+
+// BotHit increments the bot hit counter and returns updated link.
+func (s *Service) BotHit(ctx context.Context, domain, code string) (Link, error) {
+	return s.store.IncrementBotHit(ctx, s.namespace(domain), s.alphabet.Normalize(code))
+}
+
+// AddHits adds redirects counted elsewhere, such as by a hit queue, to
+// their links.
+func (s *Service) AddHits(ctx context.Context, hits []Hits) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	return s.store.AddHits(ctx, hits)
 }
 
 // Delete removes a link.
-func (s *Service) Delete(ctx context.Context, code string) error {
-	return s.store.Delete(ctx, code)
+func (s *Service) Delete(ctx context.Context, domain, code string) error {
+	if err := s.store.Delete(ctx, s.namespace(domain), s.alphabet.Normalize(code)); err != nil {
+		return err
+	}
+	s.links.Add(-1)
+	return nil
 }
 
-// ShortURL builds absolute short URL.
-func (s *Service) ShortURL(code string) string {
-	return fmt.Sprintf("%s/%s", s.baseURL, code)
+// LinkPatch holds the fields Edit changes; nil fields are kept.
+type LinkPatch struct {
+	LongURL *string
+	Title   *string
+}
+
+// Edit changes the destination or title of an existing link. It reports
+// false if the link does not exist.
+func (s *Service) Edit(ctx context.Context, domain, code string, p LinkPatch) (Link, bool, error) {
+	if p.LongURL != nil && !isValidURL(*p.LongURL) {
+		return Link{}, false, ErrInvalidURL
+	}
+	l, ok, err := s.Resolve(ctx, domain, code)
+	if err != nil || !ok {
+		return Link{}, ok, err
+	}
+	if p.LongURL != nil {
+		l.LongURL = *p.LongURL
+	}
+	if p.Title != nil {
+		l.Title = *p.Title
+	}
+	if err := s.store.UpdateDetails(ctx, l); err != nil {
+		return Link{}, false, err
+	}
+	// Read back the stats counted meanwhile.
+	return s.Resolve(ctx, domain, code)
+}
+
+// ShortURL builds the absolute short URL of a link on its own domain.
+func (s *Service) ShortURL(l Link) string {
+	if l.Domain == "" {
+		return fmt.Sprintf("%s/%s", s.baseURL, l.Code)
+	}
+	scheme := "https"
+	if u, err := url.Parse(s.baseURL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, l.Domain, l.Code)
 }
 
 // List returns all links.
@@ -99,6 +398,36 @@ func (s *Service) List(ctx context.Context) ([]Link, error) {
 	return s.store.List(ctx)
 }
 
+// Totals returns the number of links and the sum of their hits.
+func (s *Service) Totals(ctx context.Context) (links, hits int64, err error) {
+	err = s.Walk(ctx, func(l Link) error {
+		links++
+		hits += l.HitCount
+		return nil
+	})
+	return links, hits, err
+}
+
+// SplitShortURL maps a short URL, with or without scheme, to the domain
+// namespace and code it refers to. A bare code maps to the default domain.
+func (s *Service) SplitShortURL(ctx context.Context, raw string) (domain, code string, err error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "/") {
+		return "", raw, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if domain, err = s.DomainForHost(ctx, u.Host); err != nil {
+		return "", "", err
+	}
+	return domain, strings.Trim(u.Path, "/"), nil
+}
+
 func isValidURL(raw string) bool {
 	u, err := url.Parse(raw)
 	if err != nil {
@@ -113,5 +442,58 @@ func isValidURL(raw string) bool {
 	return true
 }
 
+// hostOf returns the normalized host of a URL.
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return NormalizeHost(u.Host)
+}
+
+// CanonicalURL normalizes a URL so that equivalent spellings compare equal:
+// scheme and host are lowercased, default ports dropped, an empty path
+// becomes "/" and query parameters are sorted.
+func CanonicalURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// sameURL reports whether a and b are equal after canonicalization.
+func sameURL(a, b string) bool {
+	ca, err := CanonicalURL(a)
+	if err != nil {
+		return false
+	}
+	cb, err := CanonicalURL(b)
+	if err != nil {
+		return false
+	}
+	return ca == cb
+}
+
 // Now is extracted for testing override when needed.
 var Now = func() time.Time { return time.Now() }
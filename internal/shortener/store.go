@@ -2,13 +2,47 @@ package shortener
 
 import (
 	"context"
+	"time"
 )
 
-// Store defines persistence behaviors for Link records.
+// Store defines persistence behaviors for Link records. Links are addressed
+// by domain and code; the empty domain is the default one.
 type Store interface {
 	Create(ctx context.Context, l Link) error
-	Get(ctx context.Context, code string) (Link, bool, error)
-	Delete(ctx context.Context, code string) error
-	IncrementHit(ctx context.Context, code string) (Link, error)
+	Get(ctx context.Context, domain, code string) (Link, bool, error)
+	Delete(ctx context.Context, domain, code string) error
+	IncrementHit(ctx context.Context, domain, code string) (Link, error)
+	// IncrementBotHit counts a bot redirect; it leaves the hit count and
+	// last access time alone.
+	IncrementBotHit(ctx context.Context, domain, code string) (Link, error)
+	// AddHits adds counted redirects to their links in one write. Links
+	// that no longer exist are skipped.
+	AddHits(ctx context.Context, hits []Hits) error
+	// Update replaces the URL, title, stats and timestamps of an existing
+	// link, as imports overwriting it do.
+	Update(ctx context.Context, l Link) error
+	// UpdateDetails changes the URL and title of an existing link, leaving
+	// its stats to the hits counted meanwhile.
+	UpdateDetails(ctx context.Context, l Link) error
 	List(ctx context.Context) ([]Link, error)
+	Count(ctx context.Context) (int64, error)
+}
+
+// Walker is implemented by stores that can stream all links without loading
+// them into memory at once. Links are visited in creation order; a non-nil
+// error from fn stops the walk and is returned.
+type Walker interface {
+	Walk(ctx context.Context, fn func(Link) error) error
+}
+
+// Hits is the number of redirects of a link counted since the last write.
+// Domain is the stored domain of the link, empty for the default one.
+type Hits struct {
+	Domain string
+	Code   string
+	Human  int64
+	Bot    int64
+	// LastAccessAt is the time of the last human redirect; it is left
+	// alone when zero.
+	LastAccessAt time.Time
 }
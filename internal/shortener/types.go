@@ -6,15 +6,24 @@ import (
 	"gorm.io/gorm"
 )
 
-// Link represents a shortened URL record.
+// Link represents a shortened URL record. Codes are unique per Domain; the
+// empty domain is the default one served at BaseURL. CodeKey is the
+// normalized key links are looked up by; it equals Code unless codes are
+// resolved case-insensitively.
 type Link struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	Code         string    `gorm:"uniqueIndex;size:32;not null" json:"code"`
+	Domain       string    `gorm:"size:253;not null;default:'';uniqueIndex:idx_links_domain_code,priority:1;uniqueIndex:idx_links_domain_code_key,priority:1" json:"domain,omitempty"`
+	Code         string    `gorm:"size:32;not null;uniqueIndex:idx_links_domain_code,priority:2" json:"code"`
+	CodeKey      *string   `gorm:"size:32;uniqueIndex:idx_links_domain_code_key,priority:2" json:"-"`
 	LongURL      string    `gorm:"size:2048;not null" json:"long_url"`
+	Title        string    `gorm:"size:512" json:"title,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	HitCount     int64     `gorm:"default:0" json:"hit_count"`
 	LastAccessAt time.Time `json:"last_access_at"`
+	// BotHitCount counts redirects of crawlers and link preview fetchers,
+	// which HitCount leaves out
+	BotHitCount int64 `gorm:"default:0" json:"bot_hit_count"`
 }
 
 // TableName returns the table name for the Link model
@@ -22,6 +31,18 @@ func (Link) TableName() string {
 	return "links"
 }
 
+// Counter is a named monotonic counter, used to hand out sequence numbers
+// for sequential codes.
+type Counter struct {
+	Name  string `gorm:"primaryKey;size:64"`
+	Value uint64 `gorm:"not null;default:0"`
+}
+
+// TableName returns the table name for the Counter model
+func (Counter) TableName() string {
+	return "counters"
+}
+
 // BeforeCreate is a GORM hook that runs before creating a record
 func (l *Link) BeforeCreate(tx *gorm.DB) error {
 	if l.CreatedAt.IsZero() {
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"tinygo/internal/analytics"
+
+	"gorm.io/gorm"
+)
+
+// RecordClicks saves new clicks in a single insert.
+func (s *gormStore) RecordClicks(ctx context.Context, clicks []analytics.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Create(&clicks).Error
+}
+
+// Clicks returns the clicks of a link matching q, newest first.
+func (s *gormStore) Clicks(ctx context.Context, q analytics.Query) ([]analytics.Click, error) {
+	query := s.clickQuery(ctx, q)
+	if q.Before > 0 {
+		query = query.Where("id < ?", q.Before)
+	}
+	if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var clicks []analytics.Click
+	if err := query.Order("id DESC").Find(&clicks).Error; err != nil {
+		return nil, err
+	}
+	return clicks, nil
+}
+
+// CountClicks counts the clicks of a link matching q.
+func (s *gormStore) CountClicks(ctx context.Context, q analytics.Query) (int64, error) {
+	var n int64
+	if err := s.clickQuery(ctx, q).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Breakdown counts the clicks of a link matching q per combination of
+// values of dims, grouped in SQL.
+func (s *gormStore) Breakdown(ctx context.Context, q analytics.Query, dims []analytics.Dimension) ([]analytics.Count, error) {
+	cols := make([]string, len(dims))
+	for i, d := range dims {
+		if !d.Valid() {
+			return nil, fmt.Errorf("%w: %s", analytics.ErrDimension, d)
+		}
+		cols[i] = string(d)
+	}
+	group := strings.Join(cols, ", ")
+	query := s.clickQuery(ctx, q).Select(strings.Join(append(cols, "COUNT(*)"), ", "))
+	if group != "" {
+		query = query.Group(group)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var counts []analytics.Count
+	for rows.Next() {
+		c := analytics.Count{Values: make([]string, len(dims))}
+		dest := make([]any, 0, len(dims)+1)
+		for i := range c.Values {
+			dest = append(dest, &c.Values[i])
+		}
+		if err := rows.Scan(append(dest, &c.Clicks)...); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// clickQuery selects the clicks of q's link within its time range.
+func (s *gormStore) clickQuery(ctx context.Context, q analytics.Query) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&analytics.Click{})
+	if q.Code != "" {
+		query = query.Where("domain = ? AND code = ?", q.Domain, q.Code)
+	}
+	if q.Class != "" {
+		query = query.Where("class = ?", q.Class)
+	}
+	// Times are stored in UTC; SQLite compares them as text.
+	if !q.From.IsZero() {
+		query = query.Where("at >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		query = query.Where("at < ?", q.To.UTC())
+	}
+	return query
+}
+
+// Histogram counts the clicks matching q per step of UTC time, grouped in
+// SQL on the Unix time of the clicks.
+func (s *gormStore) Histogram(ctx context.Context, q analytics.Query, step time.Duration) ([]analytics.Bucket, error) {
+	seconds := int64(step / time.Second)
+	if seconds <= 0 {
+		return nil, fmt.Errorf("invalid histogram step %s", step)
+	}
+	epoch, err := s.epochSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.clickQuery(ctx, q).
+		Select(fmt.Sprintf("%s / %d AS bucket, COUNT(*)", epoch, seconds)).
+		Group("bucket").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var buckets []analytics.Bucket
+	for rows.Next() {
+		var n, clicks int64
+		if err := rows.Scan(&n, &clicks); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, analytics.Bucket{Start: time.Unix(n*seconds, 0).UTC(), Clicks: clicks})
+	}
+	return buckets, rows.Err()
+}
+
+// epochSQL returns the SQL expression of the Unix time of a click.
+func (s *gormStore) epochSQL() (string, error) {
+	switch name := s.db.Dialector.Name(); name {
+	case "sqlite":
+		return "CAST(strftime('%s', at) AS INTEGER)", nil
+	case "postgres":
+		return "CAST(FLOOR(EXTRACT(EPOCH FROM at)) AS BIGINT)", nil
+	default:
+		return "", fmt.Errorf("time grouping not supported on %s", name)
+	}
+}
+
+// RecordClicks saves new clicks, rewriting the data file like every other
+// write; MergeVisitors rewrites it again for the same batch.
+func (s *fileStore) RecordClicks(ctx context.Context, clicks []analytics.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	for i := range clicks {
+		s.clickSeq++
+		clicks[i].ID = s.clickSeq
+		s.clicks = append(s.clicks, clicks[i])
+	}
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// Clicks returns the clicks of a link matching q, newest first.
+func (s *fileStore) Clicks(ctx context.Context, q analytics.Query) ([]analytics.Click, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []analytics.Click
+	skip := q.Offset
+	for i := len(s.clicks) - 1; i >= 0; i-- {
+		c := s.clicks[i]
+		if q.Before > 0 && c.ID >= q.Before || !clickMatches(c, q) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		result = append(result, c)
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// CountClicks counts the clicks of a link matching q.
+func (s *fileStore) CountClicks(ctx context.Context, q analytics.Query) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int64
+	for _, c := range s.clicks {
+		if clickMatches(c, q) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Breakdown counts the clicks of a link matching q per combination of
+// values of dims.
+func (s *fileStore) Breakdown(ctx context.Context, q analytics.Query, dims []analytics.Dimension) ([]analytics.Count, error) {
+	for _, d := range dims {
+		if !d.Valid() {
+			return nil, fmt.Errorf("%w: %s", analytics.ErrDimension, d)
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index := make(map[string]int)
+	var counts []analytics.Count
+	for _, c := range s.clicks {
+		if !clickMatches(c, q) {
+			continue
+		}
+		values := make([]string, len(dims))
+		for i, d := range dims {
+			values[i] = c.Value(d)
+		}
+		key := strings.Join(values, "\x00")
+		if i, ok := index[key]; ok {
+			counts[i].Clicks++
+			continue
+		}
+		index[key] = len(counts)
+		counts = append(counts, analytics.Count{Values: values, Clicks: 1})
+	}
+	return counts, nil
+}
+
+// Histogram counts the clicks matching q per step of UTC time.
+func (s *fileStore) Histogram(ctx context.Context, q analytics.Query, step time.Duration) ([]analytics.Bucket, error) {
+	seconds := int64(step / time.Second)
+	if seconds <= 0 {
+		return nil, fmt.Errorf("invalid histogram step %s", step)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[int64]int64)
+	for _, c := range s.clicks {
+		if clickMatches(c, q) {
+			counts[c.At.Unix()/seconds]++
+		}
+	}
+	buckets := make([]analytics.Bucket, 0, len(counts))
+	for n, clicks := range counts {
+		buckets = append(buckets, analytics.Bucket{Start: time.Unix(n*seconds, 0).UTC(), Clicks: clicks})
+	}
+	return buckets, nil
+}
+
+// clickMatches reports whether c is a click of q's link within its time
+// range.
+func clickMatches(c analytics.Click, q analytics.Query) bool {
+	return (q.Code == "" || c.Domain == q.Domain && c.Code == q.Code) &&
+		(q.Class == "" || c.Class == q.Class) &&
+		(q.From.IsZero() || !c.At.Before(q.From)) &&
+		(q.To.IsZero() || c.At.Before(q.To))
+}
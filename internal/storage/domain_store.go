@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tinygo/internal/domains"
+
+	"gorm.io/gorm"
+)
+
+// CreateDomain saves a new domain. Returns error if the name exists.
+func (s *gormStore) CreateDomain(ctx context.Context, d domains.Domain) (domains.Domain, error) {
+	result := s.db.WithContext(ctx).Create(&d)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return domains.Domain{}, fmt.Errorf("%w: %s", domains.ErrExists, d.Name)
+		}
+		return domains.Domain{}, result.Error
+	}
+	return d, nil
+}
+
+// GetDomain returns a domain by name.
+func (s *gormStore) GetDomain(ctx context.Context, name string) (domains.Domain, bool, error) {
+	var d domains.Domain
+	result := s.db.WithContext(ctx).Where("name = ?", name).First(&d)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return domains.Domain{}, false, nil
+		}
+		return domains.Domain{}, false, result.Error
+	}
+	return d, true, nil
+}
+
+// ListDomains returns all domains ordered by name.
+func (s *gormStore) ListDomains(ctx context.Context) ([]domains.Domain, error) {
+	var ds []domains.Domain
+	result := s.db.WithContext(ctx).Order("name").Find(&ds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return ds, nil
+}
+
+// UpdateDomain saves all fields of an existing domain.
+func (s *gormStore) UpdateDomain(ctx context.Context, d domains.Domain) error {
+	result := s.db.WithContext(ctx).Save(&d)
+	return result.Error
+}
+
+// DeleteDomain removes a domain by name.
+func (s *gormStore) DeleteDomain(ctx context.Context, name string) error {
+	result := s.db.WithContext(ctx).Where("name = ?", name).Delete(&domains.Domain{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domains.ErrNotFound
+	}
+	return nil
+}
+
+// CreateDomain saves a new domain. Returns error if the name exists.
+func (s *fileStore) CreateDomain(ctx context.Context, d domains.Domain) (domains.Domain, error) {
+	s.mu.Lock()
+	if _, ok := s.domains[d.Name]; ok {
+		s.mu.Unlock()
+		return domains.Domain{}, fmt.Errorf("%w: %s", domains.ErrExists, d.Name)
+	}
+	now := time.Now()
+	s.domainSeq++
+	d.ID = uint(s.domainSeq)
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	s.domains[d.Name] = d
+	s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return domains.Domain{}, err
+	}
+	return d, nil
+}
+
+// GetDomain returns a domain by name.
+func (s *fileStore) GetDomain(ctx context.Context, name string) (domains.Domain, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.domains[name]
+	return d, ok, nil
+}
+
+// ListDomains returns all domains ordered by name.
+func (s *fileStore) ListDomains(ctx context.Context) ([]domains.Domain, error) {
+	s.mu.RLock()
+	result := make([]domains.Domain, 0, len(s.domains))
+	for _, d := range s.domains {
+		result = append(result, d)
+	}
+	s.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// UpdateDomain saves all fields of an existing domain.
+func (s *fileStore) UpdateDomain(ctx context.Context, d domains.Domain) error {
+	s.mu.Lock()
+	if _, ok := s.domains[d.Name]; !ok {
+		s.mu.Unlock()
+		return domains.ErrNotFound
+	}
+	d.UpdatedAt = time.Now()
+	s.domains[d.Name] = d
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// DeleteDomain removes a domain by name.
+func (s *fileStore) DeleteDomain(ctx context.Context, name string) error {
+	s.mu.Lock()
+	if _, ok := s.domains[name]; !ok {
+		s.mu.Unlock()
+		return domains.ErrNotFound
+	}
+	delete(s.domains, name)
+	s.mu.Unlock()
+	return s.flush()
+}
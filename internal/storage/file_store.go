@@ -5,31 +5,69 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"tinygo/internal/analytics"
+	"tinygo/internal/domains"
 	"tinygo/internal/shortener"
 )
 
 // ErrNotFound indicates code not exists.
 var ErrNotFound = errors.New("link not found")
 
-// fileStore stores links in memory with write-through JSON file.
+// fileStore stores links in memory with write-through JSON file. Every
+// write rewrites the whole file, so analytics on it, which writes clicks
+// and visitor sketches on each redirect, is for development and tests only.
 type fileStore struct {
-	mu    sync.RWMutex
-	path  string
-	links map[string]shortener.Link
+	mu       sync.RWMutex
+	path     string
+	links    map[string]shortener.Link
+	keys     map[string]string // lookup key -> links key
+	foldCase bool
+	sequence uint64
+
+	domains   map[string]domains.Domain
+	domainSeq uint64
+
+	// clicks are kept in ID order
+	clicks   []analytics.Click
+	clickSeq uint64
+	visitors map[string]analytics.VisitorSketch // domain/code/day -> sketch
+	rollups  map[rollupKey]analytics.Rollup
+	mark     analytics.RollupMark
+	// visitorSecret is nil until first stored
+	visitorSecret []byte
 }
 
 type fileData struct {
-	Links map[string]shortener.Link `json:"links"`
+	Links    map[string]shortener.Link `json:"links"`
+	Sequence uint64                    `json:"sequence,omitempty"`
+	Domains  map[string]domains.Domain `json:"domains,omitempty"`
+	Clicks   []analytics.Click         `json:"clicks,omitempty"`
+	ClickSeq uint64                    `json:"click_sequence,omitempty"`
+	Visitors []analytics.VisitorSketch `json:"visitors,omitempty"`
+	Rollups  []analytics.Rollup        `json:"rollups,omitempty"`
+	Mark     *analytics.RollupMark     `json:"rollup_mark,omitempty"`
+	// VisitorSecret is base64 in JSON
+	VisitorSecret []byte `json:"visitor_secret,omitempty"`
 }
 
 // NewFileStore creates or loads a file-backed store.
 func NewFileStore(path string) (*fileStore, error) {
-	fs := &fileStore{path: path, links: make(map[string]shortener.Link)}
+	fs := &fileStore{
+		path:     path,
+		links:    make(map[string]shortener.Link),
+		keys:     make(map[string]string),
+		domains:  make(map[string]domains.Domain),
+		visitors: make(map[string]analytics.VisitorSketch),
+		rollups:  make(map[rollupKey]analytics.Rollup),
+	}
 	if err := fs.load(); err != nil {
 		return nil, err
 	}
@@ -61,13 +99,49 @@ func (s *fileStore) load() error {
 		fd.Links = make(map[string]shortener.Link)
 	}
 	s.links = fd.Links
+	s.sequence = fd.Sequence
+	if fd.Domains != nil {
+		s.domains = fd.Domains
+	}
+	for _, d := range s.domains {
+		s.domainSeq = max(s.domainSeq, uint64(d.ID))
+	}
+	s.clicks = fd.Clicks
+	s.clickSeq = fd.ClickSeq
+	if n := len(s.clicks); n > 0 {
+		// Files written before the sequence was saved
+		s.clickSeq = max(s.clickSeq, s.clicks[n-1].ID)
+	}
+	s.visitorSecret = fd.VisitorSecret
+	for _, vs := range fd.Visitors {
+		s.visitors[visitorKey(vs.Domain, vs.Code, vs.Day)] = vs
+	}
+	for _, r := range fd.Rollups {
+		s.rollups[keyOf(r)] = r
+	}
+	if fd.Mark != nil {
+		s.mark = *fd.Mark
+	}
+	s.reindex()
 	return nil
 }
 
 func (s *fileStore) flush() error {
 	s.mu.RLock()
-	fd := fileData{Links: s.links}
+	fd := fileData{Links: s.links, Sequence: s.sequence, Domains: s.domains, Clicks: s.clicks, ClickSeq: s.clickSeq, VisitorSecret: s.visitorSecret}
+	for _, vs := range s.visitors {
+		fd.Visitors = append(fd.Visitors, vs)
+	}
+	fd.Rollups = sortedRollups(s.rollups)
+	if !s.mark.RolledUntil.IsZero() {
+		mark := s.mark
+		fd.Mark = &mark
+	}
 	s.mu.RUnlock()
+	sort.Slice(fd.Visitors, func(i, j int) bool {
+		a, b := fd.Visitors[i], fd.Visitors[j]
+		return visitorKey(a.Domain, a.Code, a.Day) < visitorKey(b.Domain, b.Code, b.Day)
+	})
 
 	tmp := s.path + ".tmp"
 	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
@@ -86,54 +160,186 @@ func (s *fileStore) flush() error {
 	return os.Rename(tmp, s.path)
 }
 
+// linkKey returns the map key of a link: its code, prefixed with the domain
+// for links outside the default domain.
+func linkKey(domain, code string) string {
+	if domain == "" {
+		return code
+	}
+	return domain + "/" + code
+}
+
+// lookupKey returns the index key for a domain and code.
+func (s *fileStore) lookupKey(domain, code string) string {
+	return linkKey(domain, shortener.LookupKey(code, s.foldCase))
+}
+
+// reindex rebuilds the lookup key index. Callers must hold the write lock.
+func (s *fileStore) reindex() {
+	s.keys = make(map[string]string, len(s.links))
+	for k, l := range s.links {
+		s.keys[s.lookupKey(l.Domain, l.Code)] = k
+	}
+}
+
+// lookup returns the links key matching domain and code. Callers must hold
+// the lock.
+func (s *fileStore) lookup(domain, code string) (string, bool) {
+	stored, ok := s.keys[s.lookupKey(domain, code)]
+	return stored, ok
+}
+
+// SetCaseInsensitive makes codes match regardless of case.
+func (s *fileStore) SetCaseInsensitive(enabled bool) {
+	s.mu.Lock()
+	s.foldCase = enabled
+	s.reindex()
+	s.mu.Unlock()
+}
+
+// MigrateCodeKeys checks that no codes collide in the current mode and
+// rebuilds the lookup index.
+func (s *fileStore) MigrateCodeKeys(ctx context.Context) ([]shortener.CodeCollision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make(map[string]*shortener.CodeCollision)
+	for _, l := range s.links {
+		key := s.lookupKey(l.Domain, l.Code)
+		g, ok := groups[key]
+		if !ok {
+			g = &shortener.CodeCollision{Domain: l.Domain, Key: shortener.LookupKey(l.Code, s.foldCase)}
+			groups[key] = g
+		}
+		g.Codes = append(g.Codes, l.Code)
+	}
+	var collisions []shortener.CodeCollision
+	for _, g := range groups {
+		if len(g.Codes) > 1 {
+			sort.Strings(g.Codes)
+			collisions = append(collisions, *g)
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Slice(collisions, func(i, j int) bool {
+			if collisions[i].Domain != collisions[j].Domain {
+				return collisions[i].Domain < collisions[j].Domain
+			}
+			return collisions[i].Key < collisions[j].Key
+		})
+		return collisions, shortener.ErrCaseCollision
+	}
+	s.reindex()
+	return nil, nil
+}
+
 // Create saves a new link. Returns error if code exists.
 func (s *fileStore) Create(ctx context.Context, l shortener.Link) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.links[l.Code]; ok {
-		return fmt.Errorf("code already exists: %s", l.Code)
+	if _, ok := s.lookup(l.Domain, l.Code); ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", shortener.ErrCodeExists, l.Code)
 	}
 	now := time.Now()
 	if l.CreatedAt.IsZero() {
 		l.CreatedAt = now
 	}
 	l.UpdatedAt = now
-	s.links[l.Code] = l
+	k := linkKey(l.Domain, l.Code)
+	s.links[k] = l
+	s.keys[s.lookupKey(l.Domain, l.Code)] = k
+	s.mu.Unlock()
 	return s.flush()
 }
 
-// Get returns a link by code.
-func (s *fileStore) Get(ctx context.Context, code string) (shortener.Link, bool, error) {
+// CreateBatch saves links with a single flush. With atomic set, no link is
+// kept if any of them fails.
+func (s *fileStore) CreateBatch(ctx context.Context, links []shortener.Link, atomic bool) ([]error, error) {
+	errs := make([]error, len(links))
+	s.mu.Lock()
+	now := time.Now()
+	var created []int
+	for i, l := range links {
+		if _, ok := s.lookup(l.Domain, l.Code); ok {
+			errs[i] = fmt.Errorf("%w: %s", shortener.ErrCodeExists, l.Code)
+			continue
+		}
+		if l.CreatedAt.IsZero() {
+			l.CreatedAt = now
+		}
+		l.UpdatedAt = now
+		k := linkKey(l.Domain, l.Code)
+		s.links[k] = l
+		s.keys[s.lookupKey(l.Domain, l.Code)] = k
+		links[i] = l
+		created = append(created, i)
+	}
+	if atomic && len(created) < len(links) {
+		for _, i := range created {
+			l := links[i]
+			delete(s.links, linkKey(l.Domain, l.Code))
+			delete(s.keys, s.lookupKey(l.Domain, l.Code))
+		}
+		created = nil
+	}
+	s.mu.Unlock()
+	if len(created) == 0 {
+		return errs, nil
+	}
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// Get returns a link by domain and code.
+func (s *fileStore) Get(ctx context.Context, domain, code string) (shortener.Link, bool, error) {
 	s.mu.RLock()
-	l, ok := s.links[code]
-	s.mu.RUnlock()
-	return l, ok, nil
+	defer s.mu.RUnlock()
+	stored, ok := s.lookup(domain, code)
+	if !ok {
+		return shortener.Link{}, false, nil
+	}
+	return s.links[stored], true, nil
 }
 
-// Delete removes a link by code.
-func (s *fileStore) Delete(ctx context.Context, code string) error {
+// Delete removes a link by domain and code, along with its clicks, visitor
+// sketches and rollups.
+func (s *fileStore) Delete(ctx context.Context, domain, code string) error {
 	s.mu.Lock()
-	if _, ok := s.links[code]; !ok {
+	stored, ok := s.lookup(domain, code)
+	if !ok {
 		s.mu.Unlock()
 		return ErrNotFound
 	}
-	delete(s.links, code)
+	l := s.links[stored]
+	delete(s.links, stored)
+	delete(s.keys, s.lookupKey(domain, code))
+	s.clicks = slices.DeleteFunc(s.clicks, func(c analytics.Click) bool {
+		return c.Domain == l.Domain && c.Code == l.Code
+	})
+	maps.DeleteFunc(s.visitors, func(_ string, vs analytics.VisitorSketch) bool {
+		return vs.Domain == l.Domain && vs.Code == l.Code
+	})
+	maps.DeleteFunc(s.rollups, func(_ rollupKey, r analytics.Rollup) bool {
+		return r.Domain == l.Domain && r.Code == l.Code
+	})
 	s.mu.Unlock()
 	return s.flush()
 }
 
 // IncrementHit increases hit counter and updates last access time.
-func (s *fileStore) IncrementHit(ctx context.Context, code string) (shortener.Link, error) {
+func (s *fileStore) IncrementHit(ctx context.Context, domain, code string) (shortener.Link, error) {
 	s.mu.Lock()
-	l, ok := s.links[code]
+	stored, ok := s.lookup(domain, code)
 	if !ok {
 		s.mu.Unlock()
 		return shortener.Link{}, ErrNotFound
 	}
+	l := s.links[stored]
 	l.HitCount++
 	l.LastAccessAt = time.Now()
 	l.UpdatedAt = l.LastAccessAt
-	s.links[code] = l
+	s.links[stored] = l
 	s.mu.Unlock()
 	if err := s.flush(); err != nil {
 		return shortener.Link{}, err
@@ -141,6 +347,101 @@ func (s *fileStore) IncrementHit(ctx context.Context, code string) (shortener.Li
 	return l, nil
 }
 
+// IncrementBotHit increases the bot hit counter.
+func (s *fileStore) IncrementBotHit(ctx context.Context, domain, code string) (shortener.Link, error) {
+	s.mu.Lock()
+	stored, ok := s.lookup(domain, code)
+	if !ok {
+		s.mu.Unlock()
+		return shortener.Link{}, ErrNotFound
+	}
+	l := s.links[stored]
+	l.BotHitCount++
+	s.links[stored] = l
+	s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return shortener.Link{}, err
+	}
+	return l, nil
+}
+
+// AddHits adds the hits of all links and writes the file once.
+func (s *fileStore) AddHits(ctx context.Context, hits []shortener.Hits) error {
+	s.mu.Lock()
+	for _, h := range hits {
+		stored, ok := s.lookup(h.Domain, h.Code)
+		if !ok {
+			continue
+		}
+		l := s.links[stored]
+		l.HitCount += h.Human
+		l.BotHitCount += h.Bot
+		if !h.LastAccessAt.IsZero() {
+			l.LastAccessAt = h.LastAccessAt
+			l.UpdatedAt = h.LastAccessAt
+		}
+		s.links[stored] = l
+	}
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// Update replaces the URL, title, stats and timestamps of an existing link.
+func (s *fileStore) Update(ctx context.Context, l shortener.Link) error {
+	s.mu.Lock()
+	stored, ok := s.lookup(l.Domain, l.Code)
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	existing := s.links[stored]
+	existing.LongURL = l.LongURL
+	existing.Title = l.Title
+	existing.HitCount = l.HitCount
+	existing.BotHitCount = l.BotHitCount
+	existing.LastAccessAt = l.LastAccessAt
+	if !l.CreatedAt.IsZero() {
+		existing.CreatedAt = l.CreatedAt
+	}
+	existing.UpdatedAt = time.Now()
+	s.links[stored] = existing
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// UpdateDetails changes the URL and title of an existing link.
+func (s *fileStore) UpdateDetails(ctx context.Context, l shortener.Link) error {
+	s.mu.Lock()
+	stored, ok := s.lookup(l.Domain, l.Code)
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	existing := s.links[stored]
+	existing.LongURL = l.LongURL
+	existing.Title = l.Title
+	existing.UpdatedAt = time.Now()
+	s.links[stored] = existing
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// Walk visits all links in creation order. The links are held in memory
+// anyway, so it walks a snapshot.
+func (s *fileStore) Walk(ctx context.Context, fn func(shortener.Link) error) error {
+	links, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	for _, l := range links {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // List returns all links.
 func (s *fileStore) List(ctx context.Context) ([]shortener.Link, error) {
 	s.mu.RLock()
@@ -151,3 +452,23 @@ func (s *fileStore) List(ctx context.Context) ([]shortener.Link, error) {
 	s.mu.RUnlock()
 	return result, nil
 }
+
+// Count returns the number of links.
+func (s *fileStore) Count(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	n := len(s.links)
+	s.mu.RUnlock()
+	return int64(n), nil
+}
+
+// NextSequence returns the next value of the persisted link sequence.
+func (s *fileStore) NextSequence(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	s.sequence++
+	n := s.sequence
+	s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
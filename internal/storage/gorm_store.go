@@ -3,16 +3,24 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	"tinygo/internal/analytics"
 	"tinygo/internal/database"
 	"tinygo/internal/shortener"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// linkSequence names the counter sequential codes are derived from.
+const linkSequence = "links"
+
 // gormStore implements Store interface using GORM
 type gormStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	foldCase bool
 }
 
 // NewGormStore creates a new GORM-based store
@@ -27,22 +35,76 @@ func (s *gormStore) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// SetCaseInsensitive makes codes match regardless of case.
+func (s *gormStore) SetCaseInsensitive(enabled bool) {
+	s.foldCase = enabled
+}
+
+// key returns the lookup key for code.
+func (s *gormStore) key(code string) string {
+	return shortener.LookupKey(code, s.foldCase)
+}
+
 // Create saves a new link. Returns error if code exists.
 func (s *gormStore) Create(ctx context.Context, l shortener.Link) error {
+	key := s.key(l.Code)
+	l.CodeKey = &key
 	result := s.db.WithContext(ctx).Create(&l)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
-			return errors.New("code already exists: " + l.Code)
+			return fmt.Errorf("%w: %s", shortener.ErrCodeExists, l.Code)
 		}
 		return result.Error
 	}
 	return nil
 }
 
-// Get returns a link by code.
-func (s *gormStore) Get(ctx context.Context, code string) (shortener.Link, bool, error) {
+// errRollback aborts a transaction whose outcome is reported otherwise.
+var errRollback = errors.New("rollback")
+
+// CreateBatch saves links in a single transaction. Each link is created
+// under its own savepoint, so a duplicate code fails only that link unless
+// atomic is set.
+func (s *gormStore) CreateBatch(ctx context.Context, links []shortener.Link, atomic bool) ([]error, error) {
+	errs := make([]error, len(links))
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		failed := false
+		for i := range links {
+			l := links[i]
+			key := s.key(l.Code)
+			l.CodeKey = &key
+			savepoint := fmt.Sprintf("link_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&l).Error; err != nil {
+				if !errors.Is(err, gorm.ErrDuplicatedKey) {
+					return err
+				}
+				if err := tx.RollbackTo(savepoint).Error; err != nil {
+					return err
+				}
+				errs[i] = fmt.Errorf("%w: %s", shortener.ErrCodeExists, l.Code)
+				failed = true
+				continue
+			}
+			links[i] = l
+		}
+		if atomic && failed {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// Get returns a link by domain and code.
+func (s *gormStore) Get(ctx context.Context, domain, code string) (shortener.Link, bool, error) {
 	var l shortener.Link
-	result := s.db.WithContext(ctx).Where("code = ?", code).First(&l)
+	result := s.db.WithContext(ctx).Where("domain = ? AND code_key = ?", domain, s.key(code)).First(&l)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return shortener.Link{}, false, nil
@@ -52,24 +114,37 @@ func (s *gormStore) Get(ctx context.Context, code string) (shortener.Link, bool,
 	return l, true, nil
 }
 
-// Delete removes a link by code.
-func (s *gormStore) Delete(ctx context.Context, code string) error {
-	result := s.db.WithContext(ctx).Where("code = ?", code).Delete(&shortener.Link{})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+// Delete removes a link by domain and code, along with its clicks, visitor
+// sketches and rollups, in one transaction.
+func (s *gormStore) Delete(ctx context.Context, domain, code string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var l shortener.Link
+		result := tx.Where("domain = ? AND code_key = ?", domain, s.key(code)).Limit(1).Find(&l)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Delete(&l).Error; err != nil {
+			return err
+		}
+		// Analytics are keyed by the stored spelling of the code.
+		for _, model := range []any{&analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}} {
+			if err := tx.Where("domain = ? AND code = ?", l.Domain, l.Code).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // IncrementHit increases hit counter and updates last access time.
-func (s *gormStore) IncrementHit(ctx context.Context, code string) (shortener.Link, error) {
+func (s *gormStore) IncrementHit(ctx context.Context, domain, code string) (shortener.Link, error) {
 	var l shortener.Link
 
 	// First, get the current record
-	result := s.db.WithContext(ctx).Where("code = ?", code).First(&l)
+	result := s.db.WithContext(ctx).Where("domain = ? AND code_key = ?", domain, s.key(code)).First(&l)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return shortener.Link{}, ErrNotFound
@@ -89,7 +164,7 @@ func (s *gormStore) IncrementHit(ctx context.Context, code string) (shortener.Li
 	}
 
 	// Get the updated record
-	result = s.db.WithContext(ctx).Where("code = ?", code).First(&l)
+	result = s.db.WithContext(ctx).Where("domain = ? AND code_key = ?", domain, s.key(code)).First(&l)
 	if result.Error != nil {
 		return shortener.Link{}, result.Error
 	}
@@ -97,6 +172,109 @@ func (s *gormStore) IncrementHit(ctx context.Context, code string) (shortener.Li
 	return l, nil
 }
 
+// IncrementBotHit increases the bot hit counter.
+func (s *gormStore) IncrementBotHit(ctx context.Context, domain, code string) (shortener.Link, error) {
+	var l shortener.Link
+	result := s.db.WithContext(ctx).Model(&shortener.Link{}).
+		Where("domain = ? AND code_key = ?", domain, s.key(code)).
+		Update("bot_hit_count", gorm.Expr("bot_hit_count + 1"))
+	if result.Error != nil {
+		return shortener.Link{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return shortener.Link{}, ErrNotFound
+	}
+	if err := s.db.WithContext(ctx).Where("domain = ? AND code_key = ?", domain, s.key(code)).First(&l).Error; err != nil {
+		return shortener.Link{}, err
+	}
+	return l, nil
+}
+
+// AddHits adds the hits of all links in one transaction, one update per
+// link.
+func (s *gormStore) AddHits(ctx context.Context, hits []shortener.Hits) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, h := range hits {
+			updates := map[string]interface{}{
+				"hit_count":     gorm.Expr("hit_count + ?", h.Human),
+				"bot_hit_count": gorm.Expr("bot_hit_count + ?", h.Bot),
+			}
+			if !h.LastAccessAt.IsZero() {
+				updates["last_access_at"] = h.LastAccessAt
+			}
+			err := tx.Model(&shortener.Link{}).
+				Where("domain = ? AND code_key = ?", h.Domain, s.key(h.Code)).
+				Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Update replaces the URL, title, stats and timestamps of an existing link.
+func (s *gormStore) Update(ctx context.Context, l shortener.Link) error {
+	updates := map[string]interface{}{
+		"long_url":       l.LongURL,
+		"title":          l.Title,
+		"hit_count":      l.HitCount,
+		"bot_hit_count":  l.BotHitCount,
+		"last_access_at": l.LastAccessAt,
+	}
+	if !l.CreatedAt.IsZero() {
+		updates["created_at"] = l.CreatedAt
+	}
+	result := s.db.WithContext(ctx).Model(&shortener.Link{}).
+		Where("domain = ? AND code_key = ?", l.Domain, s.key(l.Code)).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateDetails changes the URL and title of an existing link.
+func (s *gormStore) UpdateDetails(ctx context.Context, l shortener.Link) error {
+	result := s.db.WithContext(ctx).Model(&shortener.Link{}).
+		Where("domain = ? AND code_key = ?", l.Domain, s.key(l.Code)).
+		Updates(map[string]interface{}{"long_url": l.LongURL, "title": l.Title})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// walkBatchSize is the number of links Walk loads per query.
+const walkBatchSize = 500
+
+// Walk visits all links in creation order, loading them in batches.
+func (s *gormStore) Walk(ctx context.Context, fn func(shortener.Link) error) error {
+	var lastID uint
+	for {
+		var links []shortener.Link
+		result := s.db.WithContext(ctx).Where("id > ?", lastID).Order("id").Limit(walkBatchSize).Find(&links)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, l := range links {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		if len(links) < walkBatchSize {
+			return nil
+		}
+		lastID = links[len(links)-1].ID
+	}
+}
+
 // List returns all links.
 func (s *gormStore) List(ctx context.Context) ([]shortener.Link, error) {
 	var links []shortener.Link
@@ -106,3 +284,110 @@ func (s *gormStore) List(ctx context.Context) ([]shortener.Link, error) {
 	}
 	return links, nil
 }
+
+// likeEscaper escapes LIKE wildcards so search terms match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Page returns one page of links, filtered and sorted in the database.
+func (s *gormStore) Page(ctx context.Context, q shortener.PageQuery) ([]shortener.Link, int64, error) {
+	query := s.db.WithContext(ctx).Model(&shortener.Link{})
+	if q.Search != "" {
+		term := "%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%"
+		query = query.Where(`LOWER(code) LIKE ? ESCAPE '\' OR LOWER(long_url) LIKE ? ESCAPE '\' OR LOWER(title) LIKE ? ESCAPE '\'`,
+			term, term, term)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	dir := ""
+	if q.Desc {
+		dir = " DESC"
+	}
+	query = query.Order(string(q.OrderBy) + dir).Order("id" + dir).Offset(q.Offset)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var links []shortener.Link
+	if err := query.Find(&links).Error; err != nil {
+		return nil, 0, err
+	}
+	return links, total, nil
+}
+
+// Count returns the number of links.
+func (s *gormStore) Count(ctx context.Context) (int64, error) {
+	var n int64
+	result := s.db.WithContext(ctx).Model(&shortener.Link{}).Count(&n)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return n, nil
+}
+
+// NextSequence returns the next value of the link sequence counter.
+func (s *gormStore) NextSequence(ctx context.Context) (uint64, error) {
+	var c shortener.Counter
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Create the counter on first use
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&shortener.Counter{Name: linkSequence})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Model(&shortener.Counter{}).Where("name = ?", linkSequence).
+			Update("value", gorm.Expr("value + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Where("name = ?", linkSequence).First(&c).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.Value, nil
+}
+
+// MigrateCodeKeys rewrites the lookup keys of existing links for the
+// current mode, after checking that no codes collide under it.
+func (s *gormStore) MigrateCodeKeys(ctx context.Context) ([]shortener.CodeCollision, error) {
+	db := s.db.WithContext(ctx)
+	keyExpr := "code"
+	if s.foldCase {
+		keyExpr = "LOWER(code)"
+
+		type group struct {
+			Domain string
+			K      string
+		}
+		var groups []group
+		result := db.Model(&shortener.Link{}).
+			Select("domain, " + keyExpr + " AS k").
+			Group("domain, k").
+			Having("COUNT(*) > 1").
+			Order("domain, k").
+			Scan(&groups)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if len(groups) > 0 {
+			collisions := make([]shortener.CodeCollision, 0, len(groups))
+			for _, g := range groups {
+				var codes []string
+				result := db.Model(&shortener.Link{}).
+					Where("domain = ? AND "+keyExpr+" = ?", g.Domain, g.K).
+					Order("code").
+					Pluck("code", &codes)
+				if result.Error != nil {
+					return nil, result.Error
+				}
+				collisions = append(collisions, shortener.CodeCollision{Domain: g.Domain, Key: g.K, Codes: codes})
+			}
+			return collisions, shortener.ErrCaseCollision
+		}
+	}
+
+	result := db.Model(&shortener.Link{}).
+		Where("code_key IS NULL OR code_key <> "+keyExpr).
+		UpdateColumn("code_key", gorm.Expr(keyExpr))
+	return nil, result.Error
+}
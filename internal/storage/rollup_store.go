@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"tinygo/internal/analytics"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rollupMarkID is the primary key of the single rollup mark row.
+const rollupMarkID = 1
+
+// RollupMark returns the rollup mark, zero if there is none yet.
+func (s *gormStore) RollupMark(ctx context.Context) (analytics.RollupMark, error) {
+	return s.rollupMark(s.db.WithContext(ctx))
+}
+
+func (s *gormStore) rollupMark(db *gorm.DB) (analytics.RollupMark, error) {
+	var mark analytics.RollupMark
+	if err := db.Limit(1).Find(&mark, rollupMarkID).Error; err != nil {
+		return analytics.RollupMark{}, err
+	}
+	mark.ID = rollupMarkID
+	return mark, nil
+}
+
+// RollupHours counts the clicks in [from, to) per link, hour, class and
+// dimension values, grouped in SQL.
+func (s *gormStore) RollupHours(ctx context.Context, from, to time.Time, dims []analytics.Dimension) ([]analytics.Rollup, error) {
+	epoch, err := s.epochSQL()
+	if err != nil {
+		return nil, err
+	}
+	group := []string{"domain", "code", "hour", "class"}
+	for _, d := range dims {
+		if !d.Valid() {
+			return nil, fmt.Errorf("%w: %s", analytics.ErrDimension, d)
+		}
+		group = append(group, string(d))
+	}
+	cols := append([]string{"domain", "code", epoch + " / 3600 AS hour", "class"}, group[4:]...)
+	rows, err := s.clickQuery(ctx, analytics.Query{From: from, To: to}).
+		Select(strings.Join(append(cols, "COUNT(*)"), ", ")).
+		Group(strings.Join(group, ", ")).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rollups []analytics.Rollup
+	for rows.Next() {
+		r := analytics.Rollup{Period: analytics.PeriodHour}
+		var hour int64
+		values := make([]string, len(dims))
+		dest := []any{&r.Domain, &r.Code, &hour, &r.Class}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(append(dest, &r.Clicks)...); err != nil {
+			return nil, err
+		}
+		r.Start = time.Unix(hour*3600, 0).UTC()
+		r.Values = strings.Join(values, analytics.ValueSeparator)
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// SaveRollups adds rollups to the stored ones and moves the mark in one
+// transaction, holding the mark row locked.
+func (s *gormStore) SaveRollups(ctx context.Context, rollups []analytics.Rollup, from, until time.Time) (bool, error) {
+	saved := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		mark, err := s.lockRollupMark(tx)
+		if err != nil {
+			return err
+		}
+		if !mark.RolledUntil.Equal(from) {
+			return nil
+		}
+		if len(rollups) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "domain"}, {Name: "code"}, {Name: "period"}, {Name: "start"},
+					{Name: "class"}, {Name: "dims"}, {Name: "dim_values"},
+				},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"clicks": gorm.Expr("click_rollups.clicks + excluded.clicks"),
+				}),
+			}).CreateInBatches(&rollups, 500).Error
+			if err != nil {
+				return err
+			}
+		}
+		mark.RolledUntil = until.UTC()
+		saved = true
+		return tx.Save(&mark).Error
+	})
+	return saved, err
+}
+
+// lockRollupMark returns the rollup mark, created if missing, locked for
+// the rest of the transaction.
+func (s *gormStore) lockRollupMark(tx *gorm.DB) (analytics.RollupMark, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&analytics.RollupMark{ID: rollupMarkID}).Error; err != nil {
+		return analytics.RollupMark{}, err
+	}
+	var mark analytics.RollupMark
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&mark, rollupMarkID).Error
+	return mark, err
+}
+
+// DeleteClicks deletes the clicks before before and moves the mark in one
+// transaction.
+func (s *gormStore) DeleteClicks(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("at < ?", before.UTC()).Delete(&analytics.Click{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		mark, err := s.lockRollupMark(tx)
+		if err != nil {
+			return err
+		}
+		mark.RawSince = before.UTC()
+		return tx.Save(&mark).Error
+	})
+	return deleted, err
+}
+
+// SumRollups sums rollups in SQL.
+func (s *gormStore) SumRollups(ctx context.Context, q analytics.Query, period analytics.Period, group string, perStart bool) ([]analytics.Rollup, error) {
+	query := s.db.WithContext(ctx).Model(&analytics.Rollup{}).Where("period = ? AND dims = ?", period, group)
+	if q.Code != "" {
+		query = query.Where("domain = ? AND code = ?", q.Domain, q.Code)
+	}
+	if q.Class != "" {
+		query = query.Where("class = ?", q.Class)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("start >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		query = query.Where("start < ?", q.To.UTC())
+	}
+	cols := "class, dim_values"
+	if perStart {
+		cols += ", start"
+	}
+	rows, err := query.Select(cols + ", SUM(clicks)").Group(cols).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rollups []analytics.Rollup
+	for rows.Next() {
+		r := analytics.Rollup{Period: period, Group: group}
+		dest := []any{&r.Class, &r.Values}
+		if perStart {
+			dest = append(dest, &r.Start)
+		}
+		if err := rows.Scan(append(dest, &r.Clicks)...); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// RollupMark returns the rollup mark.
+func (s *fileStore) RollupMark(ctx context.Context) (analytics.RollupMark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mark, nil
+}
+
+// RollupHours counts the clicks in [from, to) per link, hour, class and
+// dimension values.
+func (s *fileStore) RollupHours(ctx context.Context, from, to time.Time, dims []analytics.Dimension) ([]analytics.Rollup, error) {
+	for _, d := range dims {
+		if !d.Valid() {
+			return nil, fmt.Errorf("%w: %s", analytics.ErrDimension, d)
+		}
+	}
+	q := analytics.Query{From: from, To: to}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index := make(map[rollupKey]int)
+	var rollups []analytics.Rollup
+	for _, c := range s.clicks {
+		if !clickMatches(c, q) {
+			continue
+		}
+		values := make([]string, len(dims))
+		for i, d := range dims {
+			values[i] = c.Value(d)
+		}
+		r := analytics.Rollup{
+			Domain: c.Domain,
+			Code:   c.Code,
+			Period: analytics.PeriodHour,
+			Start:  c.At.UTC().Truncate(time.Hour),
+			Class:  c.Class,
+			Values: strings.Join(values, analytics.ValueSeparator),
+		}
+		key := keyOf(r)
+		if i, ok := index[key]; ok {
+			rollups[i].Clicks++
+			continue
+		}
+		index[key] = len(rollups)
+		r.Clicks = 1
+		rollups = append(rollups, r)
+	}
+	return rollups, nil
+}
+
+// SaveRollups adds rollups to the stored ones and moves the mark.
+func (s *fileStore) SaveRollups(ctx context.Context, rollups []analytics.Rollup, from, until time.Time) (bool, error) {
+	s.mu.Lock()
+	if !s.mark.RolledUntil.Equal(from) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	for _, r := range rollups {
+		key := keyOf(r)
+		if stored, ok := s.rollups[key]; ok {
+			r.Clicks += stored.Clicks
+		}
+		r.Start = r.Start.UTC()
+		s.rollups[key] = r
+	}
+	s.mark.RolledUntil = until.UTC()
+	s.mu.Unlock()
+	return true, s.flush()
+}
+
+// DeleteClicks deletes the clicks before before and moves the mark.
+func (s *fileStore) DeleteClicks(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	kept := s.clicks[:0]
+	for _, c := range s.clicks {
+		if !c.At.Before(before) {
+			kept = append(kept, c)
+		}
+	}
+	deleted := int64(len(s.clicks) - len(kept))
+	// Clear the tail so the deleted clicks can be collected.
+	clear(s.clicks[len(kept):])
+	s.clicks = kept
+	s.mark.RawSince = before.UTC()
+	s.mu.Unlock()
+	return deleted, s.flush()
+}
+
+// SumRollups sums the matching rollups.
+func (s *fileStore) SumRollups(ctx context.Context, q analytics.Query, period analytics.Period, group string, perStart bool) ([]analytics.Rollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index := make(map[rollupKey]int)
+	var sums []analytics.Rollup
+	for _, r := range s.rollups {
+		if r.Period != period || r.Group != group ||
+			q.Code != "" && (r.Domain != q.Domain || r.Code != q.Code) ||
+			q.Class != "" && r.Class != q.Class ||
+			!q.From.IsZero() && r.Start.Before(q.From) ||
+			!q.To.IsZero() && !r.Start.Before(q.To) {
+			continue
+		}
+		sum := analytics.Rollup{Period: period, Group: group, Class: r.Class, Values: r.Values}
+		if perStart {
+			sum.Start = r.Start
+		}
+		key := keyOf(sum)
+		if i, ok := index[key]; ok {
+			sums[i].Clicks += r.Clicks
+			continue
+		}
+		index[key] = len(sums)
+		sum.Clicks = r.Clicks
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
+
+// rollupKey identifies a rollup apart from its count.
+type rollupKey struct {
+	domain, code, period, class, group, values string
+	start                                      int64
+}
+
+func keyOf(r analytics.Rollup) rollupKey {
+	return rollupKey{r.Domain, r.Code, string(r.Period), r.Class, r.Group, r.Values, r.Start.Unix()}
+}
+
+// sortedRollups returns the rollups in a stable order for the data file.
+func sortedRollups(rollups map[rollupKey]analytics.Rollup) []analytics.Rollup {
+	out := make([]analytics.Rollup, 0, len(rollups))
+	for _, r := range rollups {
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(x, y analytics.Rollup) int {
+		a, b := keyOf(x), keyOf(y)
+		return cmp.Or(
+			cmp.Compare(a.start, b.start),
+			cmp.Compare(a.period, b.period),
+			cmp.Compare(a.domain, b.domain),
+			cmp.Compare(a.code, b.code),
+			cmp.Compare(a.class, b.class),
+			cmp.Compare(a.group, b.group),
+			cmp.Compare(a.values, b.values),
+		)
+	})
+	return out
+}
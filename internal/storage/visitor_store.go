@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"tinygo/internal/analytics"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MergeVisitors merges sketches into the stored ones in one transaction.
+func (s *gormStore) MergeVisitors(ctx context.Context, sketches []analytics.VisitorSketch) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, vs := range sketches {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&vs)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				continue
+			}
+			// Lock the existing row so that concurrent merges do not lose
+			// visitors; SQLite serializes writers anyway.
+			var stored analytics.VisitorSketch
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("domain = ? AND code = ? AND day = ?", vs.Domain, vs.Code, vs.Day).
+				First(&stored).Error
+			if err != nil {
+				return err
+			}
+			merged, err := analytics.MergeSketches(stored.Sketch, vs.Sketch)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&analytics.VisitorSketch{}).
+				Where("domain = ? AND code = ? AND day = ?", vs.Domain, vs.Code, vs.Day).
+				Update("sketch", merged).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// VisitorSketches returns the sketches of a link for the days touched by
+// the time range of q.
+func (s *gormStore) VisitorSketches(ctx context.Context, q analytics.Query) ([]analytics.VisitorSketch, error) {
+	query := s.db.WithContext(ctx).Where("domain = ? AND code = ?", q.Domain, q.Code)
+	first, last := q.Days()
+	if first != "" {
+		query = query.Where("day >= ?", first)
+	}
+	if last != "" {
+		query = query.Where("day <= ?", last)
+	}
+	var sketches []analytics.VisitorSketch
+	if err := query.Order("day").Find(&sketches).Error; err != nil {
+		return nil, err
+	}
+	return sketches, nil
+}
+
+// visitorSecretID is the primary key of the single visitor secret row.
+const visitorSecretID = 1
+
+// VisitorSecret returns the stored visitor secret, storing candidate first
+// if there is none.
+func (s *gormStore) VisitorSecret(ctx context.Context, candidate []byte) ([]byte, error) {
+	db := s.db.WithContext(ctx)
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&analytics.VisitorSecret{ID: visitorSecretID, Secret: candidate}).Error
+	if err != nil {
+		return nil, err
+	}
+	var stored analytics.VisitorSecret
+	if err := db.First(&stored, visitorSecretID).Error; err != nil {
+		return nil, err
+	}
+	return stored.Secret, nil
+}
+
+// MergeVisitors merges sketches into the stored ones.
+func (s *fileStore) MergeVisitors(ctx context.Context, sketches []analytics.VisitorSketch) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	for _, vs := range sketches {
+		key := visitorKey(vs.Domain, vs.Code, vs.Day)
+		if stored, ok := s.visitors[key]; ok {
+			merged, err := analytics.MergeSketches(stored.Sketch, vs.Sketch)
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			vs.Sketch = merged
+		}
+		s.visitors[key] = vs
+	}
+	s.mu.Unlock()
+	return s.flush()
+}
+
+// VisitorSketches returns the sketches of a link for the days touched by
+// the time range of q.
+func (s *fileStore) VisitorSketches(ctx context.Context, q analytics.Query) ([]analytics.VisitorSketch, error) {
+	first, last := q.Days()
+	s.mu.RLock()
+	var sketches []analytics.VisitorSketch
+	for _, vs := range s.visitors {
+		if vs.Domain == q.Domain && vs.Code == q.Code &&
+			(first == "" || vs.Day >= first) && (last == "" || vs.Day <= last) {
+			sketches = append(sketches, vs)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(sketches, func(i, j int) bool { return sketches[i].Day < sketches[j].Day })
+	return sketches, nil
+}
+
+func visitorKey(domain, code, day string) string {
+	return domain + "/" + code + "/" + day
+}
+
+// VisitorSecret returns the stored visitor secret, storing candidate first
+// if there is none.
+func (s *fileStore) VisitorSecret(ctx context.Context, candidate []byte) ([]byte, error) {
+	s.mu.Lock()
+	if s.visitorSecret != nil {
+		secret := s.visitorSecret
+		s.mu.Unlock()
+		return secret, nil
+	}
+	s.visitorSecret = candidate
+	s.mu.Unlock()
+	return candidate, s.flush()
+}
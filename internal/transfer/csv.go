@@ -0,0 +1,147 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/internal/shortener"
+)
+
+// csvHeader lists the exported CSV columns.
+var csvHeader = []string{"domain", "code", "long_url", "title", "hit_count", "bot_hit_count", "created_at", "updated_at", "last_access_at"}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw}, nil
+}
+
+func (w *csvWriter) Write(l shortener.Link) error {
+	r := toRecord(l)
+	return w.w.Write([]string{
+		r.Domain,
+		r.Code,
+		r.LongURL,
+		r.Title,
+		strconv.FormatInt(r.HitCount, 10),
+		strconv.FormatInt(r.BotHitCount, 10),
+		formatTime(r.CreatedAt),
+		formatTime(r.UpdatedAt),
+		formatTime(r.LastAccessAt),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvReader reads CSV with a header row. Columns are matched by name, so
+// they may come in any order; only code and long_url are required.
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	row     int // line of the current record
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("csv: missing header")
+		}
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"code", "long_url"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv: missing column %q", required)
+		}
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (r *csvReader) Read() (shortener.Link, error) {
+	fields, err := r.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return shortener.Link{}, io.EOF
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return shortener.Link{}, newRowError(perr.StartLine, "", perr.Err)
+		}
+		return shortener.Link{}, err
+	}
+	// Rows are reported by line number, like parse errors.
+	r.row, _ = r.r.FieldPos(0)
+	get := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	rec := record{Domain: get("domain"), Code: get("code"), LongURL: get("long_url"), Title: get("title")}
+	for name, dst := range map[string]*int64{
+		"hit_count":     &rec.HitCount,
+		"bot_hit_count": &rec.BotHitCount,
+	} {
+		if v := get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return shortener.Link{}, newRowError(r.row, rec.Code, fmt.Errorf("invalid %s %q", name, v))
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]**time.Time{
+		"created_at":     &rec.CreatedAt,
+		"updated_at":     &rec.UpdatedAt,
+		"last_access_at": &rec.LastAccessAt,
+	} {
+		t, err := parseTime(get(name))
+		if err != nil {
+			return shortener.Link{}, newRowError(r.row, rec.Code, fmt.Errorf("invalid %s: %w", name, err))
+		}
+		*dst = t
+	}
+	return rec.link(), nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *csvReader) Row() int { return r.row }
@@ -0,0 +1,320 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/internal/shortener"
+)
+
+// Export formats of other shorteners. They can be imported but not
+// exported.
+const (
+	Bitly     Format = "bitly"
+	Rebrandly Format = "rebrandly"
+	Shlink    Format = "shlink"
+)
+
+// ErrExportFormat indicates a format that can only be imported.
+var ErrExportFormat = errors.New("format can only be imported")
+
+// foreignColumns lists the accepted header names of each field in a
+// foreign CSV export, normalized with normalizeColumn.
+type foreignColumns struct {
+	code     []string
+	shortURL []string
+	longURL  []string
+	title    []string
+	clicks   []string
+	created  []string
+	// shared are the shortener's own domains, which links on them leave
+	// for the default domain, as with the Bitly API
+	shared []string
+}
+
+var bitlyColumns = foreignColumns{
+	shortURL: []string{"bitlink", "link", "shorturl", "shortlink", "shortenedlink"},
+	longURL:  []string{"longurl", "originalurl", "destination", "destinationurl"},
+	title:    []string{"title"},
+	clicks:   []string{"clicks", "totalclicks", "engagements", "totalengagements"},
+	created:  []string{"created", "createdat", "datecreated", "creationdate"},
+	shared:   []string{"bit.ly", "bitly.com", "j.mp"},
+}
+
+var rebrandlyColumns = foreignColumns{
+	code:     []string{"slashtag"},
+	shortURL: []string{"shorturl", "link", "rebrandedlink"},
+	longURL:  []string{"destination", "destinationurl", "longurl"},
+	title:    []string{"title"},
+	clicks:   []string{"clicks", "totalclicks"},
+	created:  []string{"created", "createdat", "creationdate", "datecreated"},
+	shared:   []string{"rebrand.ly"},
+}
+
+// normalizeColumn folds a CSV header for matching: lowercased, without
+// spaces, underscores, dashes and a byte order mark.
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, "\ufeff"))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+}
+
+// foreignTimeLayouts are the timestamp layouts seen in foreign exports.
+var foreignTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+func parseForeignTime(v string) (time.Time, error) {
+	for _, layout := range foreignTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", v)
+}
+
+// splitShortURL returns the host and code of a short URL, which exports
+// often write without a scheme.
+func splitShortURL(raw string) (host, code string, err error) {
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	code = strings.Trim(u.Path, "/")
+	if code == "" || strings.Contains(code, "/") {
+		return "", "", fmt.Errorf("no code in short url %q", raw)
+	}
+	return shortener.NormalizeHost(u.Host), code, nil
+}
+
+// foreignCSVReader reads the CSV export of another shortener.
+type foreignCSVReader struct {
+	r      *csv.Reader
+	fields map[string]int // field name -> column
+	shared []string
+	row    int
+}
+
+func newForeignCSVReader(r io.Reader, cols foreignColumns) (*foreignCSVReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("csv: missing header")
+		}
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[normalizeColumn(name)] = i
+	}
+	fields := make(map[string]int)
+	for field, aliases := range map[string][]string{
+		"code":      cols.code,
+		"short_url": cols.shortURL,
+		"long_url":  cols.longURL,
+		"title":     cols.title,
+		"clicks":    cols.clicks,
+		"created":   cols.created,
+	} {
+		for _, alias := range aliases {
+			if i, ok := index[alias]; ok {
+				fields[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := fields["long_url"]; !ok {
+		return nil, fmt.Errorf("csv: no destination url column")
+	}
+	_, hasCode := fields["code"]
+	if _, ok := fields["short_url"]; !ok && !hasCode {
+		return nil, fmt.Errorf("csv: no short link column")
+	}
+	return &foreignCSVReader{r: cr, fields: fields, shared: cols.shared}, nil
+}
+
+func (r *foreignCSVReader) Read() (shortener.Link, error) {
+	values, err := r.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return shortener.Link{}, io.EOF
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return shortener.Link{}, newRowError(perr.StartLine, "", perr.Err)
+		}
+		return shortener.Link{}, err
+	}
+	r.row, _ = r.r.FieldPos(0)
+	get := func(field string) string {
+		if i, ok := r.fields[field]; ok && i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+
+	l := shortener.Link{Code: get("code"), LongURL: get("long_url"), Title: get("title")}
+	if short := get("short_url"); short != "" {
+		host, code, err := splitShortURL(short)
+		if err != nil {
+			return shortener.Link{}, newRowError(r.row, l.Code, err)
+		}
+		if !slices.Contains(r.shared, host) {
+			l.Domain = host
+		}
+		if l.Code == "" {
+			l.Code = code
+		}
+	}
+	if l.Code == "" {
+		return shortener.Link{}, newRowError(r.row, "", errors.New("missing short link"))
+	}
+	if v := strings.ReplaceAll(get("clicks"), ",", ""); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return shortener.Link{}, newRowError(r.row, l.Code, fmt.Errorf("invalid clicks %q", v))
+		}
+		l.HitCount = n
+	}
+	if v := get("created"); v != "" {
+		t, err := parseForeignTime(v)
+		if err != nil {
+			return shortener.Link{}, newRowError(r.row, l.Code, err)
+		}
+		l.CreatedAt = t
+	}
+	return l, nil
+}
+
+func (r *foreignCSVReader) Row() int { return r.row }
+
+// shlinkShortURL is a short URL as listed by the Shlink REST API.
+type shlinkShortURL struct {
+	ShortCode     string    `json:"shortCode"`
+	ShortURL      string    `json:"shortUrl"`
+	LongURL       string    `json:"longUrl"`
+	DateCreated   time.Time `json:"dateCreated"`
+	Domain        *string   `json:"domain"`
+	Title         *string   `json:"title"`
+	VisitsCount   int64     `json:"visitsCount"`
+	VisitsSummary *struct {
+		Total int64 `json:"total"`
+	} `json:"visitsSummary"`
+}
+
+// shlinkReader streams short URLs from a Shlink JSON export: either the
+// response of GET /rest/v3/short-urls or a bare array of short URLs.
+type shlinkReader struct {
+	dec     *json.Decoder
+	started bool
+	row     int
+}
+
+func newShlinkReader(r io.Reader) *shlinkReader {
+	return &shlinkReader{dec: json.NewDecoder(r)}
+}
+
+// seek positions the decoder inside the array of short URLs.
+func (r *shlinkReader) seek() error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return fmt.Errorf("shlink: %w", err)
+	}
+	for {
+		switch tok {
+		case json.Delim('['):
+			return nil
+		case json.Delim('{'):
+			// Descend into "shortUrls" and then "data".
+			for {
+				key, err := r.dec.Token()
+				if err != nil {
+					return fmt.Errorf("shlink: %w", err)
+				}
+				if key == json.Delim('}') {
+					return errors.New("shlink: no short urls found")
+				}
+				if key == "shortUrls" || key == "data" {
+					break
+				}
+				var skip json.RawMessage
+				if err := r.dec.Decode(&skip); err != nil {
+					return fmt.Errorf("shlink: %w", err)
+				}
+			}
+			if tok, err = r.dec.Token(); err != nil {
+				return fmt.Errorf("shlink: %w", err)
+			}
+		default:
+			return errors.New("shlink: expected an object or array")
+		}
+	}
+}
+
+func (r *shlinkReader) Read() (shortener.Link, error) {
+	if !r.started {
+		r.started = true
+		if err := r.seek(); err != nil {
+			return shortener.Link{}, err
+		}
+	}
+	if !r.dec.More() {
+		return shortener.Link{}, io.EOF
+	}
+	r.row++
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return shortener.Link{}, fmt.Errorf("shlink: %w", err)
+	}
+	var su shlinkShortURL
+	if err := json.Unmarshal(raw, &su); err != nil {
+		return shortener.Link{}, newRowError(r.row, "", fmt.Errorf("invalid short url: %w", err))
+	}
+
+	l := shortener.Link{
+		Code:      su.ShortCode,
+		LongURL:   su.LongURL,
+		CreatedAt: su.DateCreated,
+		HitCount:  su.VisitsCount,
+	}
+	if su.VisitsSummary != nil {
+		l.HitCount = su.VisitsSummary.Total
+	}
+	if su.Title != nil {
+		l.Title = *su.Title
+	}
+	switch {
+	case su.Domain != nil:
+		l.Domain = shortener.NormalizeHost(*su.Domain)
+	case su.ShortURL != "":
+		// A null domain is the Shlink default domain, named in shortUrl.
+		host, _, err := splitShortURL(su.ShortURL)
+		if err != nil {
+			return shortener.Link{}, newRowError(r.row, l.Code, err)
+		}
+		l.Domain = host
+	}
+	return l, nil
+}
+
+func (r *shlinkReader) Row() int { return r.row }
@@ -0,0 +1,167 @@
+// Package transfer moves links in and out of the service as CSV or NDJSON
+// streams, for backups and migrations between environments.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"tinygo/internal/shortener"
+)
+
+// ErrFormat indicates an unknown file format.
+var ErrFormat = errors.New("unknown format")
+
+// Format is a file format links are exported to and imported from.
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat returns the format named s; empty means NDJSON.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return NDJSON, nil
+	case CSV, NDJSON, Bitly, Rebrandly, Shlink:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrFormat, s)
+	}
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Writer writes links one at a time.
+type Writer interface {
+	Write(l shortener.Link) error
+	// Flush writes any buffered data.
+	Flush() error
+}
+
+// Reader reads links one at a time. Read returns io.EOF after the last
+// link. A *RowError reports a row that could not be parsed; reading may
+// continue after it.
+type Reader interface {
+	Read() (shortener.Link, error)
+	// Row returns the input position of the last link read, for reports.
+	Row() int
+}
+
+// NewWriter returns a Writer for the format.
+func NewWriter(w io.Writer, f Format) (Writer, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w)
+	case NDJSON:
+		return newNDJSONWriter(w), nil
+	case Bitly, Rebrandly, Shlink:
+		return nil, fmt.Errorf("%w: %s", ErrExportFormat, f)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFormat, f)
+	}
+}
+
+// NewReader returns a Reader for the format.
+func NewReader(r io.Reader, f Format) (Reader, error) {
+	switch f {
+	case CSV:
+		return newCSVReader(r)
+	case NDJSON:
+		return newNDJSONReader(r), nil
+	case Bitly:
+		return newForeignCSVReader(r, bitlyColumns)
+	case Rebrandly:
+		return newForeignCSVReader(r, rebrandlyColumns)
+	case Shlink:
+		return newShlinkReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFormat, f)
+	}
+}
+
+// RowError is a problem with a single input row.
+type RowError struct {
+	Row  int    `json:"row"`
+	Code string `json:"code,omitempty"`
+	Err  error  `json:"-"`
+	// Message is Err as text, for reports.
+	Message string `json:"error"`
+}
+
+func newRowError(row int, code string, err error) *RowError {
+	return &RowError{Row: row, Code: code, Err: err, Message: err.Error()}
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error { return e.Err }
+
+// record is the exported form of a link, shared by all formats.
+type record struct {
+	Domain       string     `json:"domain,omitempty"`
+	Code         string     `json:"code"`
+	LongURL      string     `json:"long_url"`
+	Title        string     `json:"title,omitempty"`
+	HitCount     int64      `json:"hit_count"`
+	BotHitCount  int64      `json:"bot_hit_count,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	LastAccessAt *time.Time `json:"last_access_at,omitempty"`
+}
+
+func toRecord(l shortener.Link) record {
+	return record{
+		Domain:       l.Domain,
+		Code:         l.Code,
+		LongURL:      l.LongURL,
+		Title:        l.Title,
+		HitCount:     l.HitCount,
+		BotHitCount:  l.BotHitCount,
+		CreatedAt:    timePtr(l.CreatedAt),
+		UpdatedAt:    timePtr(l.UpdatedAt),
+		LastAccessAt: timePtr(l.LastAccessAt),
+	}
+}
+
+func (r record) link() shortener.Link {
+	l := shortener.Link{
+		Domain:      r.Domain,
+		Code:        r.Code,
+		LongURL:     r.LongURL,
+		Title:       r.Title,
+		HitCount:    r.HitCount,
+		BotHitCount: r.BotHitCount,
+	}
+	if r.CreatedAt != nil {
+		l.CreatedAt = *r.CreatedAt
+	}
+	if r.UpdatedAt != nil {
+		l.UpdatedAt = *r.UpdatedAt
+	}
+	if r.LastAccessAt != nil {
+		l.LastAccessAt = *r.LastAccessAt
+	}
+	return l
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
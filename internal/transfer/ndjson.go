@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"tinygo/internal/shortener"
+)
+
+// maxLineSize bounds a single NDJSON line.
+const maxLineSize = 1 << 20
+
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	bw := bufio.NewWriter(w)
+	return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (w *ndjsonWriter) Write(l shortener.Link) error {
+	return w.enc.Encode(toRecord(l))
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// ndjsonReader reads one JSON object per line, skipping blank lines.
+type ndjsonReader struct {
+	s   *bufio.Scanner
+	row int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &ndjsonReader{s: s}
+}
+
+func (r *ndjsonReader) Read() (shortener.Link, error) {
+	for r.s.Scan() {
+		r.row++
+		line := bytes.TrimSpace(r.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return shortener.Link{}, newRowError(r.row, "", fmt.Errorf("invalid json: %w", err))
+		}
+		if rec.HitCount < 0 {
+			return shortener.Link{}, newRowError(r.row, rec.Code, fmt.Errorf("invalid hit_count %d", rec.HitCount))
+		}
+		if rec.BotHitCount < 0 {
+			return shortener.Link{}, newRowError(r.row, rec.Code, fmt.Errorf("invalid bot_hit_count %d", rec.BotHitCount))
+		}
+		return rec.link(), nil
+	}
+	if err := r.s.Err(); err != nil {
+		return shortener.Link{}, err
+	}
+	return shortener.Link{}, io.EOF
+}
+
+func (r *ndjsonReader) Row() int { return r.row }
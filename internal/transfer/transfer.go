@@ -0,0 +1,179 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"tinygo/internal/shortener"
+)
+
+// ErrStore indicates an import stopped because the store failed.
+var ErrStore = errors.New("store failed")
+
+// maxReported bounds the number of row errors and renames listed in a
+// report, so that imports of any size run in constant memory.
+const maxReported = 1000
+
+// Options configures an import.
+type Options struct {
+	Policy shortener.ConflictPolicy
+	DryRun bool
+	// Domain, when set, replaces the domain of every imported link, for
+	// example to move links off a shortener's shared domain.
+	Domain string
+}
+
+// Rename records a link imported under a new code.
+type Rename struct {
+	Row    int    `json:"row"`
+	Domain string `json:"domain,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to,omitempty"`
+}
+
+// Report summarizes an import.
+type Report struct {
+	DryRun      bool `json:"dry_run"`
+	Rows        int  `json:"rows"`
+	Created     int  `json:"created"`
+	Skipped     int  `json:"skipped"`
+	Overwritten int  `json:"overwritten"`
+	Renamed     int  `json:"renamed"`
+	Failed      int  `json:"failed"`
+	// Rejected counts the failed rows whose code is not valid here.
+	Rejected int         `json:"rejected"`
+	Errors   []*RowError `json:"errors"`
+	Renames  []Rename    `json:"renames,omitempty"`
+	// Truncated is set when more errors or renames occurred than listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func (r *Report) fail(e *RowError) {
+	r.Failed++
+	if len(r.Errors) < maxReported {
+		r.Errors = append(r.Errors, e)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// Export writes all links to w and returns how many were written.
+func Export(ctx context.Context, svc *shortener.Service, w Writer) (int, error) {
+	n := 0
+	err := svc.Walk(ctx, func(l shortener.Link) error {
+		if err := w.Write(l); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+// Import reads links from r and stores them one at a time. Rows that fail
+// are listed in the report; the returned error is only set when reading
+// fails or the store fails, the latter wrapping ErrStore. A dry run checks
+// rows against stored links and against earlier rows of the same input,
+// so it keeps the codes it has seen in memory.
+func Import(ctx context.Context, svc *shortener.Service, r Reader, opts Options) (Report, error) {
+	report := Report{DryRun: opts.DryRun, Errors: []*RowError{}}
+	var seen map[string]bool
+	if opts.DryRun {
+		seen = make(map[string]bool)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		l, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		report.Rows++
+		if err != nil {
+			var rowErr *RowError
+			if !errors.As(err, &rowErr) {
+				return report, err
+			}
+			report.fail(rowErr)
+			continue
+		}
+
+		if opts.Domain != "" {
+			l.Domain = opts.Domain
+		}
+		imported, outcome, err := svc.Import(ctx, l, opts.Policy, opts.DryRun)
+		if err != nil {
+			if !rowFailure(err) {
+				return report, fmt.Errorf("%w: row %d: %w", ErrStore, r.Row(), err)
+			}
+			if errors.Is(err, shortener.ErrInvalidCode) || errors.Is(err, shortener.ErrBlockedCode) {
+				report.Rejected++
+			}
+			report.fail(newRowError(r.Row(), l.Code, err))
+			continue
+		}
+		if seen != nil && outcome == shortener.ImportCreated {
+			// A real run would find the code taken by an earlier row.
+			key := imported.Domain + "/" + imported.Code
+			if seen[key] {
+				outcome = conflictOutcome(opts.Policy)
+				if outcome == shortener.ImportRenamed {
+					imported.Code = ""
+				}
+			}
+			seen[key] = true
+		}
+		switch outcome {
+		case shortener.ImportCreated:
+			report.Created++
+		case shortener.ImportSkipped:
+			report.Skipped++
+		case shortener.ImportOverwritten:
+			report.Overwritten++
+		case shortener.ImportRenamed:
+			report.Renamed++
+			if len(report.Renames) < maxReported {
+				report.Renames = append(report.Renames, Rename{Row: r.Row(), Domain: imported.Domain, From: l.Code, To: imported.Code})
+			} else {
+				report.Truncated = true
+			}
+		}
+	}
+}
+
+// rowFailure reports whether err is a problem with a single row rather than
+// with the store.
+func rowFailure(err error) bool {
+	for _, target := range []error{
+		shortener.ErrInvalidURL,
+		shortener.ErrInvalidCode,
+		shortener.ErrBlockedCode,
+		shortener.ErrUnknownDomain,
+		shortener.ErrCodeExists,
+		shortener.ErrExhausted,
+		shortener.ErrConflictPolicy,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictOutcome is what policy does to a link whose code is taken.
+func conflictOutcome(policy shortener.ConflictPolicy) shortener.ImportOutcome {
+	switch policy {
+	case shortener.ConflictOverwrite:
+		return shortener.ImportOverwritten
+	case shortener.ConflictRename:
+		return shortener.ImportRenamed
+	default:
+		return shortener.ImportSkipped
+	}
+}
@@ -0,0 +1,367 @@
+package http
+
+import (
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/hits"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	"tinygo/pkg/useragent"
+
+	"github.com/gorilla/mux"
+)
+
+// recordClick stores the click event of a redirect to l, made by agent
+// and classified as class. A failure is logged and never fails the
+// redirect.
+func (h *Handlers) recordClick(r *stdhttp.Request, l shortener.Link, agent useragent.Agent, class string) {
+	if h.analytics == nil {
+		return
+	}
+	if err := h.analytics.Record(r.Context(), h.newClick(r, l, agent, class)); err != nil {
+		logger.Log.Warnf("record click %s: %v", l.Code, err)
+	}
+}
+
+// queueHit hands a redirect to l, counters and click event, to the hit
+// queue. A failure is logged and never fails the redirect.
+func (h *Handlers) queueHit(r *stdhttp.Request, l shortener.Link, agent useragent.Agent, class string) {
+	hit := hits.Hit{Domain: l.Domain, Code: l.Code, Bot: class != useragent.Human, At: time.Now()}
+	if h.analytics != nil {
+		c := h.newClick(r, l, agent, class)
+		c.At = hit.At
+		hit.Click = &c
+	}
+	if err := h.hits.Add(r.Context(), hit); err != nil {
+		logger.Log.Warnf("queue hit %s: %v", l.Code, err)
+	}
+}
+
+// newClick returns the click event of a redirect to l.
+func (h *Handlers) newClick(r *stdhttp.Request, l shortener.Link, agent useragent.Agent, class string) analytics.Click {
+	return analytics.Click{
+		Domain:         l.Domain,
+		Code:           l.Code,
+		Referrer:       r.Referer(),
+		UserAgent:      r.UserAgent(),
+		IP:             h.clientIP(r),
+		Destination:    l.LongURL,
+		Browser:        agent.Browser,
+		BrowserVersion: agent.BrowserVersion,
+		OS:             agent.OS,
+		Device:         agent.Device,
+		Class:          class,
+	}
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For
+// when the proxies in front are trusted. Each trusted proxy appends the
+// address it got the request from, so the client is the entry as many
+// from the right as there are proxies; entries left of it are whatever the
+// client sent.
+func (h *Handlers) clientIP(r *stdhttp.Request) string {
+	if h.cfg.Analytics.TrustProxy {
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, ip := range strings.Split(v, ",") {
+				if ip = strings.TrimSpace(ip); ip != "" {
+					hops = append(hops, ip)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			return hops[max(len(hops)-h.cfg.Analytics.TrustedHops, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// linkClicks lists the click events of a link, newest first, with
+// ?from=&to= time bounds and ?cursor=&limit= pagination.
+func (h *Handlers) linkClicks(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	l, ok := h.analyticsLink(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, stdhttp.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	page, err := h.analytics.Clicks(r.Context(), analytics.Query{
+		Domain: l.Domain,
+		Code:   l.Code,
+		From:   from,
+		To:     to,
+		Limit:  limit,
+	}, q.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, analytics.ErrCursor) {
+			writeError(w, stdhttp.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	if page.Clicks == nil {
+		page.Clicks = []analytics.Click{}
+	}
+	writeJSON(w, stdhttp.StatusOK, page)
+}
+
+// linkStats returns the clicks and approximate unique visitors of a link,
+// in total and per day, within the optional ?from=&to= range.
+func (h *Handlers) linkStats(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	q, ok := h.statsQuery(w, r)
+	if !ok {
+		return
+	}
+	stats, err := h.analytics.Visitors(r.Context(), q)
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, stats)
+}
+
+// linkReferrers breaks a link's clicks down by referrer host and
+// category, within the optional ?from=&to= range.
+func (h *Handlers) linkReferrers(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	q, ok := h.statsQuery(w, r)
+	if !ok {
+		return
+	}
+	stats, err := h.analytics.Referrers(r.Context(), q)
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, stats)
+}
+
+// breakdowns are the dimensions of the nested breakdowns served at
+// /api/links/{code}/stats/{breakdown} and /api/stats/{breakdown}.
+var breakdowns = map[string][]analytics.Dimension{
+	"browsers": {analytics.DimBrowser, analytics.DimBrowserVersion},
+	"os":       {analytics.DimOS},
+	"devices":  {analytics.DimDevice},
+	"classes":  {analytics.DimClass},
+	"geo":      {analytics.DimCountry, analytics.DimRegion, analytics.DimCity},
+}
+
+// breakdownPattern is the route pattern of the breakdown names available
+// with svc; geo needs a GeoIP database.
+func breakdownPattern(svc *analytics.Service) string {
+	names := "browsers|os|devices|classes"
+	if svc.HasGeoIP() {
+		names += "|geo"
+	}
+	return "{breakdown:" + names + "}"
+}
+
+// linkBreakdown breaks a link's clicks down by the dimensions of the
+// requested breakdown, within the optional ?from=&to= range.
+func (h *Handlers) linkBreakdown(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	q, ok := h.statsQuery(w, r)
+	if !ok {
+		return
+	}
+	h.writeBreakdown(w, r, q)
+}
+
+// globalBreakdown breaks the clicks of all links down like linkBreakdown.
+func (h *Handlers) globalBreakdown(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return
+	}
+	class, ok := clickClass(w, r)
+	if !ok {
+		return
+	}
+	h.writeBreakdown(w, r, analytics.Query{From: from, To: to, Class: class})
+}
+
+// linkTimeseries counts a link's clicks per ?interval= (hour, day or week)
+// in the ?tz= time zone between ?from= and ?to=.
+func (h *Handlers) linkTimeseries(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	l, ok := h.analyticsLink(w, r)
+	if !ok {
+		return
+	}
+	h.writeTimeseries(w, r, analytics.Query{Domain: l.Domain, Code: l.Code})
+}
+
+// globalTimeseries counts the clicks of all links like linkTimeseries.
+func (h *Handlers) globalTimeseries(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	h.writeTimeseries(w, r, analytics.Query{})
+}
+
+// writeTimeseries writes the time series of the clicks matching q. The
+// series defaults to daily buckets in UTC, ends now and covers the
+// default span of its interval.
+func (h *Handlers) writeTimeseries(w stdhttp.ResponseWriter, r *stdhttp.Request, q analytics.Query) {
+	params := r.URL.Query()
+	loc := time.UTC
+	if tz := params.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			writeError(w, stdhttp.StatusBadRequest, "invalid tz: "+tz)
+			return
+		}
+	}
+	interval := analytics.Interval(params.Get("interval"))
+	if interval == "" {
+		interval = analytics.IntervalDay
+	}
+	from, to, ok := timeRangeIn(w, r, loc)
+	if !ok {
+		return
+	}
+	if q.Class, ok = clickClass(w, r); !ok {
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-interval.DefaultSpan())
+	}
+	if !from.Before(to) {
+		writeError(w, stdhttp.StatusBadRequest, "from must be before to")
+		return
+	}
+	q.From, q.To = from, to
+	series, err := h.analytics.Timeseries(r.Context(), q, interval, loc)
+	switch {
+	case errors.Is(err, analytics.ErrInterval), errors.Is(err, analytics.ErrTooManyBuckets):
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+	case err != nil:
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, stdhttp.StatusOK, series)
+	}
+}
+
+func (h *Handlers) writeBreakdown(w stdhttp.ResponseWriter, r *stdhttp.Request, q analytics.Query) {
+	dims, ok := breakdowns[mux.Vars(r)["breakdown"]]
+	if !ok {
+		writeError(w, stdhttp.StatusNotFound, "unknown breakdown")
+		return
+	}
+	tree, err := h.analytics.Tree(r.Context(), q, dims...)
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, tree)
+}
+
+// statsQuery builds the click query of a per-link stats request, writing
+// the error response if it is invalid.
+func (h *Handlers) statsQuery(w stdhttp.ResponseWriter, r *stdhttp.Request) (analytics.Query, bool) {
+	l, ok := h.analyticsLink(w, r)
+	if !ok {
+		return analytics.Query{}, false
+	}
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return analytics.Query{}, false
+	}
+	class, ok := clickClass(w, r)
+	if !ok {
+		return analytics.Query{}, false
+	}
+	return analytics.Query{Domain: l.Domain, Code: l.Code, From: from, To: to, Class: class}, true
+}
+
+// analyticsLink resolves the link of an analytics request, writing the
+// error response if there is none.
+func (h *Handlers) analyticsLink(w stdhttp.ResponseWriter, r *stdhttp.Request) (shortener.Link, bool) {
+	l, ok, err := h.svc.Resolve(r.Context(), r.URL.Query().Get("domain"), mux.Vars(r)["code"])
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return shortener.Link{}, false
+	}
+	if !ok {
+		writeError(w, stdhttp.StatusNotFound, "not found")
+		return shortener.Link{}, false
+	}
+	return l, true
+}
+
+// timeRange parses the ?from= and ?to= bounds, as RFC 3339 timestamps or
+// dates. A date as to bound includes that whole day.
+func timeRange(w stdhttp.ResponseWriter, r *stdhttp.Request) (from, to time.Time, ok bool) {
+	return timeRangeIn(w, r, time.UTC)
+}
+
+// timeRangeIn is timeRange with dates taken as days in loc.
+func timeRangeIn(w stdhttp.ResponseWriter, r *stdhttp.Request, loc *time.Location) (from, to time.Time, ok bool) {
+	q := r.URL.Query()
+	var err error
+	if from, err = parseTimeIn(q.Get("from"), false, loc); err != nil {
+		writeError(w, stdhttp.StatusBadRequest, "invalid from: "+err.Error())
+		return time.Time{}, time.Time{}, false
+	}
+	if to, err = parseTimeIn(q.Get("to"), true, loc); err != nil {
+		writeError(w, stdhttp.StatusBadRequest, "invalid to: "+err.Error())
+		return time.Time{}, time.Time{}, false
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		writeError(w, stdhttp.StatusBadRequest, "from must be before to")
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// clickClass parses the optional ?class= filter.
+func clickClass(w stdhttp.ResponseWriter, r *stdhttp.Request) (string, bool) {
+	switch class := r.URL.Query().Get("class"); class {
+	case "", useragent.Human, useragent.Crawler, useragent.Preview:
+		return class, true
+	default:
+		writeError(w, stdhttp.StatusBadRequest, "invalid class: want human, bot or preview")
+		return "", false
+	}
+}
+
+func parseTime(v string, endOfDay bool) (time.Time, error) {
+	return parseTimeIn(v, endOfDay, time.UTC)
+}
+
+func parseTimeIn(v string, endOfDay bool, loc *time.Location) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, loc)
+	if err != nil {
+		return time.Time{}, errors.New("want an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,239 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	stdhttp "net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tinygo/internal/auth"
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// bitlyTimeLayout is the timestamp format of the Bitly API.
+const bitlyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// bitlyDefaultDomain is the domain Bitly clients send by default. It maps
+// to the default domain so that tools only need a new base URL.
+const bitlyDefaultDomain = "bit.ly"
+
+// bitlyLink is a bitlink in the Bitly API v4 shape.
+type bitlyLink struct {
+	References     map[string]string `json:"references"`
+	Link           string            `json:"link"`
+	ID             string            `json:"id"`
+	LongURL        string            `json:"long_url"`
+	Title          string            `json:"title,omitempty"`
+	Archived       bool              `json:"archived"`
+	CreatedAt      string            `json:"created_at"`
+	CustomBitlinks []string          `json:"custom_bitlinks"`
+	Tags           []string          `json:"tags"`
+	Deeplinks      []string          `json:"deeplinks"`
+}
+
+// bitlyError is an error response of the Bitly API.
+type bitlyError struct {
+	Message     string            `json:"message"`
+	Resource    string            `json:"resource,omitempty"`
+	Description string            `json:"description"`
+	Errors      []bitlyFieldError `json:"errors,omitempty"`
+}
+
+type bitlyFieldError struct {
+	Field     string `json:"field"`
+	ErrorCode string `json:"error_code"`
+}
+
+type bitlyShortenRequest struct {
+	LongURL string `json:"long_url"`
+	Domain  string `json:"domain"`
+}
+
+type bitlyExpandRequest struct {
+	BitlinkID string `json:"bitlink_id"`
+}
+
+type bitlyUpdateRequest struct {
+	LongURL *string `json:"long_url"`
+	Title   *string `json:"title"`
+}
+
+// bitlyAuth requires a configured API key as bearer token.
+func bitlyAuth(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.Method != stdhttp.MethodOptions && (!ok || !auth.ValidAPIKey(strings.TrimSpace(token))) {
+			writeJSON(w, stdhttp.StatusForbidden, bitlyError{
+				Message:     "FORBIDDEN",
+				Description: "You are currently forbidden to access this resource.",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handlers) bitlyShorten(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	var req bitlyShortenRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeBitlyInvalid(w, "INVALID_ARG_BODY", "body")
+		return
+	}
+	if req.Domain == bitlyDefaultDomain {
+		req.Domain = ""
+	}
+	l, err := h.svc.ShortenWith(r.Context(), req.LongURL, shortener.ShortenOptions{Domain: req.Domain})
+	if err != nil {
+		switch {
+		case errors.Is(err, shortener.ErrInvalidURL):
+			writeBitlyInvalid(w, "INVALID_ARG_LONG_URL", "long_url")
+		case errors.Is(err, shortener.ErrUnknownDomain):
+			writeBitlyInvalid(w, "INVALID_ARG_DOMAIN", "domain")
+		default:
+			writeBitlyInternal(w, err)
+		}
+		return
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	writeJSON(w, stdhttp.StatusCreated, h.bitlyLink(l))
+}
+
+func (h *Handlers) bitlyExpand(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	var req bitlyExpandRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || req.BitlinkID == "" {
+		writeBitlyInvalid(w, "INVALID_ARG_BITLINK_ID", "bitlink_id")
+		return
+	}
+	l, ok := h.bitlyLookup(w, r, req.BitlinkID)
+	if !ok {
+		return
+	}
+	b := h.bitlyLink(l)
+	writeJSON(w, stdhttp.StatusOK, map[string]string{
+		"link":       b.Link,
+		"id":         b.ID,
+		"long_url":   b.LongURL,
+		"created_at": b.CreatedAt,
+	})
+}
+
+// bitlink retrieves, updates or deletes a bitlink addressed as
+// "domain/code".
+func (h *Handlers) bitlink(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	l, ok := h.bitlyLookup(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case stdhttp.MethodGet:
+		writeJSON(w, stdhttp.StatusOK, h.bitlyLink(l))
+	case stdhttp.MethodPatch:
+		var req bitlyUpdateRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			writeBitlyInvalid(w, "INVALID_ARG_BODY", "body")
+			return
+		}
+		l, ok, err := h.svc.Edit(r.Context(), l.Domain, l.Code, shortener.LinkPatch{LongURL: req.LongURL, Title: req.Title})
+		switch {
+		case errors.Is(err, shortener.ErrInvalidURL):
+			writeBitlyInvalid(w, "INVALID_ARG_LONG_URL", "long_url")
+		case errors.Is(err, storage.ErrNotFound), err == nil && !ok:
+			writeBitlyNotFound(w)
+		case err != nil:
+			writeBitlyInternal(w, err)
+		default:
+			writeJSON(w, stdhttp.StatusOK, h.bitlyLink(l))
+		}
+	case stdhttp.MethodDelete:
+		if err := h.svc.Delete(r.Context(), l.Domain, l.Code); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				writeBitlyNotFound(w)
+				return
+			}
+			writeBitlyInternal(w, err)
+			return
+		}
+		id := h.bitlyLink(l).ID
+		writeJSON(w, stdhttp.StatusOK, map[string]any{"links_deleted": []map[string]string{{"id": id}}})
+	}
+}
+
+// bitlyLookup resolves a bitlink ID, with or without scheme, writing the
+// error response if it fails.
+func (h *Handlers) bitlyLookup(w stdhttp.ResponseWriter, r *stdhttp.Request, id string) (shortener.Link, bool) {
+	if host, code, ok := strings.Cut(id, "/"); ok && host == bitlyDefaultDomain {
+		id = code
+	}
+	domain, code, err := h.svc.SplitShortURL(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, shortener.ErrInvalidURL) {
+			writeBitlyInvalid(w, "INVALID_ARG_BITLINK_ID", "bitlink_id")
+		} else {
+			writeBitlyNotFound(w)
+		}
+		return shortener.Link{}, false
+	}
+	l, ok, err := h.svc.Resolve(r.Context(), domain, code)
+	if err != nil {
+		writeBitlyInternal(w, err)
+		return shortener.Link{}, false
+	}
+	if !ok {
+		writeBitlyNotFound(w)
+		return shortener.Link{}, false
+	}
+	return l, true
+}
+
+// bitlyLink converts a link to its Bitly representation. The ID is the
+// short URL without scheme.
+func (h *Handlers) bitlyLink(l shortener.Link) bitlyLink {
+	link := h.svc.ShortURL(l)
+	id := link
+	if u, err := url.Parse(link); err == nil {
+		id = u.Host + u.Path
+	}
+	return bitlyLink{
+		References:     map[string]string{},
+		Link:           link,
+		ID:             id,
+		LongURL:        l.LongURL,
+		Title:          l.Title,
+		CreatedAt:      l.CreatedAt.Format(bitlyTimeLayout),
+		CustomBitlinks: []string{},
+		Tags:           []string{},
+		Deeplinks:      []string{},
+	}
+}
+
+func writeBitlyInvalid(w stdhttp.ResponseWriter, message, field string) {
+	writeJSON(w, stdhttp.StatusBadRequest, bitlyError{
+		Message:     message,
+		Resource:    "bitlinks",
+		Description: "The value provided is invalid.",
+		Errors:      []bitlyFieldError{{Field: field, ErrorCode: "invalid"}},
+	})
+}
+
+func writeBitlyNotFound(w stdhttp.ResponseWriter) {
+	writeJSON(w, stdhttp.StatusNotFound, bitlyError{
+		Message:     "NOT_FOUND",
+		Resource:    "bitlinks",
+		Description: "What you are looking for cannot be found.",
+	})
+}
+
+func writeBitlyInternal(w stdhttp.ResponseWriter, err error) {
+	writeJSON(w, stdhttp.StatusInternalServerError, bitlyError{
+		Message:     "INTERNAL_ERROR",
+		Description: err.Error(),
+	})
+}
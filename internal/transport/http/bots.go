@@ -0,0 +1,33 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"strings"
+
+	"tinygo/pkg/useragent"
+)
+
+// purposeHeaders announce prefetches and previews, which no user asked
+// for yet.
+var purposeHeaders = []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"}
+
+// classifyRequest returns the class of a redirect request: the class of
+// its User-Agent, refined by headers. Requests announced as prefetch or
+// preview are previews; HEAD requests and requests without the Accept and
+// Accept-Language headers every browser navigation sends are bots.
+func classifyRequest(r *stdhttp.Request, agent useragent.Agent) string {
+	if agent.Class != useragent.Human {
+		return agent.Class
+	}
+	for _, name := range purposeHeaders {
+		v := strings.ToLower(r.Header.Get(name))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") {
+			return useragent.Preview
+		}
+	}
+	if r.Method == stdhttp.MethodHead ||
+		r.Header.Get("Accept") == "" && r.Header.Get("Accept-Language") == "" {
+		return useragent.Crawler
+	}
+	return useragent.Human
+}
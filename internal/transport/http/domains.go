@@ -0,0 +1,134 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	stdhttp "net/http"
+
+	"tinygo/internal/domains"
+
+	"github.com/gorilla/mux"
+)
+
+type domainRequest struct {
+	Name         string  `json:"name"`
+	RootRedirect *string `json:"root_redirect,omitempty"`
+	NotFoundURL  *string `json:"not_found_url,omitempty"`
+}
+
+// domainResponse adds the DNS record to publish to a domain.
+type domainResponse struct {
+	domains.Domain
+	Record domainRecord `json:"verification_record"`
+}
+
+type domainRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (h *Handlers) domainResponse(d domains.Domain) domainResponse {
+	return domainResponse{
+		Domain: d,
+		Record: domainRecord{Type: "TXT", Name: h.domains.RecordName(d.Name), Value: domains.RecordValue(d)},
+	}
+}
+
+func (h *Handlers) listDomains(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	ds, err := h.domains.List(r.Context())
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := make([]domainResponse, 0, len(ds))
+	for _, d := range ds {
+		resp = append(resp, h.domainResponse(d))
+	}
+	writeJSON(w, stdhttp.StatusOK, resp)
+}
+
+func (h *Handlers) addDomain(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	var req domainRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, stdhttp.StatusBadRequest, "invalid json")
+		return
+	}
+	var rootRedirect, notFoundURL string
+	if req.RootRedirect != nil {
+		rootRedirect = *req.RootRedirect
+	}
+	if req.NotFoundURL != nil {
+		notFoundURL = *req.NotFoundURL
+	}
+	d, err := h.domains.Add(r.Context(), req.Name, rootRedirect, notFoundURL)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	writeJSON(w, stdhttp.StatusCreated, h.domainResponse(d))
+}
+
+func (h *Handlers) domainDetail(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	name := mux.Vars(r)["name"]
+	switch r.Method {
+	case stdhttp.MethodGet:
+		d, ok, err := h.domains.Get(r.Context(), name)
+		if err != nil {
+			writeError(w, stdhttp.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			writeError(w, stdhttp.StatusNotFound, "not found")
+			return
+		}
+		writeJSON(w, stdhttp.StatusOK, h.domainResponse(d))
+	case stdhttp.MethodPatch:
+		var req domainRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, stdhttp.StatusBadRequest, "invalid json")
+			return
+		}
+		d, err := h.domains.Update(r.Context(), name, req.RootRedirect, req.NotFoundURL)
+		if err != nil {
+			writeDomainError(w, err)
+			return
+		}
+		writeJSON(w, stdhttp.StatusOK, h.domainResponse(d))
+	case stdhttp.MethodDelete:
+		if err := h.domains.Delete(r.Context(), name); err != nil {
+			writeDomainError(w, err)
+			return
+		}
+		w.WriteHeader(stdhttp.StatusNoContent)
+	default:
+		writeError(w, stdhttp.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *Handlers) verifyDomain(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	d, err := h.domains.Verify(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, h.domainResponse(d))
+}
+
+func writeDomainError(w stdhttp.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domains.ErrInvalidDomain), errors.Is(err, domains.ErrInvalidURL):
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+	case errors.Is(err, domains.ErrNotFound):
+		writeError(w, stdhttp.StatusNotFound, err.Error())
+	case errors.Is(err, domains.ErrExists):
+		writeError(w, stdhttp.StatusConflict, err.Error())
+	case errors.Is(err, domains.ErrNotVerified):
+		writeError(w, stdhttp.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, domains.ErrLookup):
+		writeError(w, stdhttp.StatusBadGateway, err.Error())
+	default:
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+	}
+}
@@ -4,27 +4,57 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	stdhttp "net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"tinygo/internal/analytics"
 	"tinygo/internal/auth"
 	"tinygo/internal/config"
+	"tinygo/internal/domains"
+	"tinygo/internal/hits"
+	"tinygo/internal/live"
 	"tinygo/internal/logger"
 	"tinygo/internal/shortener"
 	"tinygo/internal/storage"
+	"tinygo/pkg/useragent"
+
+	"github.com/gorilla/mux"
 )
 
+// Services bundles the services the HTTP layer serves.
+type Services struct {
+	Links     *shortener.Service
+	Domains   *domains.Service
+	Analytics *analytics.Service
+	// Agents classifies redirect requests; nil uses the built-in rules.
+	Agents *useragent.Parser
+	// Hits counts redirects in batches; nil counts them before responding.
+	Hits *hits.Queue
+	// Live streams redirects to subscribers; nil serves no live streams.
+	Live *live.Broker
+}
+
 type Handlers struct {
-	svc *shortener.Service
-	cfg config.Config
+	svc       *shortener.Service
+	domains   *domains.Service
+	analytics *analytics.Service
+	agents    *useragent.Parser
+	hits      *hits.Queue
+	live      *live.Broker
+	cfg       config.Config
 }
 
-func NewHandlers(svc *shortener.Service, cfg config.Config) *Handlers {
-	return &Handlers{svc: svc, cfg: cfg}
+func NewHandlers(s Services, cfg config.Config) *Handlers {
+	if s.Agents == nil {
+		s.Agents = useragent.Builtin()
+	}
+	return &Handlers{svc: s.Links, domains: s.Domains, analytics: s.Analytics, agents: s.Agents, hits: s.Hits, live: s.Live, cfg: cfg}
 }
 
 // Register registers routes on the given mux.
@@ -81,6 +111,40 @@ func (h *Handlers) stats(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	writeJSON(w, stdhttp.StatusOK, stats)
 }
 
+func (h *Handlers) keyspace(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	ks, err := h.svc.KeyspaceStats(r.Context())
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, ks)
+}
+
+// root redirects the root path of a custom domain to its configured
+// target, and serves the Web UI otherwise.
+func (h *Handlers) root(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if d, ok := h.domainSettings(r); ok && d.RootRedirect != "" {
+			stdhttp.Redirect(w, r, d.RootRedirect, stdhttp.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// domainSettings returns the verified custom domain the request was sent to.
+func (h *Handlers) domainSettings(r *stdhttp.Request) (domains.Domain, bool) {
+	if h.domains == nil {
+		return domains.Domain{}, false
+	}
+	d, ok, err := h.domains.Settings(r.Context(), r.Host)
+	if err != nil {
+		logger.Log.Errorf("domain settings for %s: %v", r.Host, err)
+		return domains.Domain{}, false
+	}
+	return d, ok
+}
+
 func (h *Handlers) webUI(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	// Serve the main HTML page
 	htmlPath := filepath.Join("web", "templates", "index.html")
@@ -155,6 +219,8 @@ func (h *Handlers) logout(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 type shortenRequest struct {
 	LongURL    string `json:"long_url"`
 	CustomCode string `json:"custom_code"`
+	Strategy   string `json:"strategy,omitempty"`
+	Domain     string `json:"domain,omitempty"`
 }
 
 type shortenResponse struct {
@@ -176,30 +242,116 @@ func (h *Handlers) shorten(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	}
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
-	l, err := h.svc.Shorten(ctx, req.LongURL, req.CustomCode)
+	l, err := h.svc.ShortenWith(ctx, req.LongURL, shortener.ShortenOptions{
+		CustomCode: req.CustomCode,
+		Strategy:   req.Strategy,
+		Domain:     req.Domain,
+	})
 	if err != nil {
-		switch {
-		case errors.Is(err, shortener.ErrInvalidURL), errors.Is(err, shortener.ErrInvalidCode):
-			writeError(w, stdhttp.StatusBadRequest, err.Error())
-		default:
-			writeError(w, stdhttp.StatusConflict, err.Error())
-		}
+		writeError(w, shortenStatus(err), err.Error())
 		return
 	}
-	resp := shortenResponse{Code: l.Code, ShortURL: h.svc.ShortURL(l.Code), LongURL: l.LongURL}
+	resp := shortenResponse{Code: l.Code, ShortURL: h.svc.ShortURL(l), LongURL: l.LongURL}
 	writeJSON(w, stdhttp.StatusCreated, resp)
 }
 
+// shortenStatus maps a shorten error to its HTTP status.
+func shortenStatus(err error) int {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidURL), errors.Is(err, shortener.ErrInvalidCode),
+		errors.Is(err, shortener.ErrStrategy), errors.Is(err, shortener.ErrUnknownDomain):
+		return stdhttp.StatusBadRequest
+	case errors.Is(err, shortener.ErrBlockedCode):
+		return stdhttp.StatusUnprocessableEntity
+	default:
+		return stdhttp.StatusConflict
+	}
+}
+
+// maxBatchSize caps the number of items of a batch shorten request.
+const maxBatchSize = 1000
+
+type batchResult struct {
+	Index    int    `json:"index"`
+	Code     string `json:"code,omitempty"`
+	ShortURL string `json:"short_url,omitempty"`
+	LongURL  string `json:"long_url"`
+	Status   int    `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Results []batchResult `json:"results"`
+}
+
+// shortenBatch creates links for an array of shorten requests. With
+// ?atomic=true no link is created unless all of them can be.
+func (h *Handlers) shortenBatch(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	var reqs []shortenRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 8<<20)).Decode(&reqs); err != nil {
+		writeError(w, stdhttp.StatusBadRequest, "invalid json: expected an array of shorten requests")
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		writeError(w, stdhttp.StatusBadRequest, fmt.Sprintf("batch must contain 1 to %d items", maxBatchSize))
+		return
+	}
+	atomic, _ := strconv.ParseBool(r.URL.Query().Get("atomic"))
+
+	items := make([]shortener.BatchItem, len(reqs))
+	for i, req := range reqs {
+		items[i] = shortener.BatchItem{
+			LongURL: req.LongURL,
+			ShortenOptions: shortener.ShortenOptions{
+				CustomCode: req.CustomCode,
+				Strategy:   req.Strategy,
+				Domain:     req.Domain,
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	results, err := h.svc.ShortenBatch(ctx, items, atomic)
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := batchResponse{Results: make([]batchResult, len(results))}
+	for i, res := range results {
+		br := batchResult{Index: i, LongURL: reqs[i].LongURL, Status: stdhttp.StatusCreated}
+		if res.Err != nil {
+			br.Status = shortenStatus(res.Err)
+			br.Error = res.Err.Error()
+			resp.Failed++
+		} else {
+			br.Code = res.Link.Code
+			br.ShortURL = h.svc.ShortURL(res.Link)
+			br.LongURL = res.Link.LongURL
+			resp.Created++
+		}
+		resp.Results[i] = br
+	}
+	status := stdhttp.StatusCreated
+	if resp.Failed > 0 {
+		status = stdhttp.StatusOK
+	}
+	writeJSON(w, status, resp)
+}
+
 func (h *Handlers) linkDetail(w stdhttp.ResponseWriter, r *stdhttp.Request) {
-	// path: /api/links/{code}
-	if !strings.HasPrefix(r.URL.Path, "/api/links/") {
+	// path: /api/links/{code}?domain=
+	code, ok := linkCode(r)
+	if !ok {
 		writeError(w, stdhttp.StatusNotFound, "not found")
 		return
 	}
-	code := strings.TrimPrefix(r.URL.Path, "/api/links/")
+	domain := r.URL.Query().Get("domain")
 	switch r.Method {
 	case stdhttp.MethodGet:
-		l, ok, err := h.svc.Resolve(r.Context(), code)
+		l, ok, err := h.svc.Resolve(r.Context(), domain, code)
 		if err != nil {
 			writeError(w, stdhttp.StatusInternalServerError, err.Error())
 			return
@@ -210,7 +362,7 @@ func (h *Handlers) linkDetail(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		}
 		writeJSON(w, stdhttp.StatusOK, l)
 	case stdhttp.MethodDelete:
-		if err := h.svc.Delete(r.Context(), code); err != nil {
+		if err := h.svc.Delete(r.Context(), domain, code); err != nil {
 			if errors.Is(err, storage.ErrNotFound) {
 				writeError(w, stdhttp.StatusNotFound, "not found")
 				return
@@ -227,7 +379,7 @@ func (h *Handlers) linkDetail(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 func (h *Handlers) redirect(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	// Show Web UI for root path
 	if r.URL.Path == "/" {
-		h.webUI(w, r)
+		h.root(stdhttp.HandlerFunc(h.webUI)).ServeHTTP(w, r)
 		return
 	}
 
@@ -244,10 +396,39 @@ func (h *Handlers) redirect(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	// Extract code from path
 	code := strings.TrimPrefix(r.URL.Path, "/")
 
-	// Hit the link (increment counter)
-	l, err := h.svc.Hit(r.Context(), code)
+	// Each served domain is its own code namespace
+	domain, err := h.svc.DomainForHost(r.Context(), r.Host)
+	if err != nil {
+		writeError(w, stdhttp.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Count the hit as human or bot, or not at all for ignored HEAD
+	// requests. With a hit queue the link is only read here.
+	agent := h.agents.Parse(r.UserAgent())
+	class := useragent.Human
+	if h.cfg.BotFilter.Enabled {
+		class = classifyRequest(r, agent)
+	}
+	count := r.Method != stdhttp.MethodHead || !h.cfg.BotFilter.IgnoreHead
+	var l shortener.Link
+	switch {
+	case !count || h.hits != nil:
+		var ok bool
+		if l, ok, err = h.svc.Resolve(r.Context(), domain, code); err == nil && !ok {
+			err = storage.ErrNotFound
+		}
+	case class == useragent.Human:
+		l, err = h.svc.Hit(r.Context(), domain, code)
+	default:
+		l, err = h.svc.BotHit(r.Context(), domain, code)
+	}
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
+			if d, ok := h.domainSettings(r); ok && d.NotFoundURL != "" {
+				stdhttp.Redirect(w, r, d.NotFoundURL, stdhttp.StatusFound)
+				return
+			}
 			writeError(w, stdhttp.StatusNotFound, "not found")
 			return
 		}
@@ -255,12 +436,34 @@ func (h *Handlers) redirect(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		return
 	}
 
+	switch {
+	case !count:
+	case h.hits != nil:
+		h.queueHit(r, l, agent, class)
+		h.publishHit(r, l, agent, class)
+	default:
+		h.recordClick(r, l, agent, class)
+		h.publishHit(r, l, agent, class)
+	}
+
 	// Redirect to the long URL
 	stdhttp.Redirect(w, r, l.LongURL, stdhttp.StatusFound)
 }
 
 // --- helpers ---
 
+// linkCode returns the {code} route variable, falling back to the path
+// suffix for routes registered without gorilla/mux.
+func linkCode(r *stdhttp.Request) (string, bool) {
+	if code := mux.Vars(r)["code"]; code != "" {
+		return code, true
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/links/") {
+		return "", false
+	}
+	return strings.TrimPrefix(r.URL.Path, "/api/links/"), true
+}
+
 func writeJSON(w stdhttp.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
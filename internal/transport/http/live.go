@@ -0,0 +1,147 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	stdhttp "net/http"
+	"strings"
+	"time"
+
+	"tinygo/internal/auth"
+	"tinygo/internal/live"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	"tinygo/pkg/useragent"
+)
+
+// liveAuth accepts a logged-in session, as the rest of /api, or an API key
+// sent as X-Api-Key or as a bearer token.
+func liveAuth(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		switch {
+		case auth.ValidAPIKey(r.Header.Get("X-Api-Key")),
+			bearer && auth.ValidAPIKey(strings.TrimSpace(token)),
+			auth.IsAuthenticated(r):
+			next.ServeHTTP(w, r)
+		default:
+			writeError(w, stdhttp.StatusUnauthorized, "authentication required")
+		}
+	})
+}
+
+// publishHit streams a redirect to l to live subscribers.
+func (h *Handlers) publishHit(r *stdhttp.Request, l shortener.Link, agent useragent.Agent, class string) {
+	if h.live == nil {
+		return
+	}
+	h.live.Publish(live.Event{
+		Domain:         l.Domain,
+		Code:           l.Code,
+		At:             time.Now().UTC(),
+		Class:          class,
+		Referrer:       r.Referer(),
+		Browser:        agent.Browser,
+		BrowserVersion: agent.BrowserVersion,
+		OS:             agent.OS,
+		Device:         agent.Device,
+	})
+}
+
+// linkLive streams the redirects to a link as server-sent events.
+func (h *Handlers) linkLive(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	l, ok := h.analyticsLink(w, r)
+	if !ok {
+		return
+	}
+	class, ok := clickClass(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.live.Subscribe(l.Domain, l.Code)
+	h.streamLive(w, r, sub, err, class)
+}
+
+// globalLive streams the redirects to every link as server-sent events.
+func (h *Handlers) globalLive(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	class, ok := clickClass(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.live.SubscribeAll()
+	h.streamLive(w, r, sub, err, class)
+}
+
+// streamLive writes the events of sub, those of class if not empty, until
+// the client goes away, the subscription is evicted for falling behind or
+// the server shuts down. Idle streams get a keepalive comment.
+func (h *Handlers) streamLive(w stdhttp.ResponseWriter, r *stdhttp.Request, sub *live.Subscription, err error, class string) {
+	if err != nil {
+		writeError(w, stdhttp.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer h.live.Unsubscribe(sub)
+
+	// Streams outlast the server's write timeout.
+	rc := stdhttp.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(stdhttp.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		logger.Log.Warnf("live stream: %v", err)
+		return
+	}
+
+	interval := time.Duration(h.cfg.Live.KeepaliveSeconds) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	keepalive := time.NewTicker(interval)
+	defer keepalive.Stop()
+	for {
+		var werr error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			_, werr = fmt.Fprint(w, ": keepalive\n\n")
+		case e, ok := <-sub.Events():
+			switch {
+			case !ok && sub.Evicted():
+				logger.Log.Warnf("live stream %s evicted: client fell behind", r.URL.Path)
+				fmt.Fprint(w, "event: evicted\ndata: {\"error\":\"client fell behind\"}\n\n")
+				_ = rc.Flush()
+				return
+			case !ok:
+				return
+			case class != "" && e.Class != class:
+				continue
+			}
+			werr = writeEvent(w, e)
+			// Only idle streams need keeping alive
+			keepalive.Reset(interval)
+		}
+		if werr == nil {
+			werr = rc.Flush()
+		}
+		if werr != nil {
+			// The client is gone.
+			return
+		}
+	}
+}
+
+// writeEvent writes e as a click event.
+func writeEvent(w stdhttp.ResponseWriter, e live.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: click\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -7,18 +7,17 @@ import (
 	"tinygo/internal/auth"
 	"tinygo/internal/config"
 	"tinygo/internal/logger"
-	"tinygo/internal/shortener"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
 // NewMux creates a new mux router with all routes and middlewares
-func NewMux(svc *shortener.Service, cfg config.Config) *mux.Router {
+func NewMux(services Services, cfg config.Config) *mux.Router {
 	// Initialize authentication
 	auth.Init(cfg.Auth)
 
-	handlers := NewHandlers(svc, cfg)
+	handlers := NewHandlers(services, cfg)
 
 	// Create main router
 	r := mux.NewRouter()
@@ -32,20 +31,71 @@ func NewMux(svc *shortener.Service, cfg config.Config) *mux.Router {
 	admin := r.PathPrefix("/admin").Subrouter()
 	admin.Use(auth.RequireAuth)
 	admin.HandleFunc("/shorten", handlers.shorten).Methods("POST")
+	admin.HandleFunc("/shorten/batch", handlers.shortenBatch).Methods("POST")
 	admin.HandleFunc("/links/{code}", handlers.linkDetail).Methods("GET", "DELETE")
 	admin.HandleFunc("/stats", handlers.stats).Methods("GET")
+	admin.HandleFunc("/stats/keyspace", handlers.keyspace).Methods("GET")
+
+	// Live click streams, for a session or an API key since long-running
+	// clients rarely hold a session. Registered ahead of /api, which only
+	// takes sessions.
+	if services.Live != nil {
+		r.Handle("/api/live", liveAuth(stdhttp.HandlerFunc(handlers.globalLive))).Methods("GET")
+		r.Handle("/api/links/{code}/live", liveAuth(stdhttp.HandlerFunc(handlers.linkLive))).Methods("GET")
+	}
 
 	// Public API routes (for programmatic access) - requires authentication
 	api := r.PathPrefix("/api").Subrouter()
 	api.Use(auth.LoginRequired)
 	api.HandleFunc("/shorten", handlers.shorten).Methods("POST")
+	api.HandleFunc("/shorten/batch", handlers.shortenBatch).Methods("POST")
 	api.HandleFunc("/links/{code}", handlers.linkDetail).Methods("GET", "DELETE")
+	api.HandleFunc("/stats/keyspace", handlers.keyspace).Methods("GET")
+	api.HandleFunc("/export", handlers.exportLinks).Methods("GET")
+	api.HandleFunc("/import", handlers.importLinks).Methods("POST")
+	if services.Analytics != nil {
+		api.HandleFunc("/links/{code}/clicks", handlers.linkClicks).Methods("GET")
+		api.HandleFunc("/links/{code}/stats", handlers.linkStats).Methods("GET")
+		api.HandleFunc("/links/{code}/stats/referrers", handlers.linkReferrers).Methods("GET")
+		api.HandleFunc("/links/{code}/stats/"+breakdownPattern(services.Analytics), handlers.linkBreakdown).Methods("GET")
+		api.HandleFunc("/stats/"+breakdownPattern(services.Analytics), handlers.globalBreakdown).Methods("GET")
+		api.HandleFunc("/links/{code}/timeseries", handlers.linkTimeseries).Methods("GET")
+		api.HandleFunc("/timeseries", handlers.globalTimeseries).Methods("GET")
+	}
+	if services.Domains != nil {
+		api.HandleFunc("/domains", handlers.listDomains).Methods("GET")
+		api.HandleFunc("/domains", handlers.addDomain).Methods("POST")
+		api.HandleFunc("/domains/{name}", handlers.domainDetail).Methods("GET", "PATCH", "DELETE")
+		api.HandleFunc("/domains/{name}/verify", handlers.verifyDomain).Methods("POST")
+	}
+
+	// YOURLS-compatible API, authenticated by signature token or password
+	r.HandleFunc("/yourls-api.php", handlers.yourls).Methods("GET", "POST")
+
+	// Shlink REST API, authenticated by the X-Api-Key header. OPTIONS is
+	// routed so that browser clients get their CORS preflight answered.
+	shlink := r.PathPrefix("/rest/v3").Subrouter()
+	shlink.Use(shlinkAuth)
+	shlink.HandleFunc("/short-urls", handlers.shlinkList).Methods("GET", "OPTIONS")
+	shlink.HandleFunc("/short-urls", handlers.shlinkCreate).Methods("POST")
+	shlink.HandleFunc("/short-urls/{code}", handlers.shlinkGet).Methods("GET", "OPTIONS")
+	shlink.HandleFunc("/short-urls/{code}", handlers.shlinkEdit).Methods("PATCH")
+	shlink.HandleFunc("/short-urls/{code}", handlers.shlinkDelete).Methods("DELETE")
+	shlink.HandleFunc("/short-urls/{code}/visits", handlers.shlinkVisits).Methods("GET", "OPTIONS")
+
+	// Bitly API v4, authenticated by a bearer token. Bitlink IDs contain a
+	// slash ("domain/code"), so the id matches the rest of the path.
+	bitly := r.PathPrefix("/v4").Subrouter()
+	bitly.Use(bitlyAuth)
+	bitly.HandleFunc("/shorten", handlers.bitlyShorten).Methods("POST", "OPTIONS")
+	bitly.HandleFunc("/expand", handlers.bitlyExpand).Methods("POST", "OPTIONS")
+	bitly.HandleFunc("/bitlinks/{id:.+}", handlers.bitlink).Methods("GET", "PATCH", "DELETE", "OPTIONS")
 
 	// Static files
 	r.PathPrefix("/static/").Handler(stdhttp.StripPrefix("/static/", stdhttp.FileServer(stdhttp.Dir("web/static/"))))
 
-	// Web UI - requires authentication
-	r.Handle("/", auth.RequireAuth(stdhttp.HandlerFunc(handlers.webUI))).Methods("GET")
+	// Web UI - requires authentication; custom domains may redirect instead
+	r.Handle("/", handlers.root(auth.RequireAuth(stdhttp.HandlerFunc(handlers.webUI)))).Methods("GET")
 
 	// Health check endpoints
 	r.HandleFunc("/healthz", handlers.health).Methods("GET")
@@ -54,7 +104,7 @@ func NewMux(svc *shortener.Service, cfg config.Config) *mux.Router {
 	// Core feature: Short URL redirect (must be last to avoid conflicts)
 	// This is the main purpose: ultra-short URLs like /abc123
 	// Use a more specific matcher to avoid conflicts
-	r.Path("/{code}").HandlerFunc(handlers.redirect).Methods("GET")
+	r.Path("/{code}").HandlerFunc(handlers.redirect).Methods("GET", "HEAD")
 
 	// Apply middlewares
 	r.Use(loggingMiddleware)
@@ -99,8 +149,8 @@ func corsMiddleware(next stdhttp.Handler) stdhttp.Handler {
 	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
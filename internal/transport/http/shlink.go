@@ -0,0 +1,417 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/auth"
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+	"tinygo/pkg/useragent"
+
+	"github.com/gorilla/mux"
+)
+
+// shlinkErrorBase prefixes the problem types of Shlink error responses.
+const shlinkErrorBase = "https://shlink.io/api/error/"
+
+// shlinkDefaultPageSize is the page size Shlink uses when none is given.
+const shlinkDefaultPageSize = 10
+
+// shlinkOrders maps Shlink orderBy fields to page orders.
+var shlinkOrders = map[string]shortener.PageOrder{
+	"dateCreated":  shortener.OrderCreated,
+	"shortCode":    shortener.OrderCode,
+	"longUrl":      shortener.OrderURL,
+	"title":        shortener.OrderTitle,
+	"visits":       shortener.OrderHits,
+	"nonBotVisits": shortener.OrderHits,
+}
+
+// shlinkShortURL is a link in the Shlink REST API v3 shape.
+type shlinkShortURL struct {
+	ShortCode     string              `json:"shortCode"`
+	ShortURL      string              `json:"shortUrl"`
+	LongURL       string              `json:"longUrl"`
+	DateCreated   string              `json:"dateCreated"`
+	VisitsSummary shlinkVisitsSummary `json:"visitsSummary"`
+	Tags          []string            `json:"tags"`
+	Meta          shlinkMeta          `json:"meta"`
+	Domain        *string             `json:"domain"`
+	Title         *string             `json:"title"`
+	Crawlable     bool                `json:"crawlable"`
+	ForwardQuery  bool                `json:"forwardQuery"`
+}
+
+type shlinkVisitsSummary struct {
+	Total   int64 `json:"total"`
+	NonBots int64 `json:"nonBots"`
+	Bots    int64 `json:"bots"`
+}
+
+type shlinkMeta struct {
+	ValidSince *string `json:"validSince"`
+	ValidUntil *string `json:"validUntil"`
+	MaxVisits  *int    `json:"maxVisits"`
+}
+
+type shlinkPagination struct {
+	CurrentPage        int   `json:"currentPage"`
+	PagesCount         int   `json:"pagesCount"`
+	ItemsPerPage       int   `json:"itemsPerPage"`
+	ItemsInCurrentPage int   `json:"itemsInCurrentPage"`
+	TotalItems         int64 `json:"totalItems"`
+}
+
+// shlinkProblem is a Shlink error, an RFC 7807 problem document.
+type shlinkProblem struct {
+	Type            string   `json:"type"`
+	Title           string   `json:"title"`
+	Detail          string   `json:"detail"`
+	Status          int      `json:"status"`
+	InvalidElements []string `json:"invalidElements,omitempty"`
+	ShortCode       string   `json:"shortCode,omitempty"`
+	CustomSlug      string   `json:"customSlug,omitempty"`
+	Domain          string   `json:"domain,omitempty"`
+}
+
+type shlinkCreateRequest struct {
+	LongURL    string `json:"longUrl"`
+	CustomSlug string `json:"customSlug"`
+	Title      string `json:"title"`
+	Domain     string `json:"domain"`
+}
+
+type shlinkEditRequest struct {
+	LongURL *string `json:"longUrl"`
+	// Title is kept raw so that null, which resets it, differs from absent.
+	Title json.RawMessage `json:"title"`
+}
+
+// shlinkAuth requires a configured API key in the X-Api-Key header.
+func shlinkAuth(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if r.Method != stdhttp.MethodOptions && !auth.ValidAPIKey(r.Header.Get("X-Api-Key")) {
+			writeShlinkProblem(w, shlinkProblem{
+				Type:   shlinkErrorBase + "invalid-api-key",
+				Title:  "Invalid API key",
+				Detail: "Provided API key does not exist or is invalid.",
+				Status: stdhttp.StatusUnauthorized,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handlers) shlinkList(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	q := r.URL.Query()
+	page, perPage, ok := shlinkPaging(w, r)
+	if !ok {
+		return
+	}
+	pq := shortener.PageQuery{Search: q.Get("searchTerm"), OrderBy: shortener.OrderCreated}
+	if orderBy := q.Get("orderBy"); orderBy != "" {
+		field, dir, _ := strings.Cut(orderBy, "-")
+		order, known := shlinkOrders[field]
+		if !known || (dir != "" && dir != "ASC" && dir != "DESC") {
+			writeShlinkInvalid(w, "orderBy")
+			return
+		}
+		pq.OrderBy, pq.Desc = order, dir == "DESC"
+	}
+	if perPage > 0 {
+		pq.Offset, pq.Limit = (page-1)*perPage, perPage
+	}
+
+	links, total, err := h.svc.Page(r.Context(), pq)
+	if err != nil {
+		writeShlinkInternal(w, err)
+		return
+	}
+	data := make([]shlinkShortURL, len(links))
+	for i, l := range links {
+		data[i] = h.shlinkShortURL(l)
+	}
+	type shortURLs struct {
+		Data       []shlinkShortURL `json:"data"`
+		Pagination shlinkPagination `json:"pagination"`
+	}
+	writeJSON(w, stdhttp.StatusOK, map[string]shortURLs{
+		"shortUrls": {Data: data, Pagination: shlinkPages(page, perPage, len(data), total)},
+	})
+}
+
+func (h *Handlers) shlinkCreate(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	var req shlinkCreateRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeShlinkInvalid(w)
+		return
+	}
+	l, err := h.svc.ShortenWith(r.Context(), req.LongURL, shortener.ShortenOptions{
+		Domain:     req.Domain,
+		CustomCode: req.CustomSlug,
+		Title:      req.Title,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, shortener.ErrInvalidURL):
+			writeShlinkInvalid(w, "longUrl")
+		case errors.Is(err, shortener.ErrInvalidCode), errors.Is(err, shortener.ErrBlockedCode):
+			writeShlinkInvalid(w, "customSlug")
+		case errors.Is(err, shortener.ErrUnknownDomain):
+			writeShlinkInvalid(w, "domain")
+		case errors.Is(err, shortener.ErrCodeExists) && req.CustomSlug != "":
+			writeShlinkProblem(w, shlinkProblem{
+				Type:       shlinkErrorBase + "non-unique-slug",
+				Title:      "Invalid custom slug",
+				Detail:     fmt.Sprintf("Provided slug %q is already in use.", req.CustomSlug),
+				Status:     stdhttp.StatusBadRequest,
+				CustomSlug: req.CustomSlug,
+				Domain:     req.Domain,
+			})
+		default:
+			writeShlinkInternal(w, err)
+		}
+		return
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	writeJSON(w, stdhttp.StatusOK, h.shlinkShortURL(l))
+}
+
+func (h *Handlers) shlinkGet(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	code, domain := mux.Vars(r)["code"], r.URL.Query().Get("domain")
+	l, ok, err := h.svc.Resolve(r.Context(), domain, code)
+	if err != nil {
+		writeShlinkInternal(w, err)
+		return
+	}
+	if !ok {
+		writeShlinkNotFound(w, domain, code)
+		return
+	}
+	writeJSON(w, stdhttp.StatusOK, h.shlinkShortURL(l))
+}
+
+func (h *Handlers) shlinkEdit(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	code, domain := mux.Vars(r)["code"], r.URL.Query().Get("domain")
+	var req shlinkEditRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeShlinkInvalid(w)
+		return
+	}
+	patch := shortener.LinkPatch{LongURL: req.LongURL}
+	if len(req.Title) > 0 {
+		title := ""
+		if string(req.Title) != "null" {
+			if err := json.Unmarshal(req.Title, &title); err != nil {
+				writeShlinkInvalid(w, "title")
+				return
+			}
+		}
+		patch.Title = &title
+	}
+	l, ok, err := h.svc.Edit(r.Context(), domain, code, patch)
+	switch {
+	case errors.Is(err, shortener.ErrInvalidURL):
+		writeShlinkInvalid(w, "longUrl")
+	case errors.Is(err, storage.ErrNotFound), err == nil && !ok:
+		writeShlinkNotFound(w, domain, code)
+	case err != nil:
+		writeShlinkInternal(w, err)
+	default:
+		writeJSON(w, stdhttp.StatusOK, h.shlinkShortURL(l))
+	}
+}
+
+func (h *Handlers) shlinkDelete(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	code, domain := mux.Vars(r)["code"], r.URL.Query().Get("domain")
+	if err := h.svc.Delete(r.Context(), domain, code); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeShlinkNotFound(w, domain, code)
+			return
+		}
+		writeShlinkInternal(w, err)
+		return
+	}
+	w.WriteHeader(stdhttp.StatusNoContent)
+}
+
+// shlinkVisit is a click in the Shlink REST API v3 shape.
+type shlinkVisit struct {
+	Referer       string  `json:"referer"`
+	Date          string  `json:"date"`
+	UserAgent     string  `json:"userAgent"`
+	VisitLocation *string `json:"visitLocation"`
+	PotentialBot  bool    `json:"potentialBot"`
+	VisitedURL    string  `json:"visitedUrl"`
+	RedirectURL   string  `json:"redirectUrl"`
+}
+
+// shlinkVisits lists the recorded clicks of a link, newest first, within
+// the optional startDate and endDate. Without click analytics the list is
+// empty; the visit count is still reported in the link's visitsSummary.
+func (h *Handlers) shlinkVisits(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	code, domain := mux.Vars(r)["code"], r.URL.Query().Get("domain")
+	page, perPage, ok := shlinkPaging(w, r)
+	if !ok {
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("startDate"), false)
+	if err != nil {
+		writeShlinkInvalid(w, "startDate")
+		return
+	}
+	to, err := parseTime(r.URL.Query().Get("endDate"), true)
+	if err != nil {
+		writeShlinkInvalid(w, "endDate")
+		return
+	}
+	l, found, err := h.svc.Resolve(r.Context(), domain, code)
+	if err != nil {
+		writeShlinkInternal(w, err)
+		return
+	}
+	if !found {
+		writeShlinkNotFound(w, domain, code)
+		return
+	}
+
+	data := []shlinkVisit{}
+	var total int64
+	if h.analytics != nil {
+		q := analytics.Query{Domain: l.Domain, Code: l.Code, From: from, To: to, Limit: analytics.MaxPageSize}
+		if perPage > 0 {
+			q.Offset, q.Limit = (page-1)*perPage, perPage
+		}
+		clicks, err := h.analytics.Clicks(r.Context(), q, "")
+		if err == nil {
+			total, err = h.analytics.Count(r.Context(), q)
+		}
+		if err != nil {
+			writeShlinkInternal(w, err)
+			return
+		}
+		shortURL := h.svc.ShortURL(l)
+		for _, c := range clicks.Clicks {
+			data = append(data, shlinkVisit{
+				Referer:      c.Referrer,
+				Date:         c.At.Format(time.RFC3339),
+				UserAgent:    c.UserAgent,
+				PotentialBot: c.Class != "" && c.Class != useragent.Human,
+				VisitedURL:   shortURL,
+				RedirectURL:  c.Destination,
+			})
+		}
+	}
+	type visits struct {
+		Data       []shlinkVisit    `json:"data"`
+		Pagination shlinkPagination `json:"pagination"`
+	}
+	writeJSON(w, stdhttp.StatusOK, map[string]visits{
+		"visits": {Data: data, Pagination: shlinkPages(page, perPage, len(data), total)},
+	})
+}
+
+// shlinkShortURL converts a link to its Shlink representation.
+func (h *Handlers) shlinkShortURL(l shortener.Link) shlinkShortURL {
+	s := shlinkShortURL{
+		ShortCode:     l.Code,
+		ShortURL:      h.svc.ShortURL(l),
+		LongURL:       l.LongURL,
+		DateCreated:   l.CreatedAt.Format(time.RFC3339),
+		VisitsSummary: shlinkVisitsSummary{Total: l.HitCount + l.BotHitCount, NonBots: l.HitCount, Bots: l.BotHitCount},
+		Tags:          []string{},
+	}
+	if l.Domain != "" {
+		s.Domain = &l.Domain
+	}
+	if l.Title != "" {
+		s.Title = &l.Title
+	}
+	return s
+}
+
+// shlinkPaging parses the page and itemsPerPage parameters. An
+// itemsPerPage of -1 requests all items; perPage is then zero.
+func shlinkPaging(w stdhttp.ResponseWriter, r *stdhttp.Request) (page, perPage int, ok bool) {
+	q := r.URL.Query()
+	page, perPage = 1, shlinkDefaultPageSize
+	var err error
+	if v := q.Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			writeShlinkInvalid(w, "page")
+			return 0, 0, false
+		}
+	}
+	if v := q.Get("itemsPerPage"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage == 0 || perPage < -1 {
+			writeShlinkInvalid(w, "itemsPerPage")
+			return 0, 0, false
+		}
+		if perPage == -1 {
+			page, perPage = 1, 0
+		}
+	}
+	return page, perPage, true
+}
+
+// shlinkPages builds the pagination of a page of n items out of total.
+func shlinkPages(page, perPage, n int, total int64) shlinkPagination {
+	p := shlinkPagination{CurrentPage: page, ItemsPerPage: perPage, ItemsInCurrentPage: n, TotalItems: total, PagesCount: 1}
+	if perPage == 0 {
+		p.ItemsPerPage = int(total)
+	} else {
+		p.PagesCount = int((total + int64(perPage) - 1) / int64(perPage))
+	}
+	return p
+}
+
+func writeShlinkProblem(w stdhttp.ResponseWriter, p shlinkProblem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func writeShlinkInvalid(w stdhttp.ResponseWriter, elements ...string) {
+	writeShlinkProblem(w, shlinkProblem{
+		Type:            shlinkErrorBase + "invalid-data",
+		Title:           "Invalid data",
+		Detail:          "Provided data is not valid",
+		Status:          stdhttp.StatusBadRequest,
+		InvalidElements: elements,
+	})
+}
+
+func writeShlinkNotFound(w stdhttp.ResponseWriter, domain, code string) {
+	detail := fmt.Sprintf("No URL found with short code %q", code)
+	if domain != "" {
+		detail += fmt.Sprintf(" for domain %q", domain)
+	}
+	writeShlinkProblem(w, shlinkProblem{
+		Type:      shlinkErrorBase + "short-url-not-found",
+		Title:     "Short URL not found",
+		Detail:    detail,
+		Status:    stdhttp.StatusNotFound,
+		ShortCode: code,
+		Domain:    domain,
+	})
+}
+
+func writeShlinkInternal(w stdhttp.ResponseWriter, err error) {
+	writeShlinkProblem(w, shlinkProblem{
+		Type:   shlinkErrorBase + "internal-server-error",
+		Title:  "Internal server error",
+		Detail: err.Error(),
+		Status: stdhttp.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	stdhttp "net/http"
+	"strconv"
+	"time"
+
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	"tinygo/internal/transfer"
+)
+
+// exportLinks streams all links as CSV or NDJSON (?format=csv|ndjson).
+func (h *Handlers) exportLinks(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+		return
+	}
+	// Large exports outlast the server's write timeout.
+	_ = stdhttp.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links-%s.%s"`, time.Now().Format("20060102"), format))
+	tw, err := transfer.NewWriter(w, format)
+	if err != nil {
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := transfer.Export(r.Context(), h.svc, tw)
+	if err != nil {
+		// Headers are gone; all that is left is to cut the stream short.
+		logger.Log.Errorf("export links after %d rows: %v", n, err)
+		return
+	}
+	logger.Log.Info("links exported", "format", format, "rows", n)
+}
+
+// importLinks reads links from the request body as CSV, NDJSON or the
+// export of another shortener (bitly, rebrandly, shlink). The format comes
+// from ?format or the Content-Type; ?policy=skip|overwrite|rename resolves
+// code conflicts, ?domain= moves all links to one domain and ?dry_run=true
+// only validates.
+func (h *Handlers) importLinks(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	q := r.URL.Query()
+	name := q.Get("format")
+	if name == "" {
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mt == "text/csv" {
+			name = string(transfer.CSV)
+		}
+	}
+	format, err := transfer.ParseFormat(name)
+	if err != nil {
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+		return
+	}
+	policy, err := shortener.ParseConflictPolicy(q.Get("policy"))
+	if err != nil {
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+
+	// Large imports outlast the server's read and write timeouts.
+	rc := stdhttp.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	tr, err := transfer.NewReader(r.Body, format)
+	if err != nil {
+		writeError(w, stdhttp.StatusBadRequest, err.Error())
+		return
+	}
+	report, err := transfer.Import(r.Context(), h.svc, tr, transfer.Options{
+		Policy: policy,
+		DryRun: dryRun,
+		Domain: q.Get("domain"),
+	})
+	if err != nil {
+		status := stdhttp.StatusBadRequest
+		if errors.Is(err, transfer.ErrStore) {
+			logger.Log.Errorf("import links after %d rows: %v", report.Rows, err)
+			status = stdhttp.StatusInternalServerError
+		}
+		writeError(w, status, fmt.Sprintf("import stopped after %d rows: %v", report.Rows, err))
+		return
+	}
+	logger.Log.Info("links imported", "format", format, "rows", report.Rows, "created", report.Created,
+		"failed", report.Failed, "dry_run", dryRun)
+	writeJSON(w, stdhttp.StatusOK, report)
+}
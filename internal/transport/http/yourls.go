@@ -0,0 +1,281 @@
+package http
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/internal/auth"
+	"tinygo/internal/shortener"
+)
+
+// yourlsNonceLife is how long a timestamped YOURLS signature stays valid.
+const yourlsNonceLife = 12 * time.Hour
+
+// yourlsTimeLayout is the timestamp format YOURLS reports.
+const yourlsTimeLayout = "2006-01-02 15:04:05"
+
+// yourlsResult is a response of the YOURLS API. Fields follow the
+// yourls-api.php output so existing clients parse it unchanged.
+type yourlsResult struct {
+	XMLName    xml.Name       `json:"-" xml:"result"`
+	URL        *yourlsURL     `json:"url,omitempty" xml:"url,omitempty"`
+	Status     string         `json:"status,omitempty" xml:"status,omitempty"`
+	Code       string         `json:"code,omitempty" xml:"code,omitempty"`
+	Keyword    string         `json:"keyword,omitempty" xml:"keyword,omitempty"`
+	Message    string         `json:"message" xml:"message"`
+	Title      string         `json:"title,omitempty" xml:"title,omitempty"`
+	ShortURL   string         `json:"shorturl,omitempty" xml:"shorturl,omitempty"`
+	LongURL    string         `json:"longurl,omitempty" xml:"longurl,omitempty"`
+	Link       *yourlsLink    `json:"link,omitempty" xml:"link,omitempty"`
+	DBStats    *yourlsDBStats `json:"db-stats,omitempty" xml:"db-stats,omitempty"`
+	ErrorCode  int            `json:"errorCode,omitempty" xml:"errorCode,omitempty"`
+	StatusCode int            `json:"statusCode,omitempty" xml:"statusCode,omitempty"`
+
+	// simple is the plain-text output of format=simple
+	simple string
+}
+
+type yourlsURL struct {
+	Keyword string `json:"keyword" xml:"keyword"`
+	URL     string `json:"url" xml:"url"`
+	Title   string `json:"title" xml:"title"`
+	Date    string `json:"date" xml:"date"`
+	IP      string `json:"ip" xml:"ip"`
+}
+
+type yourlsLink struct {
+	ShortURL  string `json:"shorturl" xml:"shorturl"`
+	URL       string `json:"url" xml:"url"`
+	Title     string `json:"title" xml:"title"`
+	Timestamp string `json:"timestamp" xml:"timestamp"`
+	IP        string `json:"ip" xml:"ip"`
+	Clicks    string `json:"clicks" xml:"clicks"`
+}
+
+type yourlsDBStats struct {
+	TotalLinks  string `json:"total_links" xml:"total_links"`
+	TotalClicks string `json:"total_clicks" xml:"total_clicks"`
+}
+
+// yourls implements the yourls-api.php protocol: the shorturl, expand,
+// url-stats and db-stats actions with signature or password auth.
+func (h *Handlers) yourls(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	if !h.yourlsAuthorized(r) {
+		writeYOURLS(w, r, yourlsResult{ErrorCode: stdhttp.StatusForbidden, Message: "Invalid username or password"})
+		return
+	}
+	switch r.FormValue("action") {
+	case "shorturl":
+		writeYOURLS(w, r, h.yourlsShorten(r))
+	case "expand":
+		writeYOURLS(w, r, h.yourlsExpand(r))
+	case "url-stats":
+		writeYOURLS(w, r, h.yourlsURLStats(r))
+	case "db-stats":
+		links, hits, err := h.svc.Totals(r.Context())
+		if err != nil {
+			writeYOURLS(w, r, yourlsResult{ErrorCode: stdhttp.StatusInternalServerError, Message: err.Error()})
+			return
+		}
+		writeYOURLS(w, r, yourlsResult{
+			DBStats:    &yourlsDBStats{TotalLinks: strconv.FormatInt(links, 10), TotalClicks: strconv.FormatInt(hits, 10)},
+			StatusCode: stdhttp.StatusOK,
+			Message:    "success",
+		})
+	default:
+		writeYOURLS(w, r, yourlsResult{ErrorCode: stdhttp.StatusBadRequest, Message: `Unknown or missing "action" parameter`})
+	}
+}
+
+// yourlsAuthorized accepts an API key as signature, a timestamped
+// signature hash(timestamp + key) or the admin username and password.
+func (h *Handlers) yourlsAuthorized(r *stdhttp.Request) bool {
+	signature := strings.ToLower(r.FormValue("signature"))
+	if signature == "" {
+		user, pass := r.FormValue("username"), r.FormValue("password")
+		return user != "" &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(h.cfg.Auth.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(pass), []byte(h.cfg.Auth.Password)) == 1
+	}
+	timestamp := r.FormValue("timestamp")
+	if timestamp == "" {
+		return auth.ValidAPIKey(r.FormValue("signature"))
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > yourlsNonceLife {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch r.FormValue("hash") {
+	case "", "md5":
+		newHash = md5.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	default:
+		return false
+	}
+	return auth.MatchAPIKey(func(key string) bool {
+		hh := newHash()
+		hh.Write([]byte(timestamp + key))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hh.Sum(nil))), []byte(signature)) == 1
+	})
+}
+
+func (h *Handlers) yourlsShorten(r *stdhttp.Request) yourlsResult {
+	longURL, keyword := r.FormValue("url"), r.FormValue("keyword")
+	domain, err := h.svc.DomainForHost(r.Context(), r.Host)
+	if err != nil {
+		return yourlsResult{Status: "fail", Code: "error:db", Message: err.Error(), StatusCode: stdhttp.StatusInternalServerError}
+	}
+	l, err := h.svc.ShortenWith(r.Context(), longURL, shortener.ShortenOptions{
+		Domain:     domain,
+		CustomCode: keyword,
+		Title:      r.FormValue("title"),
+	})
+	if err != nil {
+		res := yourlsResult{Status: "fail", Message: err.Error(), StatusCode: stdhttp.StatusBadRequest}
+		switch {
+		case errors.Is(err, shortener.ErrInvalidURL):
+			res.Code, res.Message = "error:nourl", "Missing or malformed URL"
+		case errors.Is(err, shortener.ErrInvalidCode), errors.Is(err, shortener.ErrBlockedCode),
+			errors.Is(err, shortener.ErrCodeExists):
+			res.Code = "error:keyword"
+			res.Message = fmt.Sprintf("Short URL %s already exists in database or is reserved", keyword)
+		default:
+			res.Code, res.StatusCode = "error:db", shortenStatus(err)
+		}
+		res.simple = res.Message
+		return res
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	shortURL := h.svc.ShortURL(l)
+	return yourlsResult{
+		URL: &yourlsURL{
+			Keyword: l.Code,
+			URL:     l.LongURL,
+			Title:   l.Title,
+			Date:    l.CreatedAt.Format(yourlsTimeLayout),
+		},
+		Status:     "success",
+		Message:    fmt.Sprintf("%s added to database", l.LongURL),
+		Title:      l.Title,
+		ShortURL:   shortURL,
+		StatusCode: stdhttp.StatusOK,
+		simple:     shortURL,
+	}
+}
+
+// yourlsLookup resolves the shorturl parameter, a keyword or short URL.
+func (h *Handlers) yourlsLookup(r *stdhttp.Request) (shortener.Link, bool, error) {
+	domain, code, err := h.svc.SplitShortURL(r.Context(), r.FormValue("shorturl"))
+	if err != nil || code == "" {
+		return shortener.Link{}, false, nil
+	}
+	return h.svc.Resolve(r.Context(), domain, code)
+}
+
+func (h *Handlers) yourlsExpand(r *stdhttp.Request) yourlsResult {
+	l, ok, err := h.yourlsLookup(r)
+	if err != nil {
+		return yourlsResult{ErrorCode: stdhttp.StatusInternalServerError, Message: err.Error()}
+	}
+	if !ok {
+		msg := "Error: short URL not found"
+		return yourlsResult{ErrorCode: stdhttp.StatusNotFound, Message: msg, Keyword: r.FormValue("shorturl"), simple: msg}
+	}
+	return yourlsResult{
+		Keyword:    l.Code,
+		ShortURL:   h.svc.ShortURL(l),
+		LongURL:    l.LongURL,
+		Title:      l.Title,
+		Message:    "success",
+		StatusCode: stdhttp.StatusOK,
+		simple:     l.LongURL,
+	}
+}
+
+func (h *Handlers) yourlsURLStats(r *stdhttp.Request) yourlsResult {
+	l, ok, err := h.yourlsLookup(r)
+	if err != nil {
+		return yourlsResult{ErrorCode: stdhttp.StatusInternalServerError, Message: err.Error()}
+	}
+	if !ok {
+		return yourlsResult{StatusCode: stdhttp.StatusNotFound, Message: "Error: short URL not found"}
+	}
+	return yourlsResult{
+		Link: &yourlsLink{
+			ShortURL:  h.svc.ShortURL(l),
+			URL:       l.LongURL,
+			Title:     l.Title,
+			Timestamp: l.CreatedAt.Format(yourlsTimeLayout),
+			Clicks:    strconv.FormatInt(l.HitCount, 10),
+		},
+		Message:    "success",
+		StatusCode: stdhttp.StatusOK,
+	}
+}
+
+// writeYOURLS writes res in the requested format: xml (the YOURLS default),
+// json, jsonp or simple.
+func writeYOURLS(w stdhttp.ResponseWriter, r *stdhttp.Request, res yourlsResult) {
+	status := res.StatusCode
+	if res.ErrorCode != 0 {
+		status = res.ErrorCode
+	}
+	switch r.FormValue("format") {
+	case "json":
+		writeJSON(w, status, res)
+	case "jsonp":
+		b, _ := json.Marshal(res)
+		callback := r.FormValue("callback")
+		if !validJSONPCallback(callback) {
+			callback = "yourls_callback"
+		}
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s(%s)", callback, b)
+	case "simple":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if res.simple != "" {
+			_, _ = w.Write([]byte(res.simple))
+		} else {
+			_, _ = w.Write([]byte(res.Message))
+		}
+	default:
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(xml.Header))
+		_ = xml.NewEncoder(w).Encode(res)
+	}
+}
+
+// validJSONPCallback reports whether name is safe to emit as a JavaScript
+// identifier path.
+func validJSONPCallback(name string) bool {
+	if name == "" || len(name) > 128 {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c == '.' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package feistel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math/bits"
+	"strings"
+
+	"tinygo/pkg/random"
+)
+
+// rounds is the number of Feistel rounds. Four rounds already give a strong
+// pseudorandom permutation; eight leaves a comfortable margin.
+const rounds = 8
+
+// maxDomain caps a tier's size so that the balanced network (at most 62 bits)
+// never overflows a uint64.
+const maxDomain = uint64(1) << 62
+
+// Codec turns monotonic sequence numbers into short codes with a keyed
+// bijective permutation, and back. Codes are grouped in tiers by length:
+// the first alphabet^minLength sequence numbers map to codes of minLength
+// characters, the next alphabet^(minLength+1) to one character more, and so
+// on. Within a tier the mapping is a Feistel permutation with cycle walking,
+// so codes never collide and look unrelated to their neighbours.
+type Codec struct {
+	key       []byte
+	alphabet  random.Alphabet
+	minLength int
+}
+
+// New creates a Codec. The key must be kept secret and stable: changing it
+// changes every code derived from it.
+func New(key []byte, alphabet random.Alphabet, minLength int) (*Codec, error) {
+	if len(key) == 0 {
+		return nil, errors.New("feistel: empty key")
+	}
+	if alphabet.Len() < 2 {
+		return nil, errors.New("feistel: alphabet needs at least 2 characters")
+	}
+	if minLength < 1 {
+		return nil, errors.New("feistel: min length must be positive")
+	}
+	return &Codec{key: key, alphabet: alphabet, minLength: minLength}, nil
+}
+
+// Encode returns the code for sequence number n.
+func (c *Codec) Encode(n uint64) string {
+	length, offset, size := c.tier(n)
+	return c.format(c.permute(length, size, n-offset, false), length)
+}
+
+// Decode returns the sequence number a code was derived from.
+func (c *Codec) Decode(code string) (uint64, bool) {
+	length := len(code)
+	if length < c.minLength {
+		return 0, false
+	}
+	var offset uint64
+	var size uint64
+	for l := c.minLength; l <= length; l++ {
+		offset += size
+		size = c.tierSize(l)
+	}
+	base := uint64(c.alphabet.Len())
+	var y uint64
+	for i := 0; i < length; i++ {
+		d := strings.IndexByte(c.alphabet.Chars(), code[i])
+		if d < 0 {
+			return 0, false
+		}
+		hi, lo := bits.Mul64(y, base)
+		if hi != 0 {
+			return 0, false
+		}
+		y = lo + uint64(d)
+	}
+	if y >= size {
+		return 0, false
+	}
+	return offset + c.permute(length, size, y, true), true
+}
+
+// tier returns the code length for n, the first sequence number of that
+// length and the number of sequence numbers in it.
+func (c *Codec) tier(n uint64) (length int, offset, size uint64) {
+	length = c.minLength
+	for {
+		size = c.tierSize(length)
+		if n-offset < size {
+			return length, offset, size
+		}
+		offset += size
+		length++
+	}
+}
+
+// tierSize returns alphabet^length capped at maxDomain.
+func (c *Codec) tierSize(length int) uint64 {
+	base := uint64(c.alphabet.Len())
+	size := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(size, base)
+		if hi != 0 || lo >= maxDomain {
+			return maxDomain
+		}
+		size = lo
+	}
+	return size
+}
+
+// format writes y as exactly length alphabet digits.
+func (c *Codec) format(y uint64, length int) string {
+	base := uint64(c.alphabet.Len())
+	chars := c.alphabet.Chars()
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = chars[y%base]
+		y /= base
+	}
+	return string(out)
+}
+
+// permute applies the keyed permutation of [0, size) for a tier (or its
+// inverse). The balanced network works on the smallest even bit width
+// covering size; results outside the domain are fed back in (cycle
+// walking), which keeps the mapping a bijection on [0, size).
+func (c *Codec) permute(length int, size, x uint64, inverse bool) uint64 {
+	width := bits.Len64(size - 1)
+	if width%2 == 1 {
+		width++
+	}
+	if width == 0 {
+		return x
+	}
+	half := uint(width / 2)
+	mask := uint64(1)<<half - 1
+	mac := hmac.New(sha256.New, c.key)
+	for {
+		left, right := x>>half, x&mask
+		if !inverse {
+			for r := 0; r < rounds; r++ {
+				left, right = right, left^c.round(mac, length, r, right)&mask
+			}
+		} else {
+			for r := rounds - 1; r >= 0; r-- {
+				left, right = right^c.round(mac, length, r, left)&mask, left
+			}
+		}
+		x = left<<half | right
+		if x < size {
+			return x
+		}
+	}
+}
+
+// round is the Feistel round function: a truncated HMAC of the tier, round
+// number and half-block.
+func (c *Codec) round(mac hash.Hash, length, r int, v uint64) uint64 {
+	var buf [16]byte
+	binary.BigEndian.PutUint32(buf[0:4], uint32(length))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(r))
+	binary.BigEndian.PutUint64(buf[8:16], v)
+	mac.Reset()
+	_, _ = mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
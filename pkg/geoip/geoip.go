@@ -0,0 +1,382 @@
+// Package geoip looks up the location of IP addresses in a MaxMind DB
+// (MMDB) file, such as GeoLite2-City, without network access.
+//
+// The file format is described at https://maxmind.github.io/MaxMind-DB/.
+// The whole file is held in memory and records are decoded on demand.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// ErrFormat is returned for files that are not valid MaxMind DBs.
+var ErrFormat = errors.New("invalid MaxMind DB")
+
+// metadataStart marks the metadata section at the end of the file.
+var metadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator is the number of zero bytes between the search tree and
+// the data section.
+const dataSeparator = 16
+
+// Location is the geographical part of a lookup result. Country is the ISO
+// 3166-1 code, Region and City are English names; fields the database does
+// not know are empty.
+type Location struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// DB is an opened MaxMind DB. It is safe for concurrent use.
+type DB struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node IPv4 lookups start at in an IPv6 tree.
+	ipv4Start uint
+	// Type is the database_type of the metadata, e.g. "GeoLite2-City".
+	Type string
+}
+
+// Open reads a MaxMind DB file.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// New parses a MaxMind DB held in memory.
+func New(buf []byte) (*DB, error) {
+	i := bytes.LastIndex(buf, metadataStart)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no metadata", ErrFormat)
+	}
+	v, _, err := (&decoder{data: buf[i+len(metadataStart):]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrFormat, err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrFormat)
+	}
+	db := &DB{
+		nodeCount:  metaUint(m, "node_count"),
+		recordSize: metaUint(m, "record_size"),
+		ipVersion:  metaUint(m, "ip_version"),
+	}
+	db.Type, _ = m["database_type"].(string)
+	if major := metaUint(m, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrFormat, major)
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrFormat, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrFormat, db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(i) {
+		return nil, fmt.Errorf("%w: search tree exceeds file", ErrFormat)
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+dataSeparator : i]
+
+	// IPv4 addresses live at ::/96 of IPv6 trees.
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Lookup returns the decoded record of the network containing ip, or false
+// if the database has none. Maps decode to map[string]any, arrays to
+// []any, unsigned integers to uint64, signed ones to int64 and floating
+// point numbers to float64.
+func (db *DB) Lookup(ip netip.Addr) (any, bool, error) {
+	ip = ip.Unmap()
+	node, bits := uint(0), 128
+	if ip.Is4() {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+		bits = 32
+	} else if db.ipVersion == 4 {
+		return nil, false, nil
+	}
+	addr := ip.AsSlice()
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		node = db.record(node, uint(addr[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, false, nil
+	case node < db.nodeCount:
+		return nil, false, fmt.Errorf("%w: search tree deeper than the address", ErrFormat)
+	}
+	offset := node - db.nodeCount - dataSeparator
+	v, _, err := (&decoder{data: db.data}).decode(offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	return v, true, nil
+}
+
+// Locate returns the location of ip as found in a GeoIP2 or GeoLite2
+// country or city database. Invalid and unknown addresses return an empty
+// location.
+func (db *DB) Locate(ip string) Location {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}
+	}
+	v, ok, err := db.Lookup(addr.WithZone(""))
+	if err != nil || !ok {
+		return Location{}
+	}
+	loc := Location{Country: str(v, "country", "iso_code"), City: str(v, "city", "names", "en")}
+	if rec, ok := v.(map[string]any); ok {
+		if subs, ok := rec["subdivisions"].([]any); ok && len(subs) > 0 {
+			loc.Region = str(subs[0], "names", "en")
+		}
+	}
+	return loc
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *DB) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+bit*4:]))
+	}
+}
+
+// str follows keys through nested maps to a string.
+func str(v any, keys ...string) string {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func metaUint(m map[string]any, key string) uint {
+	if v, ok := m[key].(uint64); ok {
+		return uint(v)
+	}
+	return 0
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds the nesting of values and pointers in malformed files.
+const maxDepth = 32
+
+var (
+	errTruncated = errors.New("truncated data")
+	errDepth     = errors.New("data nested too deeply")
+)
+
+// decoder decodes values of a data section. Pointers are offsets into
+// data.
+type decoder struct {
+	data  []byte
+	depth int
+}
+
+// decode returns the value at offset and the offset after it.
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	if d.depth++; d.depth > maxDepth {
+		return nil, 0, errDepth
+	}
+	defer func() { d.depth-- }()
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer {
+		// The value is read where the pointer points; decoding continues
+		// after the pointer itself.
+		v, _, err := d.decode(size)
+		return v, offset, err
+	}
+	return d.value(typ, size, offset)
+}
+
+// control reads the control byte(s) at offset and returns the type, the
+// payload size (the target for pointers) and the offset of the payload.
+func (d *decoder) control(offset uint) (typ int, size, next uint, err error) {
+	b, offset, err := d.read(offset, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ctrl := b[0]
+	typ = int(ctrl >> 5)
+	if typ == typePointer {
+		n := uint(ctrl>>3&3) + 1
+		if b, offset, err = d.read(offset, n); err != nil {
+			return 0, 0, 0, err
+		}
+		var p uint
+		if n < 4 {
+			p = uint(ctrl & 7)
+		}
+		for _, c := range b {
+			p = p<<8 | uint(c)
+		}
+		switch n {
+		case 2:
+			p += 2048
+		case 3:
+			p += 526336
+		}
+		return typ, p, offset, nil
+	}
+	if typ == typeExtended {
+		if b, offset, err = d.read(offset, 1); err != nil {
+			return 0, 0, 0, err
+		}
+		typ = 7 + int(b[0])
+	}
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, offset, err = d.read(offset, n); err != nil {
+			return 0, 0, 0, err
+		}
+		extra := uint(0)
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+	return typ, size, offset, nil
+}
+
+func (d *decoder) value(typ int, size, offset uint) (any, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if m[key], offset, err = d.decode(next); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeEndMarker, typeContainer:
+		return nil, offset, nil
+	}
+	b, next, err := d.read(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		// 128-bit integers are not needed for locations and stay raw.
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("integer of %d bytes", size)
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		if typ == typeInt32 {
+			return int64(int32(uint32(u))), next, nil
+		}
+		return u, next, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
+
+func (d *decoder) read(offset, n uint) ([]byte, uint, error) {
+	if offset > uint(len(d.data)) || n > uint(len(d.data))-offset {
+		return nil, 0, errTruncated
+	}
+	return d.data[offset : offset+n], offset + n, nil
+}
@@ -0,0 +1,126 @@
+// Package hll implements HyperLogLog sketches for approximate distinct
+// counting. Sketches of the same precision merge losslessly, so counts of
+// several periods can be combined without double counting.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Precision is the number of hash bits that select a register. 2^12
+// registers give a standard error of about 1.6%.
+const Precision = 12
+
+const registers = 1 << Precision
+
+// Serialization formats.
+const (
+	formatDense  = 1
+	formatSparse = 2
+)
+
+// ErrFormat is returned when unmarshaling invalid sketch data.
+var ErrFormat = errors.New("invalid HyperLogLog sketch")
+
+// Sketch is a HyperLogLog sketch. The zero value is an empty sketch.
+type Sketch struct {
+	reg [registers]uint8
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds an element by its 64-bit hash, which must be uniformly
+// distributed.
+func (s *Sketch) Add(hash uint64) {
+	i := hash >> (64 - Precision)
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1)) + 1)
+	s.reg[i] = max(s.reg[i], rank)
+}
+
+// Merge adds all elements of o to s.
+func (s *Sketch) Merge(o *Sketch) {
+	for i, r := range o.reg {
+		s.reg[i] = max(s.reg[i], r)
+	}
+}
+
+// Count estimates the number of distinct elements added.
+func (s *Sketch) Count() uint64 {
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	m := float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate for small cardinalities.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch. Sketches with few set registers are
+// stored sparsely as index and value pairs.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, r := range s.reg {
+		if r != 0 {
+			set++
+		}
+	}
+	if set*3 >= registers {
+		return append([]byte{formatDense, Precision}, s.reg[:]...), nil
+	}
+	b := make([]byte, 2, 2+set*3)
+	b[0], b[1] = formatSparse, Precision
+	for i, r := range s.reg {
+		if r != 0 {
+			b = binary.BigEndian.AppendUint16(b, uint16(i))
+			b = append(b, r)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || b[1] != Precision {
+		return ErrFormat
+	}
+	var reg [registers]uint8
+	switch b[0] {
+	case formatDense:
+		if len(b) != 2+registers {
+			return ErrFormat
+		}
+		copy(reg[:], b[2:])
+	case formatSparse:
+		if (len(b)-2)%3 != 0 {
+			return ErrFormat
+		}
+		for p := b[2:]; len(p) > 0; p = p[3:] {
+			i := binary.BigEndian.Uint16(p)
+			if i >= registers {
+				return ErrFormat
+			}
+			reg[i] = p[2]
+		}
+	default:
+		return ErrFormat
+	}
+	s.reg = reg
+	return nil
+}
@@ -0,0 +1,159 @@
+package random
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultBits is the keyspace size, in bits, of a 7-character base62 code.
+// Alphabets derive their default code length from it so that switching
+// presets keeps roughly the same collision resistance.
+var DefaultBits = 7 * math.Log2(62)
+
+// Alphabet is a set of characters codes are drawn from.
+type Alphabet struct {
+	name  string
+	chars string
+	// fold maps a character typed by a user to the alphabet, nil for none
+	fold func(byte) byte
+}
+
+// Built-in alphabet presets.
+var (
+	Base62       = NewAlphabet("base62", "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	Lowercase    = NewAlphabet("lowercase", "0123456789abcdefghijklmnopqrstuvwxyz")
+	Crockford    = Alphabet{name: "crockford", chars: "0123456789ABCDEFGHJKMNPQRSTVWXYZ", fold: crockfordFold}
+	NoLookalikes = NewAlphabet("no-lookalikes", "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ")
+)
+
+var presets = map[string]Alphabet{
+	Base62.name:       Base62,
+	Lowercase.name:    Lowercase,
+	Crockford.name:    Crockford,
+	NoLookalikes.name: NoLookalikes,
+}
+
+// NewAlphabet creates an alphabet from a set of distinct ASCII characters.
+func NewAlphabet(name, chars string) Alphabet {
+	return Alphabet{name: name, chars: chars}
+}
+
+// Lookup returns the preset with the given name.
+func Lookup(name string) (Alphabet, bool) {
+	a, ok := presets[name]
+	return a, ok
+}
+
+// Presets returns the names of all built-in presets, sorted.
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns the preset name.
+func (a Alphabet) Name() string { return a.name }
+
+// Chars returns the characters of the alphabet in order.
+func (a Alphabet) Chars() string { return a.chars }
+
+// Len returns the number of characters in the alphabet.
+func (a Alphabet) Len() int { return len(a.chars) }
+
+// Bits returns the entropy of a single character.
+func (a Alphabet) Bits() float64 { return math.Log2(float64(len(a.chars))) }
+
+// MixedCase reports whether the alphabet contains letters differing only in
+// case. Such alphabets lose keyspace when codes are matched
+// case-insensitively.
+func (a Alphabet) MixedCase() bool {
+	return strings.ToLower(a.chars) != a.chars && strings.ToUpper(a.chars) != a.chars
+}
+
+// LengthFor returns the shortest code length providing at least bits of
+// keyspace.
+func (a Alphabet) LengthFor(bits float64) int {
+	return int(math.Ceil(bits/a.Bits() - 1e-9))
+}
+
+// DefaultLength returns the code length matching DefaultBits.
+func (a Alphabet) DefaultLength() int {
+	return a.LengthFor(DefaultBits)
+}
+
+// Pattern compiles a regexp matching codes of min..max characters from the
+// alphabet plus the given extra characters.
+func (a Alphabet) Pattern(extra string, min, max int) *regexp.Regexp {
+	class := regexp.QuoteMeta(a.chars + extra)
+	return regexp.MustCompile(`^[` + class + `]{` + strconv.Itoa(min) + `,` + strconv.Itoa(max) + `}$`)
+}
+
+// Normalize maps a code typed by a user to the alphabet's spelling:
+// Crockford codes are case-insensitive and read I and L as 1 and O as 0.
+// Other alphabets leave codes unchanged.
+func (a Alphabet) Normalize(code string) string {
+	if a.fold == nil {
+		return code
+	}
+	b := []byte(code)
+	for i, c := range b {
+		b[i] = a.fold(c)
+	}
+	return string(b)
+}
+
+// crockfordFold applies Crockford's base32 decoding rules to c.
+func crockfordFold(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'I', 'L':
+		return '1'
+	case 'O':
+		return '0'
+	}
+	return c
+}
+
+// Code generates a random string of the given length from the alphabet.
+// It uses crypto/rand with rejection sampling, so every character is
+// uniformly distributed without allocating per character.
+func (a Alphabet) Code(length int) (string, error) {
+	if length <= 0 {
+		return "", nil
+	}
+	n := len(a.chars)
+	if n == 0 || n > 256 {
+		return "", errors.New("random: alphabet must have 1 to 256 characters")
+	}
+	// Bytes at or above limit would bias the modulo and are discarded.
+	limit := 256 - 256%n
+	out := make([]byte, length)
+	// Over-read a little so that one read usually suffices.
+	buf := make([]byte, length+length/2+8)
+	for i := 0; i < length; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			out[i] = a.chars[int(b)%n]
+			i++
+			if i == length {
+				break
+			}
+		}
+	}
+	return string(out), nil
+}
@@ -0,0 +1,123 @@
+package random
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// digits is used for the number suffix of word codes.
+var digits = NewAlphabet("digits", "0123456789")
+
+// WordOptions configures word-based codes such as "brave-otter-42".
+type WordOptions struct {
+	// Words is the number of words; all but the last are adjectives.
+	Words int
+	// Separator joins words and the number suffix.
+	Separator string
+	// Digits is the length of the number suffix; zero omits it.
+	Digits int
+}
+
+// DefaultWordOptions returns two words and a two-digit suffix.
+func DefaultWordOptions() WordOptions {
+	return WordOptions{Words: 2, Separator: "-", Digits: 2}
+}
+
+// MaxLength returns the longest code Words can produce with o.
+func (o WordOptions) MaxLength() int {
+	if o.Words <= 0 {
+		return 0
+	}
+	n := (o.Words-1)*maxLen(adjectives) + maxLen(nouns) + (o.Words-1)*len(o.Separator)
+	if o.Digits > 0 {
+		n += len(o.Separator) + o.Digits
+	}
+	return n
+}
+
+// Words generates a pronounceable code from the built-in word lists.
+func Words(o WordOptions) (string, error) {
+	if o.Words <= 0 {
+		return "", errors.New("random: word count must be positive")
+	}
+	parts := make([]string, 0, o.Words+1)
+	for i := 0; i < o.Words; i++ {
+		list := adjectives
+		if i == o.Words-1 {
+			list = nouns
+		}
+		n, err := intn(len(list))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, list[n])
+	}
+	if o.Digits > 0 {
+		suffix, err := digits.Code(o.Digits)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, suffix)
+	}
+	return strings.Join(parts, o.Separator), nil
+}
+
+// intn returns a uniform random number in [0, n).
+func intn(n int) (int, error) {
+	limit := ^uint32(0) - ^uint32(0)%uint32(n)
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if v := binary.BigEndian.Uint32(b[:]); v < limit {
+			return int(v % uint32(n)), nil
+		}
+	}
+}
+
+func maxLen(list []string) int {
+	n := 0
+	for _, w := range list {
+		if len(w) > n {
+			n = len(w)
+		}
+	}
+	return n
+}
+
+var adjectives = []string{
+	"able", "agile", "amber", "ample", "azure", "bold", "brave", "breezy",
+	"bright", "brisk", "calm", "candid", "cheery", "civil", "clean", "clever",
+	"cosmic", "cozy", "crisp", "curly", "daring", "dapper", "deft", "eager",
+	"early", "earnest", "easy", "epic", "fair", "fancy", "fast", "fluffy",
+	"fond", "frank", "fresh", "gentle", "giddy", "glad", "golden", "grand",
+	"green", "happy", "hardy", "hasty", "hearty", "honest", "humble", "jolly",
+	"jovial", "keen", "kind", "lively", "loyal", "lucky", "lunar", "mellow",
+	"merry", "mighty", "misty", "modest", "neat", "nimble", "noble", "polite",
+	"prime", "proud", "quick", "quiet", "rapid", "ready", "regal", "rosy",
+	"royal", "rustic", "sandy", "shiny", "silent", "silver", "simple",
+	"sleek", "smart", "snowy", "solar", "solid", "sonic", "spry", "steady",
+	"sunny", "super", "swift", "tidy", "tranquil", "trusty",
+	"urban", "vast", "vivid", "warm", "wise", "witty", "young", "zesty",
+	"zippy",
+}
+
+var nouns = []string{
+	"acorn", "alpaca", "anchor", "apple", "aspen", "badger", "bagel",
+	"beacon", "bear", "beaver", "bison", "breeze", "brook", "cactus", "camel",
+	"canyon", "cedar", "cheetah", "cherry", "cloud", "comet", "coral",
+	"cougar", "crane", "creek", "dolphin", "dove", "eagle", "echo", "ember",
+	"falcon", "fern", "finch", "fjord", "forest", "fox", "galaxy", "garden",
+	"gecko", "geyser", "glacier", "harbor", "hawk", "hazel", "heron", "hippo",
+	"island", "jaguar", "koala", "lagoon", "lark", "lemon", "lemur", "lily",
+	"lion", "lotus", "lynx", "maple", "meadow", "meteor", "moose", "nebula",
+	"oak", "ocean", "olive", "orbit", "orca", "osprey", "otter", "owl",
+	"panda", "parrot", "pebble", "pepper", "pine", "planet", "plum", "pony",
+	"prairie", "puffin", "quail", "rabbit", "raven", "reef", "river", "robin",
+	"rocket", "salmon", "sparrow", "spruce", "squid", "summit", "swan",
+	"thistle", "tiger", "trout", "tulip", "tundra", "turtle", "valley",
+	"violet", "walrus", "willow", "wolf", "wren", "yak", "zebra",
+}
@@ -0,0 +1,199 @@
+// Package useragent classifies User-Agent strings into browser, operating
+// system and device class using ordered regular-expression rules.
+package useragent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Device classes.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+)
+
+// Request classes.
+const (
+	Human = "human"
+	// Crawler is an automated client: search engines, monitors, scripts.
+	Crawler = "bot"
+	// Preview is a link unfurler fetching a page to show a preview of it.
+	Preview = "preview"
+)
+
+// Other names a browser or operating system no rule recognized.
+const Other = "Other"
+
+//go:embed rules.json
+var builtinRules []byte
+
+// Agent is a parsed User-Agent.
+type Agent struct {
+	// Browser is the browser family, or the crawler name for bots.
+	Browser string
+	// BrowserVersion is the major version, empty if unknown.
+	BrowserVersion string
+	OS             string
+	// Device is one of Desktop, Mobile, Tablet or Bot.
+	Device string
+	// Class is one of Human, Crawler or Preview.
+	Class string
+}
+
+// Rule matches a User-Agent by regular expression. The first non-empty
+// capture group of Pattern, if any, is the version. A rule with Exclude
+// does not match User-Agents that also match Exclude.
+type Rule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Exclude string `json:"exclude,omitempty"`
+
+	pattern *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// Rules is the rule file format. Within each list the first matching rule
+// wins. Previews are checked before bots; both name the client. Device
+// rules name the device class; User-Agents matching no device rule are
+// desktops.
+type Rules struct {
+	Previews []Rule `json:"previews"`
+	Bots     []Rule `json:"bots"`
+	Browsers []Rule `json:"browsers"`
+	OS       []Rule `json:"os"`
+	Devices  []Rule `json:"devices"`
+}
+
+// Parser classifies User-Agents.
+type Parser struct {
+	rules Rules
+}
+
+// Builtin returns a parser with the embedded rules.
+func Builtin() *Parser {
+	p, err := New(builtinRules)
+	if err != nil {
+		panic(fmt.Sprintf("useragent: builtin rules: %v", err))
+	}
+	return p
+}
+
+// New creates a parser from rules in the JSON rule file format.
+func New(data []byte) (*Parser, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for _, list := range []struct {
+		name  string
+		rules []Rule
+	}{{"previews", rules.Previews}, {"bots", rules.Bots}, {"browsers", rules.Browsers}, {"os", rules.OS}, {"devices", rules.Devices}} {
+		for i := range list.rules {
+			if err := list.rules[i].compile(); err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", list.name, i, err)
+			}
+		}
+	}
+	for _, r := range rules.Devices {
+		switch r.Name {
+		case Desktop, Mobile, Tablet, Bot:
+		default:
+			return nil, fmt.Errorf("devices: unknown device class %q", r.Name)
+		}
+	}
+	return &Parser{rules: rules}, nil
+}
+
+// Load creates a parser with the embedded rules. When path is set, the
+// rules of that file are checked before the embedded ones, so it can add
+// new browsers or override existing rules without a rebuild.
+func Load(path string) (*Parser, error) {
+	p := Builtin()
+	if path == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := New(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.rules = Rules{
+		Previews: append(custom.rules.Previews, p.rules.Previews...),
+		Bots:     append(custom.rules.Bots, p.rules.Bots...),
+		Browsers: append(custom.rules.Browsers, p.rules.Browsers...),
+		OS:       append(custom.rules.OS, p.rules.OS...),
+		Devices:  append(custom.rules.Devices, p.rules.Devices...),
+	}
+	return p, nil
+}
+
+// Parse classifies a User-Agent. An empty User-Agent is a bot: browsers
+// always send one.
+func (p *Parser) Parse(ua string) Agent {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Agent{Browser: Other, OS: Other, Device: Bot, Class: Crawler}
+	}
+	a := Agent{Browser: Other, OS: Other, Device: Desktop, Class: Human}
+	if r, _, ok := match(p.rules.OS, ua); ok {
+		a.OS = r.Name
+	}
+	if r, _, ok := match(p.rules.Previews, ua); ok {
+		a.Browser, a.Device, a.Class = r.Name, Bot, Preview
+		return a
+	}
+	if r, _, ok := match(p.rules.Bots, ua); ok {
+		a.Browser, a.Device, a.Class = r.Name, Bot, Crawler
+		return a
+	}
+	if r, version, ok := match(p.rules.Browsers, ua); ok {
+		a.Browser, a.BrowserVersion = r.Name, version
+	}
+	if r, _, ok := match(p.rules.Devices, ua); ok {
+		a.Device = r.Name
+	}
+	return a
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+	var err error
+	if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+		return err
+	}
+	if r.Exclude != "" {
+		if r.exclude, err = regexp.Compile(r.Exclude); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match returns the first rule matching ua and the version it captured.
+func match(rules []Rule, ua string) (Rule, string, bool) {
+	for _, r := range rules {
+		m := r.pattern.FindStringSubmatch(ua)
+		if m == nil || r.exclude != nil && r.exclude.MatchString(ua) {
+			continue
+		}
+		for _, g := range m[1:] {
+			if g != "" {
+				return r, g, true
+			}
+		}
+		return r, "", true
+	}
+	return Rule{}, "", false
+}
@@ -0,0 +1,216 @@
+package wordfilter
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minWordLength is the shortest folded word that is checked. Shorter entries
+// would match a large share of random codes.
+const minWordLength = 3
+
+//go:embed lists/*.txt
+var builtin embed.FS
+
+// Filter reports whether text contains a blocked word. Both the wordlist and
+// the checked text are folded the same way, so case, accents and leetspeak
+// substitutions ("5h1t", "SHIT", "sh_it") do not bypass it.
+type Filter struct {
+	words []string
+	set   map[string]bool
+}
+
+// New creates a Filter from the given words.
+func New(words []string) *Filter {
+	f := &Filter{set: make(map[string]bool, len(words))}
+	for _, w := range words {
+		w = Fold(w)
+		if len(w) < minWordLength || f.set[w] {
+			continue
+		}
+		f.set[w] = true
+		f.words = append(f.words, w)
+	}
+	sort.Strings(f.words)
+	return f
+}
+
+// Load creates a Filter from wordlist files. Each path may be a file or a
+// directory, in which case all *.txt files in it are read. When withBuiltin
+// is true, the embedded multilingual lists are included as well.
+func Load(withBuiltin bool, paths ...string) (*Filter, error) {
+	var words []string
+	if withBuiltin {
+		entries, err := fs.Glob(builtin, "lists/*.txt")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range entries {
+			f, err := builtin.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			words, err = readWords(f, words)
+			_ = f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+		}
+	}
+	for _, p := range paths {
+		files, err := listFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range files {
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			words, err = readWords(f, words)
+			_ = f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+		}
+	}
+	return New(words), nil
+}
+
+func listFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	return filepath.Glob(filepath.Join(path, "*.txt"))
+}
+
+// readWords appends non-empty, non-comment lines from r to words.
+func readWords(r io.Reader, words []string) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, sc.Err()
+}
+
+// Len returns the number of distinct folded words in the filter.
+func (f *Filter) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.words)
+}
+
+// Match returns the first blocked word contained in s.
+func (f *Filter) Match(s string) (string, bool) {
+	if f == nil || len(f.words) == 0 {
+		return "", false
+	}
+	folded := Fold(s)
+	for _, w := range f.words {
+		if strings.Contains(folded, w) {
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// Blocked reports whether s contains a blocked word.
+func (f *Filter) Blocked(s string) bool {
+	_, ok := f.Match(s)
+	return ok
+}
+
+// MatchToken returns the first word of s that is a blocked word. Words
+// are separated by characters Fold drops, such as dashes and underscores,
+// and by a lowercase letter followed by an uppercase one. Unlike Match it
+// leaves blocked words within longer ones alone ("grape", "scunthorpe"),
+// which suits codes people choose.
+func (f *Filter) MatchToken(s string) (string, bool) {
+	if f == nil || len(f.set) == 0 {
+		return "", false
+	}
+	for _, token := range tokens(s) {
+		if w := Fold(token); f.set[w] {
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// BlockedToken reports whether a word of s is a blocked word.
+func (f *Filter) BlockedToken(s string) bool {
+	_, ok := f.MatchToken(s)
+	return ok
+}
+
+// tokens splits s into words for MatchToken.
+func tokens(s string) []string {
+	var out []string
+	start := -1
+	var prev rune
+	for i, r := range s {
+		_, leet := foldMap[r]
+		word := leet || unicode.IsLetter(r) || unicode.IsDigit(r)
+		if start >= 0 && (!word || unicode.IsLower(prev) && unicode.IsUpper(r)) {
+			out = append(out, s[start:i])
+			start = -1
+		}
+		if word && start < 0 {
+			start = i
+		}
+		prev = r
+	}
+	if start >= 0 {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// Fold lowercases s, maps accented letters and leetspeak digits/symbols to
+// their base letters and drops everything that is not a letter. Letters that
+// leetspeak uses interchangeably (i, l, 1, !) fold to the same character.
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range strings.ToLower(s) {
+		if m, ok := foldMap[r]; ok {
+			r = m
+		}
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var foldMap = map[rune]rune{
+	'4': 'a', '@': 'a', 'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a', 'å': 'a',
+	'8': 'b',
+	'ç': 'c',
+	'3': 'e', '€': 'e', 'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'6': 'g', '9': 'g',
+	'1': 'i', '!': 'i', '|': 'i', 'l': 'i', 'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+	'ñ': 'n',
+	'0': 'o', 'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o',
+	'5': 's', '$': 's', 'ß': 's',
+	'7': 't', '+': 't',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+	'2': 'z',
+}
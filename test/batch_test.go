@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+)
+
+func TestService_ShortenBatch(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	ctx := context.Background()
+	if _, err := svc.Shorten(ctx, "https://taken.example", "taken"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	items := []shortener.BatchItem{
+		{LongURL: "https://a.example"},
+		{LongURL: "https://b.example", ShortenOptions: shortener.ShortenOptions{CustomCode: "bee"}},
+		{LongURL: "not a url"},
+		{LongURL: "https://c.example", ShortenOptions: shortener.ShortenOptions{CustomCode: "taken"}},
+		{LongURL: "https://d.example", ShortenOptions: shortener.ShortenOptions{CustomCode: "bee"}},
+	}
+
+	// All-or-nothing: nothing is created when any item fails.
+	results, err := svc.ShortenBatch(ctx, items, true)
+	if err != nil {
+		t.Fatalf("atomic batch: %v", err)
+	}
+	if !errors.Is(results[0].Err, shortener.ErrBatchAborted) || !errors.Is(results[2].Err, shortener.ErrInvalidURL) {
+		t.Fatalf("unexpected atomic results: %+v", results)
+	}
+	if n, _ := st.Store.Count(ctx); n != 1 {
+		t.Fatalf("atomic batch left %d links, want 1", n)
+	}
+
+	results, err = svc.ShortenBatch(ctx, items, false)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if results[0].Err != nil || results[0].Link.Code == "" || results[1].Err != nil || results[1].Link.Code != "bee" {
+		t.Fatalf("unexpected successes: %+v", results[:2])
+	}
+	if !errors.Is(results[2].Err, shortener.ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", results[2].Err)
+	}
+	for _, i := range []int{3, 4} {
+		if !errors.Is(results[i].Err, shortener.ErrCodeExists) {
+			t.Fatalf("item %d: expected ErrCodeExists, got %v", i, results[i].Err)
+		}
+	}
+	if n, _ := st.Store.Count(ctx); n != 3 {
+		t.Fatalf("expected 3 links, got %d", n)
+	}
+}
+
+func TestService_ShortenBatchRetriesCollisions(t *testing.T) {
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	svc := shortener.NewService(store, "http://localhost:8080", 6)
+	// Every item starts with the same candidate, so all but one collide
+	// within the batch and must retry.
+	calls := 0
+	svc.RegisterGenerator(shortener.StrategyRandom, shortener.GeneratorFunc(
+		func(ctx context.Context, longURL string, attempt int) (string, error) {
+			if attempt == 0 {
+				return "same", nil
+			}
+			calls++
+			return fmt.Sprintf("code%d", calls), nil
+		}))
+	items := make([]shortener.BatchItem, 4)
+	for i := range items {
+		items[i].LongURL = fmt.Sprintf("https://example.com/%d", i)
+	}
+
+	for _, atomic := range []bool{false, true} {
+		results, err := svc.ShortenBatch(context.Background(), items, atomic)
+		if err != nil {
+			t.Fatalf("atomic=%v: %v", atomic, err)
+		}
+		seen := make(map[string]bool)
+		for i, res := range results {
+			if res.Err != nil {
+				t.Fatalf("atomic=%v item %d: %v", atomic, i, res.Err)
+			}
+			if seen[res.Link.Code] {
+				t.Fatalf("atomic=%v: duplicate code %s", atomic, res.Link.Code)
+			}
+			seen[res.Link.Code] = true
+		}
+	}
+	if n, _ := store.Count(context.Background()); n != 8 {
+		t.Fatalf("expected 8 links, got %d", n)
+	}
+}
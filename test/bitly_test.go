@@ -0,0 +1,92 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tinygo/internal/config"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	httphandler "tinygo/internal/transport/http"
+)
+
+func bitlyCall(t *testing.T, srv *httptest.Server, token, method, path, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+"/v4"+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			t.Fatalf("decode %s: %v", b, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestBitly_ShortenExpandBitlink(t *testing.T) {
+	logger.Init("error", "text")
+	cfg := config.Default()
+	cfg.Auth.APIKeys = []string{"s3cret"}
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	srv := httptest.NewServer(httphandler.NewMux(httphandler.Services{Links: svc}, cfg))
+	defer srv.Close()
+
+	var created struct {
+		Link    string `json:"link"`
+		ID      string `json:"id"`
+		LongURL string `json:"long_url"`
+	}
+	status := bitlyCall(t, srv, "s3cret", "POST", "/shorten", `{"long_url":"https://example.com/page","domain":"bit.ly"}`, &created)
+	if status != http.StatusCreated || created.LongURL != "https://example.com/page" || created.ID != "localhost:8080/"+created.Link[len("http://localhost:8080/"):] {
+		t.Fatalf("shorten: %d %+v", status, created)
+	}
+
+	var expanded struct {
+		LongURL string `json:"long_url"`
+	}
+	status = bitlyCall(t, srv, "s3cret", "POST", "/expand", `{"bitlink_id":"`+created.ID+`"}`, &expanded)
+	if status != http.StatusOK || expanded.LongURL != created.LongURL {
+		t.Fatalf("expand: %d %+v", status, expanded)
+	}
+
+	var updated struct {
+		Title   string `json:"title"`
+		LongURL string `json:"long_url"`
+	}
+	status = bitlyCall(t, srv, "s3cret", "PATCH", "/bitlinks/"+created.ID, `{"title":"Landing"}`, &updated)
+	if status != http.StatusOK || updated.Title != "Landing" || updated.LongURL != created.LongURL {
+		t.Fatalf("patch: %d %+v", status, updated)
+	}
+	status = bitlyCall(t, srv, "s3cret", "GET", "/bitlinks/"+created.ID, "", &updated)
+	if status != http.StatusOK || updated.Title != "Landing" {
+		t.Fatalf("get: %d %+v", status, updated)
+	}
+
+	var failure struct {
+		Message string `json:"message"`
+	}
+	if status := bitlyCall(t, srv, "s3cret", "POST", "/shorten", `{"long_url":"nope"}`, &failure); status != http.StatusBadRequest ||
+		failure.Message != "INVALID_ARG_LONG_URL" {
+		t.Fatalf("invalid url: %d %+v", status, failure)
+	}
+	if status := bitlyCall(t, srv, "s3cret", "GET", "/bitlinks/bit.ly/missing", "", &failure); status != http.StatusNotFound {
+		t.Fatalf("missing: %d %+v", status, failure)
+	}
+	if status := bitlyCall(t, srv, "wrong", "POST", "/expand", `{"bitlink_id":"`+created.ID+`"}`, &failure); status != http.StatusForbidden ||
+		failure.Message != "FORBIDDEN" {
+		t.Fatalf("auth: %d %+v", status, failure)
+	}
+}
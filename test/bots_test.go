@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/config"
+	"tinygo/internal/shortener"
+)
+
+func TestBotFilter(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	ctx := context.Background()
+	if _, err := env.links.Shorten(ctx, "https://example.com/launch", "launch"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	for _, headers := range []map[string]string{
+		{"User-Agent": uaChromeWindows},
+		{"User-Agent": uaSafariIPhone},
+		{"User-Agent": "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+		{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"},
+		{"User-Agent": uaChromeWindows, "Sec-Purpose": "prefetch"},
+		{"User-Agent": uaChromeWindows, "Accept": "", "Accept-Language": ""},
+	} {
+		env.visit(t, "launch", headers)
+	}
+	if status := env.head(t, "launch"); status != http.StatusFound {
+		t.Fatalf("head: %d", status)
+	}
+
+	l, _, _ := env.links.Resolve(ctx, "", "launch")
+	if l.HitCount != 2 || l.BotHitCount != 5 {
+		t.Fatalf("hits = %d, bot hits = %d; want 2, 5", l.HitCount, l.BotHitCount)
+	}
+	var classes analytics.Tree
+	if status := env.getJSON(t, "/api/links/launch/stats/classes", &classes); status != http.StatusOK {
+		t.Fatalf("classes: %d", status)
+	}
+	want := map[string]int64{"bot": 3, "human": 2, "preview": 2}
+	if classes.Total != 7 || len(classes.Items) != len(want) {
+		t.Fatalf("unexpected classes: %+v", classes)
+	}
+	for _, it := range classes.Items {
+		if want[it.Value] != it.Clicks {
+			t.Fatalf("unexpected classes: %+v", classes)
+		}
+	}
+
+	// Only human clicks count as visitors
+	var stats analytics.VisitorStats
+	if status := env.getJSON(t, "/api/links/launch/stats", &stats); status != http.StatusOK || stats.UniqueVisitors != 2 {
+		t.Fatalf("visitors: %d %+v", status, stats)
+	}
+}
+
+func TestStats_ClassFilter(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/", "mixed"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	env.visit(t, "mixed", map[string]string{"User-Agent": uaChromeWindows})
+	env.visit(t, "mixed", map[string]string{"User-Agent": uaSafariIPhone})
+	env.visit(t, "mixed", map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"})
+
+	var tree analytics.Tree
+	if status := env.getJSON(t, "/api/links/mixed/stats/browsers?class=human", &tree); status != http.StatusOK || tree.Total != 2 {
+		t.Fatalf("human browsers: %d %+v", status, tree)
+	}
+	if status := env.getJSON(t, "/api/stats/devices?class=bot", &tree); status != http.StatusOK || tree.Total != 1 {
+		t.Fatalf("bot devices: %d %+v", status, tree)
+	}
+	var stats analytics.VisitorStats
+	if status := env.getJSON(t, "/api/links/mixed/stats?class=bot", &stats); status != http.StatusOK || stats.Clicks != 1 {
+		t.Fatalf("bot stats: %d %+v", status, stats)
+	}
+	for _, path := range []string{"/api/links/mixed/stats/os?class=alien", "/api/stats/classes?class=alien"} {
+		if status := env.getJSON(t, path, &tree); status != http.StatusBadRequest {
+			t.Fatalf("%s: %d", path, status)
+		}
+	}
+}
+
+func TestBotFilter_IgnoreHead(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) { cfg.BotFilter.IgnoreHead = true })
+	ctx := context.Background()
+	if _, err := env.links.Shorten(ctx, "https://example.com/", "quiet"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if status := env.head(t, "quiet"); status != http.StatusFound {
+		t.Fatalf("head: %d", status)
+	}
+	if status := env.head(t, "missing"); status != http.StatusNotFound {
+		t.Fatalf("head missing: %d", status)
+	}
+	l, _, _ := env.links.Resolve(ctx, "", "quiet")
+	n, err := env.analytics.Count(ctx, analytics.Query{Code: "quiet"})
+	if l.HitCount != 0 || l.BotHitCount != 0 || err != nil || n != 0 {
+		t.Fatalf("HEAD was counted: %+v, %d clicks, %v", l, n, err)
+	}
+}
+
+func TestBotFilter_Disabled(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) { cfg.BotFilter.Enabled = false })
+	ctx := context.Background()
+	if _, err := env.links.Shorten(ctx, "https://example.com/", "all"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	env.visit(t, "all", map[string]string{"User-Agent": "curl/8.4.0"})
+	if l, _, _ := env.links.Resolve(ctx, "", "all"); l.HitCount != 1 || l.BotHitCount != 0 {
+		t.Fatalf("unexpected counts: %+v", l)
+	}
+}
+
+func TestBotHitCount_KeptOnEdit(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	if _, err := svc.Shorten(ctx, "https://example.com/", "keep"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := svc.BotHit(ctx, "", "keep"); err != nil {
+		t.Fatalf("bot hit: %v", err)
+	}
+	title := "Kept"
+	l, ok, err := svc.Edit(ctx, "", "keep", shortener.LinkPatch{Title: &title})
+	if err != nil || !ok || l.BotHitCount != 1 || l.HitCount != 0 {
+		t.Fatalf("edit lost bot hits: %+v %v", l, err)
+	}
+}
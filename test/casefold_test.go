@@ -0,0 +1,68 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tinygo/internal/shortener"
+)
+
+type caseStore interface {
+	shortener.Store
+	shortener.CaseInsensitiveStore
+}
+
+func TestStore_CaseInsensitiveLookup(t *testing.T) {
+	st := newTempStore(t).Store.(caseStore)
+	st.SetCaseInsensitive(true)
+	ctx := context.Background()
+
+	if err := st.Create(ctx, shortener.Link{Code: "MyCode", LongURL: "https://golang.org"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	l, ok, err := st.Get(ctx, "", "mycode")
+	if err != nil || !ok || l.Code != "MyCode" {
+		t.Fatalf("get: %+v ok=%v err=%v", l, ok, err)
+	}
+	if _, err := st.IncrementHit(ctx, "", "MYCODE"); err != nil {
+		t.Fatalf("increment: %v", err)
+	}
+	if err := st.Create(ctx, shortener.Link{Code: "mycode", LongURL: "https://example.org"}); !errors.Is(err, shortener.ErrCodeExists) {
+		t.Fatalf("expected ErrCodeExists, got %v", err)
+	}
+}
+
+func TestStore_MigrateCodeKeysDetectsCollisions(t *testing.T) {
+	st := newTempStore(t).Store.(caseStore)
+	ctx := context.Background()
+	for _, code := range []string{"Abc", "abc", "ABC", "xyz"} {
+		if err := st.Create(ctx, shortener.Link{Code: code, LongURL: "https://golang.org"}); err != nil {
+			t.Fatalf("create %s: %v", code, err)
+		}
+	}
+
+	st.SetCaseInsensitive(true)
+	collisions, err := st.MigrateCodeKeys(ctx)
+	if !errors.Is(err, shortener.ErrCaseCollision) {
+		t.Fatalf("expected ErrCaseCollision, got %v", err)
+	}
+	if len(collisions) != 1 || collisions[0].Key != "abc" || len(collisions[0].Codes) != 3 {
+		t.Fatalf("unexpected collisions: %+v", collisions)
+	}
+
+	// Removing the duplicates lets the migration through.
+	st.SetCaseInsensitive(false)
+	for _, code := range []string{"abc", "ABC"} {
+		if err := st.Delete(ctx, "", code); err != nil {
+			t.Fatalf("delete %s: %v", code, err)
+		}
+	}
+	st.SetCaseInsensitive(true)
+	if _, err := st.MigrateCodeKeys(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, ok, _ := st.Get(ctx, "", "XYZ"); !ok {
+		t.Fatal("expected migrated key to match case-insensitively")
+	}
+}
@@ -0,0 +1,354 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/config"
+	"tinygo/internal/hits"
+	"tinygo/internal/live"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+	httphandler "tinygo/internal/transport/http"
+	"tinygo/pkg/geoip"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// analyticsEnv is a server with click analytics and a logged-in client
+// that does not follow redirects. Redirects are counted before responding
+// unless configure enables the hit queue.
+type analyticsEnv struct {
+	srv       *httptest.Server
+	client    *http.Client
+	links     *shortener.Service
+	analytics *analytics.Service
+	hits      *hits.Queue
+	live      *live.Broker
+}
+
+func newAnalyticsEnv(t *testing.T, configure func(*config.Config)) *analyticsEnv {
+	t.Helper()
+	logger.Init("error", "text")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&shortener.Link{}, &shortener.Counter{}, &analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}, &analytics.RollupMark{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	store := storage.NewGormStore()
+	store.SetDB(db)
+
+	cfg := config.Default()
+	cfg.Auth.Username, cfg.Auth.Password = "admin", "secret"
+	cfg.HitQueue.Enabled = false
+	if configure != nil {
+		configure(&cfg)
+	}
+	env := &analyticsEnv{
+		links:     shortener.NewService(store, "http://localhost:8080", 6),
+		analytics: analytics.NewService(store),
+	}
+	if cfg.Analytics.GeoIPDB != "" {
+		geo, err := geoip.Open(cfg.Analytics.GeoIPDB)
+		if err != nil {
+			t.Fatalf("open geoip: %v", err)
+		}
+		env.analytics.SetGeoIP(geo)
+	}
+	if cfg.HitQueue.Enabled {
+		env.hits, err = hits.New(env.links, env.analytics, hits.Options{
+			Size:          cfg.HitQueue.Size,
+			FlushInterval: time.Duration(cfg.HitQueue.FlushIntervalMS) * time.Millisecond,
+			BatchSize:     cfg.HitQueue.BatchSize,
+			Policy:        hits.Policy(cfg.HitQueue.DropPolicy),
+		})
+		if err != nil {
+			t.Fatalf("hit queue: %v", err)
+		}
+		t.Cleanup(func() { env.hits.Close(context.Background()) })
+	}
+	if cfg.Live.Enabled {
+		env.live = live.NewBroker(live.Options{Buffer: cfg.Live.Buffer, MaxSubscribers: cfg.Live.MaxSubscribers})
+	}
+	env.srv = httptest.NewServer(httphandler.NewMux(httphandler.Services{Links: env.links, Analytics: env.analytics, Hits: env.hits, Live: env.live}, cfg))
+	t.Cleanup(env.srv.Close)
+	if env.live != nil {
+		// Ends open streams, which the server waits for when closing
+		t.Cleanup(env.live.Close)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	env.client = &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := env.client.PostForm(env.srv.URL+"/login", url.Values{"username": {"admin"}, "password": {"secret"}})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	return env
+}
+
+// visit follows a short link with the given request headers, on top of
+// the Accept headers browsers send.
+func (e *analyticsEnv) visit(t *testing.T, code string, headers map[string]string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", e.srv.URL+"/"+code, nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Language", "en")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		t.Fatalf("visit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("visit %s: status %d", code, resp.StatusCode)
+	}
+}
+
+// head sends a HEAD request for a short link and returns the status.
+func (e *analyticsEnv) head(t *testing.T, code string) int {
+	t.Helper()
+	req, _ := http.NewRequest("HEAD", e.srv.URL+"/"+code, nil)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		t.Fatalf("head: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// getJSON decodes the response of an API GET request into out.
+func (e *analyticsEnv) getJSON(t *testing.T, path string, out any) int {
+	t.Helper()
+	resp, err := e.client.Get(e.srv.URL + path)
+	if err != nil {
+		t.Fatalf("get %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(b, out); err != nil {
+			t.Fatalf("decode %s: %v", b, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestClicks_RecordedAndPaginated(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Analytics.TrustProxy = true
+		// A load balancer in front of the reverse proxy
+		cfg.Analytics.TrustedHops = 2
+		cfg.Auth.APIKeys = []string{"s3cret"}
+	})
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/landing", "launch"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	for _, ref := range []string{"https://news.ycombinator.com/", "https://www.google.com/", ""} {
+		env.visit(t, "launch", map[string]string{
+			"Referer":         ref,
+			"User-Agent":      "test-agent",
+			"X-Forwarded-For": "203.0.113.77, 10.0.0.1",
+		})
+	}
+
+	var page analytics.Page
+	if status := env.getJSON(t, "/api/links/launch/clicks?limit=2", &page); status != http.StatusOK {
+		t.Fatalf("clicks: %d", status)
+	}
+	if len(page.Clicks) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	first := page.Clicks[0]
+	if first.Referrer != "" || first.UserAgent != "test-agent" || first.IP != "203.0.113.0" ||
+		first.Destination != "https://example.com/landing" {
+		t.Fatalf("unexpected newest click: %+v", first)
+	}
+
+	var next analytics.Page
+	if status := env.getJSON(t, "/api/links/launch/clicks?limit=2&cursor="+page.NextCursor, &next); status != http.StatusOK {
+		t.Fatalf("clicks page 2: %d", status)
+	}
+	if len(next.Clicks) != 1 || next.NextCursor != "" || next.Clicks[0].Referrer != "https://news.ycombinator.com/" {
+		t.Fatalf("unexpected second page: %+v", next)
+	}
+
+	from := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	var empty analytics.Page
+	if status := env.getJSON(t, "/api/links/launch/clicks?from="+from, &empty); status != http.StatusOK || len(empty.Clicks) != 0 {
+		t.Fatalf("future range: %d %+v", status, empty)
+	}
+	if status := env.getJSON(t, "/api/links/launch/clicks?cursor=%21", nil); status != http.StatusBadRequest {
+		t.Fatalf("bad cursor: %d", status)
+	}
+	if status := env.getJSON(t, "/api/links/missing/clicks", nil); status != http.StatusNotFound {
+		t.Fatalf("missing link: %d", status)
+	}
+
+	// The Shlink visits endpoint serves the same events
+	var visits struct {
+		Visits struct {
+			Data []struct {
+				Referer    string `json:"referer"`
+				VisitedURL string `json:"visitedUrl"`
+			} `json:"data"`
+			Pagination struct {
+				PagesCount int   `json:"pagesCount"`
+				TotalItems int64 `json:"totalItems"`
+			} `json:"pagination"`
+		} `json:"visits"`
+	}
+	req, _ := http.NewRequest("GET", env.srv.URL+"/rest/v3/short-urls/launch/visits?page=2&itemsPerPage=2", nil)
+	req.Header.Set("X-Api-Key", "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("visits: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&visits); err != nil {
+		t.Fatalf("decode visits: %v", err)
+	}
+	v := visits.Visits
+	if v.Pagination.TotalItems != 3 || v.Pagination.PagesCount != 2 || len(v.Data) != 1 ||
+		v.Data[0].Referer != "https://news.ycombinator.com/" || v.Data[0].VisitedURL != "http://localhost:8080/launch" {
+		t.Fatalf("unexpected visits: %+v", v)
+	}
+}
+
+func TestClicks_ForwardedForTakenFromTheRight(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) { cfg.Analytics.TrustProxy = true })
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/landing", "proxied"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	// The client forged the first entry; the proxy appended the second
+	env.visit(t, "proxied", map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.77"})
+
+	var page analytics.Page
+	if status := env.getJSON(t, "/api/links/proxied/clicks", &page); status != http.StatusOK {
+		t.Fatalf("clicks: %d", status)
+	}
+	if len(page.Clicks) != 1 || page.Clicks[0].IP != "203.0.113.0" {
+		t.Fatalf("unexpected clicks: %+v", page.Clicks)
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.123":              "192.0.2.0",
+		"::ffff:192.0.2.123":       "192.0.2.0",
+		"2001:db8:abcd:12:1:2:3:4": "2001:db8:abcd::",
+		"fe80::1%eth0":             "fe80::",
+		"not-an-ip":                "",
+	}
+	for in, want := range cases {
+		if got := analytics.AnonymizeIP(in); got != want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClicks_FileStorePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	svc := analytics.NewService(store)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := svc.Record(ctx, analytics.Click{Code: "launch", At: base.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	if err := svc.Record(ctx, analytics.Click{Code: "other", At: base}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	reopened, err := storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	page, err := analytics.NewService(reopened).Clicks(ctx, analytics.Query{
+		Code: "launch",
+		From: base.Add(time.Hour),
+		To:   base.Add(3 * time.Hour),
+	}, "")
+	if err != nil {
+		t.Fatalf("clicks: %v", err)
+	}
+	if len(page.Clicks) != 2 || page.Clicks[0].ID != 3 || page.Clicks[1].ID != 2 {
+		t.Fatalf("unexpected clicks: %+v", page.Clicks)
+	}
+}
+
+func TestDelete_RemovesAnalytics(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&shortener.Link{}, &shortener.Counter{}, &analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}, &analytics.RollupMark{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	gormStore := storage.NewGormStore()
+	gormStore.SetDB(db)
+	fileStore, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	type store interface {
+		shortener.Store
+		analytics.Store
+	}
+	for name, st := range map[string]store{"gorm": gormStore, "file": fileStore} {
+		links := shortener.NewService(st, "http://localhost:8080", 6)
+		stats := analytics.NewService(st)
+		at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+		for _, code := range []string{"gone", "kept"} {
+			if _, err := links.Shorten(ctx, "https://example.com/"+code, code); err != nil {
+				t.Fatalf("%s: shorten: %v", name, err)
+			}
+			// Rolled up and deleted, then kept raw
+			for _, day := range []time.Time{at, at.AddDate(0, 0, 2)} {
+				if err := stats.Record(ctx, analytics.Click{Code: code, At: day, UserAgent: uaChromeWindows}); err != nil {
+					t.Fatalf("%s: record: %v", name, err)
+				}
+			}
+		}
+		if _, err := stats.Compact(ctx, at.AddDate(0, 0, 1), time.Hour); err != nil {
+			t.Fatalf("%s: compact: %v", name, err)
+		}
+
+		if err := links.Delete(ctx, "", "gone"); err != nil {
+			t.Fatalf("%s: delete: %v", name, err)
+		}
+		for code, want := range map[string]int64{"gone": 0, "kept": 2} {
+			v, err := stats.Visitors(ctx, analytics.Query{Code: code})
+			if err != nil {
+				t.Fatalf("%s: visitors: %v", name, err)
+			}
+			if v.Clicks != want || (v.UniqueVisitors == 0) != (want == 0) {
+				t.Errorf("%s: %s has %+v, want %d clicks", name, code, v, want)
+			}
+		}
+	}
+}
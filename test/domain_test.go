@@ -0,0 +1,59 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tinygo/internal/shortener"
+)
+
+func TestService_DomainNamespaces(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "https://sho.rt", 6)
+	svc.SetDomains(shortener.NewStaticDomains([]string{"go.acme.io", "acme.link"}))
+	ctx := context.Background()
+
+	a, err := svc.ShortenWith(ctx, "https://a.example", shortener.ShortenOptions{CustomCode: "docs", Domain: "go.acme.io"})
+	if err != nil {
+		t.Fatalf("shorten a: %v", err)
+	}
+	b, err := svc.ShortenWith(ctx, "https://b.example", shortener.ShortenOptions{CustomCode: "docs", Domain: "ACME.link"})
+	if err != nil {
+		t.Fatalf("shorten b: %v", err)
+	}
+	if _, err := svc.Shorten(ctx, "https://c.example", "docs"); err != nil {
+		t.Fatalf("shorten default: %v", err)
+	}
+	if got := svc.ShortURL(a); got != "https://go.acme.io/docs" {
+		t.Fatalf("short url a: %s", got)
+	}
+	if got := svc.ShortURL(b); got != "https://acme.link/docs" {
+		t.Fatalf("short url b: %s", got)
+	}
+
+	cases := map[string]string{
+		"go.acme.io":     "https://a.example",
+		"acme.link:8080": "https://b.example",
+		"sho.rt":         "https://c.example",
+		"unknown.host":   "https://c.example",
+	}
+	for host, want := range cases {
+		domain, err := svc.DomainForHost(ctx, host)
+		if err != nil {
+			t.Fatalf("domain for %s: %v", host, err)
+		}
+		l, err := svc.Hit(ctx, domain, "docs")
+		if err != nil {
+			t.Fatalf("hit via %s: %v", host, err)
+		}
+		if l.LongURL != want {
+			t.Errorf("host %s resolved to %s, want %s", host, l.LongURL, want)
+		}
+	}
+
+	_, err = svc.ShortenWith(ctx, "https://d.example", shortener.ShortenOptions{Domain: "evil.example"})
+	if !errors.Is(err, shortener.ErrUnknownDomain) {
+		t.Fatalf("expected ErrUnknownDomain, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"tinygo/internal/domains"
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+)
+
+// txtServer is a minimal DNS server answering TXT queries from a map.
+type txtServer struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func newTXTServer(t *testing.T) *txtServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &txtServer{conn: conn, records: make(map[string][]string)}
+	t.Cleanup(func() { _ = conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *txtServer) Addr() string { return s.conn.LocalAddr().String() }
+
+func (s *txtServer) Set(name string, values ...string) {
+	s.mu.Lock()
+	s.records[strings.ToLower(name)] = values
+	s.mu.Unlock()
+}
+
+func (s *txtServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// answer builds the response to a single-question query.
+func (s *txtServer) answer(q []byte) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(q) && q[i] != 0 {
+		l := int(q[i])
+		if i+1+l > len(q) {
+			return nil
+		}
+		labels = append(labels, string(q[i+1:i+1+l]))
+		i += 1 + l
+	}
+	end := i + 5 // root label, type and class
+	if end > len(q) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(q[i+1 : i+3])
+
+	s.mu.Lock()
+	values, ok := s.records[strings.ToLower(strings.Join(labels, "."))]
+	s.mu.Unlock()
+
+	resp := append([]byte(nil), q[:end]...)
+	flags := uint16(0x8180) // response, recursion desired and available
+	if !ok {
+		flags |= 3 // NXDOMAIN
+	}
+	var answers uint16
+	if ok && qtype == 16 {
+		answers = uint16(len(values))
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[6:], answers)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	for j := 0; j < int(answers); j++ {
+		v := values[j]
+		resp = append(resp, 0xc0, 0x0c, 0, 16, 0, 1, 0, 0, 0, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(v)+1))
+		resp = append(resp, byte(len(v)))
+		resp = append(resp, v...)
+	}
+	return resp
+}
+
+func TestDomains_VerifyWithTXTRecord(t *testing.T) {
+	dns := newTXTServer(t)
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	ds := domains.NewService(store, []string{"static.example"})
+	ds.SetResolver(domains.NewResolver(dns.Addr()))
+	svc := shortener.NewService(store, "https://sho.rt", 6)
+	svc.SetDomains(ds)
+	ctx := context.Background()
+
+	d, err := ds.Add(ctx, "Go.Team.Example", "https://team.example", "https://team.example/404")
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if d.Name != "go.team.example" || d.Verified || d.Token == "" {
+		t.Fatalf("unexpected domain: %+v", d)
+	}
+	if _, err := ds.Add(ctx, "go.team.example", "", ""); !errors.Is(err, domains.ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+
+	// Unverified domains stay inactive.
+	if _, err := svc.ShortenWith(ctx, "https://a.example", shortener.ShortenOptions{Domain: d.Name}); !errors.Is(err, shortener.ErrUnknownDomain) {
+		t.Fatalf("expected ErrUnknownDomain, got %v", err)
+	}
+	if _, err := ds.Verify(ctx, d.Name); !errors.Is(err, domains.ErrNotVerified) {
+		t.Fatalf("expected ErrNotVerified without record, got %v", err)
+	}
+	dns.Set(ds.RecordName(d.Name), "tinygo-verification=wrong")
+	if _, err := ds.Verify(ctx, d.Name); !errors.Is(err, domains.ErrNotVerified) {
+		t.Fatalf("expected ErrNotVerified with wrong token, got %v", err)
+	}
+
+	dns.Set(ds.RecordName(d.Name), "unrelated", domains.RecordValue(d))
+	d, err = ds.Verify(ctx, d.Name)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !d.Verified || d.VerifiedAt == nil {
+		t.Fatalf("domain not verified: %+v", d)
+	}
+
+	l, err := svc.ShortenWith(ctx, "https://a.example", shortener.ShortenOptions{CustomCode: "docs", Domain: d.Name})
+	if err != nil {
+		t.Fatalf("shorten on verified domain: %v", err)
+	}
+	if got := svc.ShortURL(l); got != "https://go.team.example/docs" {
+		t.Fatalf("short url: %s", got)
+	}
+	settings, ok, err := ds.Settings(ctx, "go.team.example:443")
+	if err != nil || !ok {
+		t.Fatalf("settings: ok=%v err=%v", ok, err)
+	}
+	if settings.RootRedirect != "https://team.example" || settings.NotFoundURL != "https://team.example/404" {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+
+	// Static domains need no verification.
+	if ok, _ := ds.Served(ctx, "static.example"); !ok {
+		t.Fatal("static domain not served")
+	}
+
+	empty := ""
+	if _, err := ds.Update(ctx, d.Name, &empty, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if settings, _, _ := ds.Settings(ctx, d.Name); settings.RootRedirect != "" || settings.NotFoundURL == "" {
+		t.Fatalf("unexpected settings after update: %+v", settings)
+	}
+	bad := "javascript:alert(1)"
+	if _, err := ds.Update(ctx, d.Name, nil, &bad); !errors.Is(err, domains.ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", err)
+	}
+
+	if err := ds.Delete(ctx, d.Name); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ok, _ := ds.Served(ctx, d.Name); ok {
+		t.Fatal("deleted domain still served")
+	}
+}
+
+func TestDomains_InvalidName(t *testing.T) {
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	ds := domains.NewService(store, nil)
+	for _, name := range []string{"", "localhost", "bad_domain.example", "-x.example", "a..example"} {
+		if _, err := ds.Add(context.Background(), name, "", ""); !errors.Is(err, domains.ErrInvalidDomain) {
+			t.Errorf("%q: expected ErrInvalidDomain, got %v", name, err)
+		}
+	}
+}
+
+// countingDomainStore counts the domain lookups that reach the store.
+type countingDomainStore struct {
+	domains.Store
+	mu   sync.Mutex
+	gets map[string]int
+}
+
+func (s *countingDomainStore) GetDomain(ctx context.Context, name string) (domains.Domain, bool, error) {
+	s.mu.Lock()
+	s.gets[name]++
+	s.mu.Unlock()
+	return s.Store.GetDomain(ctx, name)
+}
+
+func TestDomains_CacheSurvivesMadeUpHosts(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	d, err := fileStore.CreateDomain(ctx, domains.Domain{Name: "go.team.example", Token: "t"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	d.Verified = true
+	if err := fileStore.UpdateDomain(ctx, d); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	store := &countingDomainStore{Store: fileStore, gets: make(map[string]int)}
+	ds := domains.NewService(store, nil)
+
+	if ok, err := ds.Served(ctx, d.Name); err != nil || !ok {
+		t.Fatalf("served: %v %v", ok, err)
+	}
+	for i := 0; i < 5000; i++ {
+		if ok, _ := ds.Served(ctx, fmt.Sprintf("h%d.attacker.example", i)); ok {
+			t.Fatal("made-up host served")
+		}
+	}
+	if ok, err := ds.Served(ctx, d.Name); err != nil || !ok {
+		t.Fatalf("served: %v %v", ok, err)
+	}
+	if n := store.gets[d.Name]; n != 1 {
+		t.Fatalf("known domain looked up %d times, want 1 from the cache", n)
+	}
+	// The full cache takes no more unknown hosts.
+	for i := 0; i < 2; i++ {
+		_, _ = ds.Served(ctx, "late.attacker.example")
+	}
+	if n := store.gets["late.attacker.example"]; n != 2 {
+		t.Fatalf("unknown host looked up %d times, want 2", n)
+	}
+}
@@ -0,0 +1,296 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/config"
+	"tinygo/pkg/geoip"
+)
+
+// mmdbWriter builds small MaxMind DB files for tests.
+type mmdbWriter struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]int // child node index, -1 for none, or -2-dataOffset
+	data       []byte
+	// shared is the data offset of a value other records point to.
+	shared map[string]int
+}
+
+func newMMDBWriter(ipVersion, recordSize int) *mmdbWriter {
+	return &mmdbWriter{ipVersion: ipVersion, recordSize: recordSize, nodes: [][2]int{{-1, -1}}, shared: map[string]int{}}
+}
+
+// insert maps a network to a record.
+func (w *mmdbWriter) insert(cidr string, record any) {
+	prefix := netip.MustParsePrefix(cidr)
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4() && w.ipVersion == 6 {
+		// IPv4 networks live at ::/96.
+		var a16 [16]byte
+		v4 := addr.As4()
+		copy(a16[12:], v4[:])
+		addr, bits = netip.AddrFrom16(a16), bits+96
+	}
+	raw := addr.AsSlice()
+	offset := len(w.data)
+	w.data = append(w.data, w.encode(record)...)
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(raw[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.nodes[node][bit] = -2 - offset
+			break
+		}
+		if w.nodes[node][bit] < 0 {
+			w.nodes = append(w.nodes, [2]int{-1, -1})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit]
+	}
+}
+
+func (w *mmdbWriter) encode(v any) []byte {
+	ctrl := func(typ, size int) []byte {
+		var b []byte
+		if size < 29 {
+			b = []byte{byte(size)}
+		} else {
+			b = []byte{29, byte(size - 29)}
+		}
+		if typ < 8 {
+			b[0] |= byte(typ << 5)
+			return b
+		}
+		return append(b[:1], append([]byte{byte(typ - 7)}, b[1:]...)...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(2, len(v)), v...)
+	case uint32:
+		b := binary.BigEndian.AppendUint32(nil, v)
+		return append(ctrl(6, 4), b...)
+	case uint64:
+		b := binary.BigEndian.AppendUint64(nil, v)
+		return append(ctrl(9, 8), b...)
+	case pointerTo:
+		p, ok := w.shared[string(v)]
+		if !ok {
+			panic("unknown shared value " + string(v))
+		}
+		return []byte{1<<5 | byte(p>>8), byte(p)}
+	case []any:
+		b := ctrl(11, len(v))
+		for _, e := range v {
+			b = append(b, w.encode(e)...)
+		}
+		return b
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := ctrl(7, len(v))
+		for _, k := range keys {
+			b = append(b, w.encode(k)...)
+			b = append(b, w.encode(v[k])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// pointerTo encodes as a pointer to a value added with share.
+type pointerTo string
+
+func (w *mmdbWriter) share(name string, v any) {
+	w.shared[name] = len(w.data)
+	w.data = append(w.data, w.encode(v)...)
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	n := len(w.nodes)
+	value := func(r int) int {
+		switch {
+		case r == -1:
+			return n
+		case r < -1:
+			return n + 16 + (-2 - r)
+		}
+		return r
+	}
+	var buf []byte
+	for _, node := range w.nodes {
+		l, r := value(node[0]), value(node[1])
+		switch w.recordSize {
+		case 24:
+			buf = append(buf, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			buf = append(buf, byte(l>>16), byte(l>>8), byte(l), byte(l>>24)<<4|byte(r>>24)&0x0f, byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(l))
+			buf = binary.BigEndian.AppendUint32(buf, uint32(r))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, "\xab\xcd\xefMaxMind.com"...)
+	return append(buf, w.encode(map[string]any{
+		"binary_format_major_version": uint32(2),
+		"binary_format_minor_version": uint32(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               "Test-City",
+		"ip_version":                  uint32(w.ipVersion),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(n),
+		"record_size":                 uint32(w.recordSize),
+	})...)
+}
+
+func cityRecord(country pointerTo, region, city string) map[string]any {
+	return map[string]any{
+		"country":      country,
+		"subdivisions": []any{map[string]any{"names": map[string]any{"en": region}}},
+		"city":         map[string]any{"names": map[string]any{"en": city, "de": city + "-de"}},
+	}
+}
+
+// testGeoDB returns a database of a few documentation networks.
+func testGeoDB(ipVersion, recordSize int) []byte {
+	w := newMMDBWriter(ipVersion, recordSize)
+	w.share("DE", map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}})
+	w.share("FR", map[string]any{"iso_code": "FR", "names": map[string]any{"en": "France"}})
+	w.insert("192.0.2.0/24", cityRecord("DE", "Bavaria", "Munich"))
+	w.insert("198.51.100.0/25", cityRecord("DE", "Berlin", "Berlin"))
+	w.insert("203.0.113.0/24", cityRecord("FR", "Île-de-France", "Paris"))
+	if ipVersion == 6 {
+		w.insert("2001:db8::/32", map[string]any{"country": pointerTo("FR")})
+	}
+	return w.bytes()
+}
+
+func TestGeoIPLocate(t *testing.T) {
+	for _, tc := range []struct{ ipVersion, recordSize int }{{4, 24}, {6, 24}, {6, 28}, {6, 32}} {
+		db, err := geoip.New(testGeoDB(tc.ipVersion, tc.recordSize))
+		if err != nil {
+			t.Fatalf("ipv%d/%d: open: %v", tc.ipVersion, tc.recordSize, err)
+		}
+		if db.Type != "Test-City" {
+			t.Errorf("ipv%d/%d: type %q", tc.ipVersion, tc.recordSize, db.Type)
+		}
+		cases := map[string]geoip.Location{
+			"192.0.2.77":         {Country: "DE", Region: "Bavaria", City: "Munich"},
+			"198.51.100.1":       {Country: "DE", Region: "Berlin", City: "Berlin"},
+			"198.51.100.200":     {},
+			"::ffff:203.0.113.9": {Country: "FR", Region: "Île-de-France", City: "Paris"},
+			"10.0.0.1":           {},
+			"not an ip":          {},
+		}
+		if tc.ipVersion == 6 {
+			cases["2001:db8:1::1"] = geoip.Location{Country: "FR"}
+		}
+		for ip, want := range cases {
+			if got := db.Locate(ip); got != want {
+				t.Errorf("ipv%d/%d: Locate(%s) = %+v, want %+v", tc.ipVersion, tc.recordSize, ip, got, want)
+			}
+		}
+	}
+}
+
+func TestGeoIPInvalid(t *testing.T) {
+	valid := testGeoDB(6, 28)
+	for name, buf := range map[string][]byte{
+		"empty":     nil,
+		"no tree":   valid[len(valid)-200:],
+		"truncated": valid[:len(valid)-20],
+	} {
+		if _, err := geoip.New(buf); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("open missing file: expected error")
+	}
+}
+
+func TestGeoBreakdowns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(path, testGeoDB(6, 24), 0o644); err != nil {
+		t.Fatalf("write db: %v", err)
+	}
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Analytics.GeoIPDB = path
+		cfg.Analytics.TrustProxy = true
+	})
+	ctx := context.Background()
+	for _, code := range []string{"spring", "summer"} {
+		if _, err := env.links.Shorten(ctx, "https://example.com/"+code, code); err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+	}
+	for _, v := range []struct{ code, ip string }{
+		{"spring", "192.0.2.10"}, {"spring", "192.0.2.11"}, {"spring", "198.51.100.3"},
+		{"spring", "203.0.113.5"}, {"spring", "10.1.2.3"}, {"summer", "203.0.113.6"},
+	} {
+		env.visit(t, v.code, map[string]string{"X-Forwarded-For": v.ip})
+	}
+
+	var tree analytics.Tree
+	if status := env.getJSON(t, "/api/links/spring/stats/geo", &tree); status != http.StatusOK {
+		t.Fatalf("link geo: %d", status)
+	}
+	if tree.Total != 5 || len(tree.Items) != 3 {
+		t.Fatalf("unexpected geo tree: %+v", tree)
+	}
+	de := tree.Items[0]
+	if de.Value != "DE" || de.Clicks != 3 || len(de.Items) != 2 || de.Items[0].Value != "Bavaria" ||
+		len(de.Items[0].Items) != 1 || de.Items[0].Items[0].Value != "Munich" || de.Items[0].Items[0].Clicks != 2 {
+		t.Fatalf("unexpected germany: %+v", de)
+	}
+	// The unknown address is counted with empty values, sorted before FR
+	if unknown := tree.Items[1]; unknown.Value != "" || unknown.Clicks != 1 {
+		t.Fatalf("unexpected unknown location: %+v", tree.Items)
+	}
+
+	var global analytics.Tree
+	if status := env.getJSON(t, "/api/stats/geo", &global); status != http.StatusOK {
+		t.Fatalf("global geo: %d", status)
+	}
+	if global.Total != 6 || global.Items[0].Value != "DE" || global.Items[1].Value != "FR" || global.Items[1].Clicks != 2 {
+		t.Fatalf("unexpected global geo: %+v", global)
+	}
+
+	page, err := env.analytics.Clicks(ctx, analytics.Query{Code: "summer"}, "")
+	if err != nil || len(page.Clicks) != 1 {
+		t.Fatalf("clicks: %v %+v", err, page)
+	}
+	if c := page.Clicks[0]; c.Country != "FR" || c.City != "Paris" || c.IP != "203.0.113.0" {
+		t.Fatalf("unexpected click: %+v", c)
+	}
+}
+
+func TestGeoDisabled(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/", "nogeo"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	env.visit(t, "nogeo", nil)
+	for _, path := range []string{"/api/links/nogeo/stats/geo", "/api/stats/geo"} {
+		if status := env.getJSON(t, path, nil); status != http.StatusNotFound {
+			t.Errorf("%s: %d, want 404", path, status)
+		}
+	}
+	var devices analytics.Tree
+	if status := env.getJSON(t, "/api/stats/devices", &devices); status != http.StatusOK || devices.Total != 1 {
+		t.Fatalf("global devices: %d %+v", status, devices)
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tinygo/internal/shortener"
+	"tinygo/pkg/random"
+)
+
+func newHashService(t *testing.T) *shortener.Service {
+	t.Helper()
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	svc.RegisterGenerator(shortener.StrategyHash, shortener.NewHashGenerator([]byte("k"), random.Base62, 6))
+	return svc
+}
+
+func TestService_HashStrategyIsIdempotent(t *testing.T) {
+	svc := newHashService(t)
+	opts := shortener.ShortenOptions{Strategy: shortener.StrategyHash}
+
+	a, err := svc.ShortenWith(context.Background(), "https://Example.com:443?b=2&a=1", opts)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	b, err := svc.ShortenWith(context.Background(), "https://example.com/?a=1&b=2", opts)
+	if err != nil {
+		t.Fatalf("shorten again: %v", err)
+	}
+	if a.Code != b.Code || len(a.Code) != 6 {
+		t.Fatalf("expected same 6-char code, got %q and %q", a.Code, b.Code)
+	}
+
+	// A fresh database yields the same code.
+	other := newHashService(t)
+	c, err := other.ShortenWith(context.Background(), "https://example.com/?a=1&b=2", opts)
+	if err != nil {
+		t.Fatalf("shorten fresh: %v", err)
+	}
+	if c.Code != a.Code {
+		t.Fatalf("expected %q across databases, got %q", a.Code, c.Code)
+	}
+}
+
+func TestService_HashStrategyExtendsOnCollision(t *testing.T) {
+	svc := newHashService(t)
+	g := shortener.NewHashGenerator([]byte("k"), random.Base62, 6)
+	code, _ := g.Generate(context.Background(), "https://golang.org", 0)
+
+	// Occupy the hash code with a different URL.
+	if _, err := svc.Shorten(context.Background(), "https://example.org", code); err != nil {
+		t.Fatalf("custom: %v", err)
+	}
+	l, err := svc.ShortenWith(context.Background(), "https://golang.org", shortener.ShortenOptions{Strategy: shortener.StrategyHash})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if len(l.Code) != 7 || l.Code[:6] != code {
+		t.Fatalf("expected %q extended by one char, got %q", code, l.Code)
+	}
+}
+
+func TestService_UnknownStrategy(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	_, err := svc.ShortenWith(context.Background(), "https://golang.org", shortener.ShortenOptions{Strategy: "nope"})
+	if !errors.Is(err, shortener.ErrStrategy) {
+		t.Fatalf("expected ErrStrategy, got %v", err)
+	}
+}
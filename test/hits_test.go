@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/config"
+	"tinygo/internal/hits"
+	"tinygo/internal/shortener"
+)
+
+func TestHitQueue_BatchesRedirects(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.HitQueue.Enabled = true
+		cfg.HitQueue.FlushIntervalMS = int(time.Hour / time.Millisecond)
+	})
+	ctx := context.Background()
+	if _, err := env.links.Shorten(ctx, "https://example.com/", "queued"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	for range 3 {
+		env.visit(t, "queued", map[string]string{"User-Agent": uaChromeWindows})
+	}
+	env.visit(t, "queued", map[string]string{"User-Agent": "curl/8.4.0"})
+
+	// Redirects only read the link until the queue is flushed
+	l, _, _ := env.links.Resolve(ctx, "", "queued")
+	if l.HitCount != 0 || l.BotHitCount != 0 {
+		t.Fatalf("counted before flush: %d, %d", l.HitCount, l.BotHitCount)
+	}
+	if err := env.hits.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	l, _, _ = env.links.Resolve(ctx, "", "queued")
+	if l.HitCount != 3 || l.BotHitCount != 1 || l.LastAccessAt.IsZero() {
+		t.Fatalf("after flush: %+v", l)
+	}
+	var stats analytics.VisitorStats
+	if status := env.getJSON(t, "/api/links/queued/stats", &stats); status != http.StatusOK || stats.Clicks != 4 || stats.UniqueVisitors != 1 {
+		t.Fatalf("stats: %d %+v", status, stats)
+	}
+
+	// Close writes what is left
+	env.visit(t, "queued", map[string]string{"User-Agent": uaSafariIPhone})
+	if err := env.hits.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if l, _, _ = env.links.Resolve(ctx, "", "queued"); l.HitCount != 4 {
+		t.Fatalf("after close: %d hits", l.HitCount)
+	}
+	if n, _ := env.analytics.Count(ctx, analytics.Query{Code: "queued"}); n != 5 {
+		t.Fatalf("clicks after close: %d", n)
+	}
+}
+
+// stallingStore blocks its first AddHits until release is closed.
+type stallingStore struct {
+	shortener.Store
+	started atomic.Bool
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (s *stallingStore) AddHits(ctx context.Context, h []shortener.Hits) error {
+	if s.started.CompareAndSwap(false, true) {
+		close(s.stalled)
+		<-s.release
+	}
+	return s.Store.AddHits(ctx, h)
+}
+
+func TestHitQueue_FullQueuePolicies(t *testing.T) {
+	cases := map[hits.Policy]int64{
+		hits.PolicyDrop:  2,
+		hits.PolicyBlock: 2,
+		hits.PolicySync:  3,
+	}
+	for policy, want := range cases {
+		t.Run(string(policy), func(t *testing.T) {
+			ctx := context.Background()
+			store := &stallingStore{Store: newTempStore(t).Store, stalled: make(chan struct{}), release: make(chan struct{})}
+			links := shortener.NewService(store, "http://localhost:8080", 6)
+			if _, err := links.Shorten(ctx, "https://example.com/", "full"); err != nil {
+				t.Fatalf("shorten: %v", err)
+			}
+			q, err := hits.New(links, nil, hits.Options{Size: 1, BatchSize: 1, FlushInterval: time.Hour, Policy: policy})
+			if err != nil {
+				t.Fatalf("new queue: %v", err)
+			}
+			hit := hits.Hit{Code: "full", At: time.Now()}
+
+			// The first hit stalls the writer, the second fills the queue
+			_ = q.Add(ctx, hit)
+			<-store.stalled
+			_ = q.Add(ctx, hit)
+
+			addCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			err = q.Add(addCtx, hit)
+			switch policy {
+			case hits.PolicyDrop:
+				if err != nil || q.Dropped() != 1 {
+					t.Fatalf("drop: err %v, dropped %d", err, q.Dropped())
+				}
+			case hits.PolicyBlock:
+				if !errors.Is(err, context.DeadlineExceeded) || q.Dropped() != 1 {
+					t.Fatalf("block: err %v, dropped %d", err, q.Dropped())
+				}
+			case hits.PolicySync:
+				l, _, _ := links.Resolve(ctx, "", "full")
+				if err != nil || l.HitCount != 1 || q.Dropped() != 0 {
+					t.Fatalf("sync: err %v, hits %d, dropped %d", err, l.HitCount, q.Dropped())
+				}
+			}
+
+			close(store.release)
+			if err := q.Close(ctx); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if l, _, _ := links.Resolve(ctx, "", "full"); l.HitCount != want {
+				t.Fatalf("hits = %d, want %d", l.HitCount, want)
+			}
+		})
+	}
+}
+
+func TestHitQueue_UnknownPolicy(t *testing.T) {
+	links := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	if _, err := hits.New(links, nil, hits.Options{Policy: "spill"}); !errors.Is(err, hits.ErrPolicy) {
+		t.Fatalf("err = %v, want ErrPolicy", err)
+	}
+}
+
+func TestConfig_FlushIntervalBeforeRollup(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Username, cfg.Auth.Password = "admin", "secret"
+	for ms, valid := range map[int]bool{1: true, 60000: true, 60001: false} {
+		cfg.HitQueue.FlushIntervalMS = ms
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("flush_interval_ms %d: %v", ms, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/internal/shortener"
+	"tinygo/internal/transfer"
+)
+
+func TestTransfer_ImportBitlyCSV(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "https://sho.rt", 6)
+	svc.SetDomains(shortener.NewStaticDomains([]string{"acme.co"}))
+	input := "Title,Long URL,Bitlink,Custom link,Tags,Total Clicks,Date Created\n" +
+		"Spring sale,https://shop.example/spring,acme.co/3xYzAbC,,promo,\"1,204\",2021-03-04 05:06:07\n" +
+		"Docs,https://docs.example,https://acme.co/docs,,,12,2022-01-02T03:04:05+0000\n" +
+		"Odd,https://odd.example,acme.co/odd.code,,,0,2022-01-02\n"
+
+	r, err := transfer.NewReader(strings.NewReader(input), transfer.Bitly)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	report, err := transfer.Import(ctx, svc, r, transfer.Options{})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 2 || report.Rejected != 1 || len(report.Errors) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if e := report.Errors[0]; e.Row != 4 || e.Code != "odd.code" || !errors.Is(e, shortener.ErrInvalidCode) {
+		t.Fatalf("unexpected rejection: %+v", e)
+	}
+
+	l, ok, err := svc.Resolve(ctx, "acme.co", "3xYzAbC")
+	if err != nil || !ok {
+		t.Fatalf("resolve: ok=%v err=%v", ok, err)
+	}
+	if l.Title != "Spring sale" || l.HitCount != 1204 || !l.CreatedAt.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Fatalf("unexpected link: %+v", l)
+	}
+	if got := svc.ShortURL(l); got != "https://acme.co/3xYzAbC" {
+		t.Fatalf("short url: %s", got)
+	}
+}
+
+func TestTransfer_ImportSharedDomainsToDefault(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "https://sho.rt", 6)
+	cases := map[transfer.Format]string{
+		transfer.Bitly:     "Long URL,Bitlink\nhttps://shop.example,bit.ly/3xYzAbC\n",
+		transfer.Rebrandly: "Destination,Short URL\nhttps://docs.example,https://rebrand.ly/docs\n",
+	}
+	for format, input := range cases {
+		r, err := transfer.NewReader(strings.NewReader(input), format)
+		if err != nil {
+			t.Fatalf("%s: reader: %v", format, err)
+		}
+		report, err := transfer.Import(ctx, svc, r, transfer.Options{})
+		if err != nil || report.Created != 1 {
+			t.Fatalf("%s: report %+v err=%v", format, report, err)
+		}
+	}
+	for _, code := range []string{"3xYzAbC", "docs"} {
+		if _, ok, _ := svc.Resolve(ctx, "", code); !ok {
+			t.Fatalf("%s not imported to the default domain", code)
+		}
+	}
+}
+
+func TestTransfer_ImportShlinkJSON(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "https://sho.rt", 6)
+	input := `{"shortUrls": {"data": [
+		{"shortCode": "12C18", "shortUrl": "https://s.test/12C18", "longUrl": "https://store.example",
+		 "dateCreated": "2016-08-21T20:34:16+02:00", "visitsSummary": {"total": 328, "nonBots": 320, "bots": 8},
+		 "tags": ["games"], "domain": null, "title": "Store"},
+		{"shortCode": "custom", "shortUrl": "https://doma.in/custom", "longUrl": "https://www.example.com",
+		 "dateCreated": "2019-05-11T09:01:49+00:00", "visitsCount": 5, "domain": "doma.in", "title": null}
+	], "pagination": {"currentPage": 1, "pagesCount": 1}}}`
+
+	r, err := transfer.NewReader(strings.NewReader(input), transfer.Shlink)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	// Move everything onto the default domain.
+	report, err := transfer.Import(ctx, svc, r, transfer.Options{Domain: "sho.rt"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Rows != 2 || report.Created != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	l, ok, _ := svc.Resolve(ctx, "", "12C18")
+	if !ok || l.HitCount != 328 || l.Title != "Store" || l.CreatedAt.Unix() != 1471804456 {
+		t.Fatalf("unexpected link: %+v", l)
+	}
+	if l, ok, _ := svc.Resolve(ctx, "", "custom"); !ok || l.HitCount != 5 {
+		t.Fatalf("unexpected link: %+v", l)
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tinygo/internal/shortener"
+	"tinygo/pkg/random"
+)
+
+func TestService_AdaptiveLengthGrowsWhenCrowded(t *testing.T) {
+	st := newTempStore(t)
+	// Simulate a crowded keyspace with a generator that collides until the
+	// length grows.
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 3)
+	calls := 0
+	svc.RegisterGenerator(shortener.StrategyRandom, shortener.GeneratorFunc(
+		func(ctx context.Context, longURL string, attempt int) (string, error) {
+			calls++
+			// Always collide at the current length, succeed once it grew.
+			if svc.CodeLength() == 3 {
+				return "aaa", nil
+			}
+			return fmt.Sprintf("b%0*d", svc.CodeLength()-1, calls), nil
+		}))
+	svc.SetAdaptiveLength(shortener.AdaptiveLength{GrowAfterRetries: 2, MaxLength: 5})
+
+	if _, err := svc.Shorten(context.Background(), "https://golang.org", "aaa"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	l, err := svc.Shorten(context.Background(), "https://golang.org", "")
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if svc.CodeLength() != 4 || len(l.Code) != 4 {
+		t.Fatalf("expected growth to length 4, got length %d code %q", svc.CodeLength(), l.Code)
+	}
+
+	ks, err := svc.KeyspaceStats(context.Background())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if ks.Links != 2 || ks.Collisions != 5 || ks.Grown != 1 || ks.CodeLength != 4 {
+		t.Fatalf("unexpected stats: %+v", ks)
+	}
+}
+
+func TestService_AdaptiveLengthFollowsUtilization(t *testing.T) {
+	st := newTempStore(t)
+	binary := random.NewAlphabet("binary", "01")
+	newService := func() *shortener.Service {
+		svc := shortener.NewService(st.Store, "http://localhost:8080", 3)
+		svc.SetAlphabet(binary)
+		svc.SetAdaptiveLength(shortener.AdaptiveLength{GrowAfterRetries: 100, MaxLength: 8, MaxUtilization: 0.25})
+		if err := svc.Calibrate(context.Background()); err != nil {
+			t.Fatalf("calibrate: %v", err)
+		}
+		return svc
+	}
+	svc := newService()
+	// Three links fill more than a quarter of the eight 3-character codes
+	for _, code := range []string{"000", "001", "010"} {
+		if _, err := svc.Shorten(context.Background(), "https://golang.org", code); err != nil {
+			t.Fatalf("shorten %s: %v", code, err)
+		}
+	}
+	if svc.CodeLength() != 4 {
+		t.Fatalf("length %d after 3 links, want 4", svc.CodeLength())
+	}
+
+	// A restart derives the same length from the stored links
+	if restarted := newService(); restarted.CodeLength() != 4 {
+		t.Fatalf("length %d after restart, want 4", restarted.CodeLength())
+	}
+}
+
+func TestShorten_ExhaustedIsConflict(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	env.links.RegisterGenerator(shortener.StrategyRandom, shortener.GeneratorFunc(
+		func(ctx context.Context, longURL string, attempt int) (string, error) {
+			return "taken", nil
+		}))
+	if _, err := env.links.Shorten(context.Background(), "https://golang.org", "taken"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	resp, err := env.client.Post(env.srv.URL+"/api/shorten", "application/json", strings.NewReader(`{"long_url":"https://golang.org/doc"}`))
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("status %d, want 409", resp.StatusCode)
+	}
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/internal/config"
+	"tinygo/internal/live"
+)
+
+// sseEvent is a server-sent event as read off a stream.
+type sseEvent struct {
+	id, name, data string
+}
+
+// openStream opens an event stream with the env's session, or with the
+// given headers instead when not nil.
+func (e *analyticsEnv) openStream(t *testing.T, path string, headers map[string]string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, e.srv.URL+path, nil)
+	client := e.client
+	if headers != nil {
+		client = http.DefaultClient
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	events := make(chan sseEvent, 16)
+	if resp.StatusCode != http.StatusOK {
+		close(events)
+		return resp, events
+	}
+	// Wait for the subscription to be registered
+	sc := bufio.NewScanner(resp.Body)
+	if !sc.Scan() || sc.Text() != ": connected" {
+		t.Fatalf("no connected comment on %s", path)
+	}
+	go func() {
+		defer close(events)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.name != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event within 2s")
+	}
+	return sseEvent{}
+}
+
+func TestLive_StreamsRedirects(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Auth.APIKeys = []string{"s3cret"}
+	})
+	for _, code := range []string{"launch", "other"} {
+		if _, err := env.links.Shorten(t.Context(), "https://example.com/"+code, code); err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+	}
+	_, link := env.openStream(t, "/api/links/launch/live", nil)
+	_, humans := env.openStream(t, "/api/live?class=human", map[string]string{"X-Api-Key": "s3cret"})
+	_, all := env.openStream(t, "/api/live", map[string]string{"Authorization": "Bearer s3cret"})
+
+	env.visit(t, "other", map[string]string{"User-Agent": "curl/8.4.0"})
+	env.visit(t, "launch", map[string]string{"User-Agent": uaChromeWindows, "Referer": "https://news.ycombinator.com/"})
+
+	ev := nextEvent(t, link)
+	var click live.Event
+	if err := json.Unmarshal([]byte(ev.data), &click); err != nil {
+		t.Fatalf("decode %q: %v", ev.data, err)
+	}
+	if ev.name != "click" || ev.id != "2" || click.Code != "launch" || click.Class != "human" ||
+		click.Browser != "Chrome" || click.Referrer != "https://news.ycombinator.com/" || click.At.IsZero() {
+		t.Fatalf("link stream: %+v %+v", ev, click)
+	}
+	if ev := nextEvent(t, humans); !strings.Contains(ev.data, `"code":"launch"`) {
+		t.Fatalf("human stream got %s first", ev.data)
+	}
+	if a, b := nextEvent(t, all), nextEvent(t, all); a.id != "1" || b.id != "2" {
+		t.Fatalf("global stream ids: %s, %s", a.id, b.id)
+	}
+
+	// Unknown links and bad filters are refused before streaming
+	if resp, _ := env.openStream(t, "/api/links/missing/live", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing link: %d", resp.StatusCode)
+	}
+	if resp, _ := env.openStream(t, "/api/live?class=robots", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad class: %d", resp.StatusCode)
+	}
+}
+
+func TestLive_RequiresAuth(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Auth.APIKeys = []string{"s3cret"}
+	})
+	for _, headers := range []map[string]string{
+		{},
+		{"X-Api-Key": "wrong"},
+		{"Authorization": "Bearer wrong"},
+	} {
+		if resp, _ := env.openStream(t, "/api/live", headers); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%v: status %d", headers, resp.StatusCode)
+		}
+	}
+}
+
+func TestLive_DisabledServesNoStreams(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Live.Enabled = false
+	})
+	if resp, _ := env.openStream(t, "/api/live", nil); resp.StatusCode == http.StatusOK {
+		t.Fatalf("status %d with live disabled", resp.StatusCode)
+	}
+}
+
+func TestLiveBroker_EvictsSlowSubscribers(t *testing.T) {
+	b := live.NewBroker(live.Options{Buffer: 2})
+	slow, _ := b.SubscribeAll()
+	fast, _ := b.Subscribe("", "x")
+	other, _ := b.Subscribe("", "y")
+
+	for range 3 {
+		b.Publish(live.Event{Code: "x"})
+		<-fast.Events()
+	}
+	// slow filled its buffer with two events and was dropped on the third
+	var got int
+	for range slow.Events() {
+		got++
+	}
+	if got != 2 || !slow.Evicted() || b.Evicted() != 1 {
+		t.Fatalf("slow: %d events, evicted %v, count %d", got, slow.Evicted(), b.Evicted())
+	}
+	if fast.Evicted() || other.Evicted() || b.Subscribers() != 2 {
+		t.Fatalf("others evicted: %d subscribers", b.Subscribers())
+	}
+
+	b.Unsubscribe(fast)
+	b.Unsubscribe(fast)
+	b.Close()
+	if _, ok := <-other.Events(); ok || other.Evicted() {
+		t.Fatal("close left a subscription open")
+	}
+	if _, err := b.SubscribeAll(); !errors.Is(err, live.ErrClosed) {
+		t.Fatalf("subscribe after close: %v", err)
+	}
+}
+
+func TestLive_SubscriberLimit(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) {
+		cfg.Live.MaxSubscribers = 1
+	})
+	env.openStream(t, "/api/live", nil)
+	if resp, _ := env.openStream(t, "/api/live", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second stream: %d", resp.StatusCode)
+	}
+}
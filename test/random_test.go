@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"tinygo/internal/shortener"
+	"tinygo/pkg/random"
+)
+
+func TestAlphabet_CodeUsesOnlyAlphabetChars(t *testing.T) {
+	for _, name := range random.Presets() {
+		a, _ := random.Lookup(name)
+		for i := 0; i < 200; i++ {
+			code, err := a.Code(12)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if len(code) != 12 {
+				t.Fatalf("%s: unexpected length %d", name, len(code))
+			}
+			for _, c := range code {
+				if !strings.ContainsRune(a.Chars(), c) {
+					t.Fatalf("%s: %q not in alphabet", name, c)
+				}
+			}
+		}
+	}
+}
+
+func TestAlphabet_DefaultLength(t *testing.T) {
+	cases := map[string]int{"base62": 7, "lowercase": 9, "crockford": 9, "no-lookalikes": 8}
+	for name, want := range cases {
+		a, ok := random.Lookup(name)
+		if !ok {
+			t.Fatalf("missing preset %s", name)
+		}
+		if got := a.DefaultLength(); got != want {
+			t.Errorf("%s: default length %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestService_CustomCodeFollowsAlphabet(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 0)
+	svc.SetAlphabet(random.Crockford)
+	if svc.CodeLength() != 9 {
+		t.Fatalf("expected derived length 9, got %d", svc.CodeLength())
+	}
+
+	// Custom codes are folded to Crockford spelling
+	if l, err := svc.Shorten(context.Background(), "https://golang.org", "lower-io"); err != nil || l.Code != "10WER-10" {
+		t.Fatalf("folded code: %q %v", l.Code, err)
+	}
+	if _, err := svc.Shorten(context.Background(), "https://golang.org", "undo"); !errors.Is(err, shortener.ErrInvalidCode) {
+		t.Fatalf("expected ErrInvalidCode, got %v", err)
+	}
+	l, err := svc.Shorten(context.Background(), "https://golang.org", "")
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if strings.ContainsAny(l.Code, "ILOU") || len(l.Code) != 9 {
+		t.Fatalf("unexpected generated code %q", l.Code)
+	}
+}
+
+func TestAlphabet_Normalize(t *testing.T) {
+	if got := random.Crockford.Normalize("abc-Lio_z"); got != "ABC-110_Z" {
+		t.Fatalf("crockford: %q", got)
+	}
+	if got := random.Base62.Normalize("abc-Lio"); got != "abc-Lio" {
+		t.Fatalf("base62: %q", got)
+	}
+}
+
+func TestWords_Format(t *testing.T) {
+	opts := random.WordOptions{Words: 3, Separator: "_", Digits: 3}
+	for i := 0; i < 100; i++ {
+		code, err := random.Words(opts)
+		if err != nil {
+			t.Fatalf("words: %v", err)
+		}
+		parts := strings.Split(code, "_")
+		if len(parts) != 4 || len(parts[3]) != 3 {
+			t.Fatalf("unexpected code %q", code)
+		}
+		if len(code) > opts.MaxLength() {
+			t.Fatalf("code %q longer than MaxLength %d", code, opts.MaxLength())
+		}
+	}
+}
+
+func TestService_WordsStrategyPerRequest(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	l, err := svc.ShortenWith(context.Background(), "https://golang.org", shortener.ShortenOptions{Strategy: shortener.StrategyWords})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if strings.Count(l.Code, "-") != 2 {
+		t.Fatalf("expected word code like brave-otter-42, got %q", l.Code)
+	}
+	if _, ok, _ := svc.Resolve(context.Background(), "", l.Code); !ok {
+		t.Fatalf("word code %q not resolvable", l.Code)
+	}
+}
+
+func TestRedirect_CrockfordMisreadSpellings(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	env.links.SetAlphabet(random.Crockford)
+	l, err := env.links.Shorten(context.Background(), "https://golang.org", "go-1O")
+	if err != nil || l.Code != "G0-10" {
+		t.Fatalf("shorten: %q %v", l.Code, err)
+	}
+	for _, code := range []string{"G0-10", "go-10", "GO-IO", "g0-l0"} {
+		env.visit(t, code, map[string]string{"User-Agent": uaChromeWindows})
+	}
+	if l, _, _ := env.links.Resolve(context.Background(), "", "gO-lo"); l.HitCount != 4 {
+		t.Fatalf("hits = %d, want 4", l.HitCount)
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/storage"
+)
+
+func TestParseReferrer(t *testing.T) {
+	cases := []struct {
+		referrer, host, category string
+	}{
+		{"", "", analytics.CategoryDirect},
+		{"https://www.google.co.uk/search?q=x", "google.co.uk", analytics.CategorySearch},
+		{"https://mail.google.com/mail/u/0/", "mail.google.com", analytics.CategoryEmail},
+		{"https://t.co/abc", "t.co", analytics.CategorySocial},
+		{"https://old.reddit.com/r/golang", "old.reddit.com", analytics.CategorySocial},
+		{"android-app://com.google.android.gm/", "com.google.android.gm", analytics.CategoryEmail},
+		{"https://blog.example.com:8443/post", "blog.example.com", analytics.CategoryOther},
+		{"https://googleblog.example.com/", "googleblog.example.com", analytics.CategoryOther},
+		{"not a url", "", analytics.CategoryOther},
+	}
+	for _, c := range cases {
+		host, category := analytics.ParseReferrer(c.referrer)
+		if host != c.host || category != c.category {
+			t.Errorf("ParseReferrer(%q) = %q, %q; want %q, %q", c.referrer, host, category, c.host, c.category)
+		}
+	}
+}
+
+func TestReferrerStats(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/landing", "launch"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	for _, ref := range []string{
+		"https://www.google.com/", "https://www.google.com/search", "https://duckduckgo.com/",
+		"https://t.co/x", "", "",
+	} {
+		env.visit(t, "launch", map[string]string{"Referer": ref})
+	}
+
+	var stats analytics.ReferrerStats
+	if status := env.getJSON(t, "/api/links/launch/stats/referrers", &stats); status != http.StatusOK {
+		t.Fatalf("referrers: %d", status)
+	}
+	if stats.Total != 6 || len(stats.Hosts) != 3 || stats.Hosts[0] != (analytics.ReferrerCount{Host: "google.com", Category: "search", Clicks: 2}) {
+		t.Fatalf("unexpected hosts: %+v", stats)
+	}
+	want := []analytics.CategoryCount{{Category: "search", Clicks: 3}, {Category: "direct", Clicks: 2}, {Category: "social", Clicks: 1}}
+	for i, c := range want {
+		if i >= len(stats.Categories) || stats.Categories[i] != c {
+			t.Fatalf("unexpected categories: %+v", stats.Categories)
+		}
+	}
+}
+
+func TestReferrerStats_FileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	svc := analytics.NewService(store)
+	for _, ref := range []string{"https://bing.com/", "https://bing.com/?q=1", "https://news.ycombinator.com/"} {
+		if err := svc.Record(ctx, analytics.Click{Code: "launch", Referrer: ref}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	if err := svc.Record(ctx, analytics.Click{Code: "other", Referrer: "https://bing.com/"}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	stats, err := svc.Referrers(ctx, analytics.Query{Code: "launch"})
+	if err != nil {
+		t.Fatalf("referrers: %v", err)
+	}
+	if stats.Total != 3 || len(stats.Hosts) != 2 || stats.Hosts[0].Host != "bing.com" || stats.Hosts[0].Clicks != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,245 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/storage"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// statsSnapshot is what the stats endpoints report for a few ranges.
+type statsSnapshot struct {
+	Clicks     int64
+	Browsers   analytics.Tree
+	Classes    analytics.Tree
+	GlobalGeo  analytics.Tree
+	Referrers  int64
+	Days       []int64
+	Hours      []int64
+	HumanDays  []int64
+	PartialDay int64
+}
+
+func snapshot(t *testing.T, svc *analytics.Service) statsSnapshot {
+	t.Helper()
+	ctx := context.Background()
+	link := analytics.Query{Code: "rolled"}
+	days := analytics.Query{Code: "rolled", From: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}
+	var s statsSnapshot
+	var err error
+	fail := func(what string) {
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	}
+	v, err := svc.Visitors(ctx, link)
+	fail("visitors")
+	s.Clicks = v.Clicks
+	s.Browsers, err = svc.Tree(ctx, link, analytics.DimBrowser, analytics.DimBrowserVersion)
+	fail("browsers")
+	s.Classes, err = svc.Tree(ctx, link, analytics.DimClass)
+	fail("classes")
+	s.GlobalGeo, err = svc.Tree(ctx, analytics.Query{}, analytics.DimCountry)
+	fail("geo")
+	r, err := svc.Referrers(ctx, link)
+	fail("referrers")
+	s.Referrers = r.Total
+
+	series, err := svc.Timeseries(ctx, days, analytics.IntervalDay, time.UTC)
+	fail("days")
+	s.Days = clickCounts(series)
+	hours := days
+	hours.From, hours.To = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)
+	series, err = svc.Timeseries(ctx, hours, analytics.IntervalHour, time.UTC)
+	fail("hours")
+	s.Hours = clickCounts(series)
+	human := days
+	human.Class = "human"
+	series, err = svc.Timeseries(ctx, human, analytics.IntervalDay, time.UTC)
+	fail("human days")
+	s.HumanDays = clickCounts(series)
+
+	// Starts within a kept hour that is also rolled up
+	partial := analytics.Query{Code: "rolled", From: time.Date(2026, 3, 3, 12, 30, 0, 0, time.UTC)}
+	v, err = svc.Visitors(ctx, partial)
+	fail("partial")
+	s.PartialDay = v.Clicks
+	return s
+}
+
+func TestRollups_StatsSurviveRetention(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "links.json")
+	fileStore, err := storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	services := map[string]*analytics.Service{
+		"gorm": newAnalyticsEnv(t, nil).analytics,
+		"file": analytics.NewService(fileStore),
+	}
+	for name, svc := range services {
+		clicks := []analytics.Click{
+			{At: time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC), UserAgent: uaChromeWindows, Referrer: "https://www.google.com/"},
+			{At: time.Date(2026, 3, 1, 10, 45, 0, 0, time.UTC), UserAgent: "curl/8.4.0"},
+			{At: time.Date(2026, 3, 1, 12, 5, 0, 0, time.UTC), UserAgent: uaSafariIPhone, Referrer: "https://t.co/x"},
+			{At: time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC), UserAgent: uaChromeAndroid},
+			{At: time.Date(2026, 3, 3, 12, 10, 0, 0, time.UTC), UserAgent: uaChromeWindows},
+			{At: time.Date(2026, 3, 3, 12, 40, 0, 0, time.UTC), UserAgent: uaChromeWindows},
+			{At: time.Date(2026, 3, 4, 23, 30, 0, 0, time.UTC), UserAgent: uaSafariIPhone},
+		}
+		for i := range clicks {
+			clicks[i].Code, clicks[i].IP = "rolled", "198.51.100.7"
+		}
+		other := analytics.Click{Code: "other", At: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+		if err := svc.RecordBatch(ctx, append(clicks, other)); err != nil {
+			t.Fatalf("%s: record: %v", name, err)
+		}
+		before := snapshot(t, svc)
+
+		// Rolls up until 23:00 and deletes clicks before March 3
+		now := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+		res, err := svc.Compact(ctx, now, 48*time.Hour)
+		if err != nil {
+			t.Fatalf("%s: compact: %v", name, err)
+		}
+		if res.RolledUp == 0 || res.Deleted != 5 ||
+			!res.Mark.RolledUntil.Equal(time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC)) ||
+			!res.Mark.RawSince.Equal(time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("%s: unexpected compaction: %+v", name, res)
+		}
+		if n, _ := svc.Count(ctx, analytics.Query{}); n != 3 {
+			t.Fatalf("%s: %d raw clicks kept, want 3", name, n)
+		}
+		if after := snapshot(t, svc); !reflect.DeepEqual(after, before) {
+			t.Fatalf("%s: stats changed by compaction:\nbefore %+v\nafter  %+v", name, before, after)
+		}
+
+		// The last hour is rolled up once it is over, and only once
+		later := now.Add(30 * time.Minute)
+		if res, err = svc.Compact(ctx, later, 48*time.Hour); err != nil || res.RolledUp == 0 || res.Deleted != 0 || !res.Mark.RolledUntil.Equal(now) {
+			t.Fatalf("%s: second compact: %+v %v", name, res, err)
+		}
+		if after := snapshot(t, svc); !reflect.DeepEqual(after, before) {
+			t.Fatalf("%s: stats changed by second compaction:\nbefore %+v\nafter  %+v", name, before, after)
+		}
+		if res, err = svc.Compact(ctx, later, 48*time.Hour); err != nil || res.RolledUp != 0 || res.Deleted != 0 {
+			t.Fatalf("%s: third compact: %+v %v", name, res, err)
+		}
+
+		// A later click is read raw
+		late := analytics.Click{Code: "rolled", At: now.Add(10 * time.Minute), UserAgent: uaChromeWindows}
+		if err := svc.Record(ctx, late); err != nil {
+			t.Fatalf("%s: record: %v", name, err)
+		}
+		if v, _ := svc.Visitors(ctx, analytics.Query{Code: "rolled"}); v.Clicks != before.Clicks+1 {
+			t.Fatalf("%s: %d clicks after a new one, want %d", name, v.Clicks, before.Clicks+1)
+		}
+	}
+
+	// Rollups and the mark survive a restart of the file store
+	reopened, err := storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	v, err := analytics.NewService(reopened).Visitors(ctx, analytics.Query{Code: "rolled"})
+	if err != nil || v.Clicks != 8 {
+		t.Fatalf("reopened: %d clicks, %v", v.Clicks, err)
+	}
+}
+
+func TestRollups_ConcurrentRunSavesNothing(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}, &analytics.RollupMark{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	gormStore := storage.NewGormStore()
+	gormStore.SetDB(db)
+	fileStore, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	for name, store := range map[string]analytics.Store{"gorm": gormStore, "file": fileStore} {
+		svc := analytics.NewService(store)
+		if err := svc.Record(ctx, analytics.Click{Code: "once", At: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatalf("%s: record: %v", name, err)
+		}
+		until := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+		if _, err := svc.Compact(ctx, until.Add(time.Hour), 0); err != nil {
+			t.Fatalf("%s: compact: %v", name, err)
+		}
+
+		// A run that started before the first one saved finds the mark moved
+		stale := []analytics.Rollup{{Code: "once", Period: analytics.PeriodHour, Start: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), Class: "human", Clicks: 1}}
+		saved, err := store.SaveRollups(ctx, stale, time.Time{}, until)
+		if err != nil || saved {
+			t.Fatalf("%s: stale save: %v %v", name, saved, err)
+		}
+		if _, err := store.DeleteClicks(ctx, until); err != nil {
+			t.Fatalf("%s: delete: %v", name, err)
+		}
+		if v, _ := svc.Visitors(ctx, analytics.Query{Code: "once"}); v.Clicks != 1 {
+			t.Fatalf("%s: clicks = %d, want 1", name, v.Clicks)
+		}
+	}
+}
+
+func TestRollups_HalfHourZoneKeepsBuckets(t *testing.T) {
+	ctx := context.Background()
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}, &analytics.RollupMark{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	gormStore := storage.NewGormStore()
+	gormStore.SetDB(db)
+	fileStore, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	for name, store := range map[string]analytics.Store{"gorm": gormStore, "file": fileStore} {
+		svc := analytics.NewService(store)
+		// 23:45 on March 1st and 00:15 on March 2nd in Kolkata, within
+		// one UTC hour
+		for _, at := range []time.Time{
+			time.Date(2026, 3, 1, 18, 15, 0, 0, time.UTC),
+			time.Date(2026, 3, 1, 18, 45, 0, 0, time.UTC),
+		} {
+			if err := svc.Record(ctx, analytics.Click{Code: "ist", At: at}); err != nil {
+				t.Fatalf("%s: record: %v", name, err)
+			}
+		}
+		q := analytics.Query{Code: "ist", From: time.Date(2026, 3, 1, 0, 0, 0, 0, kolkata), To: time.Date(2026, 3, 3, 0, 0, 0, 0, kolkata)}
+		before, err := svc.Timeseries(ctx, q, analytics.IntervalDay, kolkata)
+		if err != nil {
+			t.Fatalf("%s: series: %v", name, err)
+		}
+		if _, err := svc.Compact(ctx, time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), 0); err != nil {
+			t.Fatalf("%s: compact: %v", name, err)
+		}
+		after, err := svc.Timeseries(ctx, q, analytics.IntervalDay, kolkata)
+		if err != nil {
+			t.Fatalf("%s: series: %v", name, err)
+		}
+		if want := []int64{1, 1}; !equalCounts(clickCounts(before), want) || !equalCounts(clickCounts(after), want) {
+			t.Fatalf("%s: days %v before compaction, %v after, want %v", name, clickCounts(before), clickCounts(after), want)
+		}
+	}
+}
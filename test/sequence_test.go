@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"tinygo/internal/config"
+	"tinygo/internal/shortener"
+	"tinygo/pkg/feistel"
+	"tinygo/pkg/random"
+)
+
+func TestFeistel_RoundTripAndUnique(t *testing.T) {
+	codec, err := feistel.New([]byte("secret"), random.Base62, 2)
+	if err != nil {
+		t.Fatalf("new codec: %v", err)
+	}
+	seen := make(map[string]bool)
+	// 62^2 = 3844 codes of length 2, then length 3 begins.
+	for n := uint64(0); n < 5000; n++ {
+		code := codec.Encode(n)
+		if seen[code] {
+			t.Fatalf("duplicate code %q for %d", code, n)
+		}
+		seen[code] = true
+		wantLen := 2
+		if n >= 3844 {
+			wantLen = 3
+		}
+		if len(code) != wantLen {
+			t.Fatalf("code %q for %d: want length %d", code, n, wantLen)
+		}
+		got, ok := codec.Decode(code)
+		if !ok || got != n {
+			t.Fatalf("decode %q: got %d ok=%v, want %d", code, got, ok, n)
+		}
+	}
+}
+
+func TestFeistel_KeyChangesCodes(t *testing.T) {
+	a, _ := feistel.New([]byte("one"), random.Base62, 5)
+	b, _ := feistel.New([]byte("two"), random.Base62, 5)
+	same := 0
+	for n := uint64(1); n <= 100; n++ {
+		if a.Encode(n) == b.Encode(n) {
+			same++
+		}
+	}
+	if same > 1 {
+		t.Fatalf("expected codes to depend on key, %d identical", same)
+	}
+}
+
+func TestService_SequentialStrategy(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	codec, _ := feistel.New([]byte("secret"), random.Base62, 4)
+	seq := st.Store.(shortener.Sequencer)
+	svc.RegisterGenerator(shortener.StrategySequential, shortener.NewSequentialGenerator(seq, codec))
+	if err := svc.SetStrategy(shortener.StrategySequential); err != nil {
+		t.Fatalf("set strategy: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		l, err := svc.Shorten(context.Background(), "https://golang.org", "")
+		if err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+		if n, ok := codec.Decode(l.Code); !ok || n != i {
+			t.Fatalf("code %q decodes to %d ok=%v, want %d", l.Code, n, ok, i)
+		}
+	}
+}
+
+func TestConfig_SequenceMinLength(t *testing.T) {
+	cfg := config.Default()
+	cfg.CodeStrategy = shortener.StrategySequential
+	cfg.Sequence.Secret = "secret"
+	cfg.Auth.Username, cfg.Auth.Password = "admin", "secret"
+	for length, valid := range map[int]bool{2: false, 3: true, 32: true, 33: false} {
+		cfg.Sequence.MinLength = length
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("min_length %d: %v", length, err)
+		}
+	}
+}
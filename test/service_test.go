@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"tinygo/internal/analytics"
 	"tinygo/internal/shortener"
 	"tinygo/internal/storage"
 
@@ -15,13 +16,13 @@ func newTempStore(t *testing.T) *storageTestAdapter {
 	t.Helper()
 
 	// Use in-memory SQLite for testing
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&shortener.Link{}); err != nil {
+	if err := db.AutoMigrate(&shortener.Link{}, &shortener.Counter{}, &analytics.Click{}, &analytics.VisitorSketch{}, &analytics.Rollup{}); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
 
@@ -45,7 +46,7 @@ func TestService_SoftenAndResolve(t *testing.T) {
 	if link.Code == "" || link.LongURL != "https://golang.org" {
 		t.Fatalf("unexpected link: %+v", link)
 	}
-	got, ok, err := svc.Resolve(context.Background(), link.Code)
+	got, ok, err := svc.Resolve(context.Background(), "", link.Code)
 	if err != nil || !ok {
 		t.Fatalf("resolve: %v ok=%v", err, ok)
 	}
@@ -58,10 +59,50 @@ func TestService_SoftenAndResolve(t *testing.T) {
 type storageTestAdapter struct {
 	Store interface {
 		Create(ctx context.Context, l shortener.Link) error
-		Get(ctx context.Context, code string) (shortener.Link, bool, error)
-		Delete(ctx context.Context, code string) error
-		IncrementHit(ctx context.Context, code string) (shortener.Link, error)
+		Get(ctx context.Context, domain, code string) (shortener.Link, bool, error)
+		Delete(ctx context.Context, domain, code string) error
+		IncrementHit(ctx context.Context, domain, code string) (shortener.Link, error)
+		IncrementBotHit(ctx context.Context, domain, code string) (shortener.Link, error)
+		AddHits(ctx context.Context, hits []shortener.Hits) error
+		Update(ctx context.Context, l shortener.Link) error
+		UpdateDetails(ctx context.Context, l shortener.Link) error
 		List(ctx context.Context) ([]shortener.Link, error)
+		Count(ctx context.Context) (int64, error)
 		SetDB(db *gorm.DB)
 	}
 }
+
+// racingStore counts a redirect right before each edit is written, as a
+// hit arriving between Edit reading and writing the link would.
+type racingStore struct {
+	shortener.Store
+}
+
+func (s racingStore) UpdateDetails(ctx context.Context, l shortener.Link) error {
+	if _, err := s.IncrementHit(ctx, l.Domain, l.Code); err != nil {
+		return err
+	}
+	return s.Store.UpdateDetails(ctx, l)
+}
+
+func TestService_EditKeepsConcurrentHits(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(racingStore{newTempStore(t).Store}, "http://localhost:8080", 6)
+	if _, err := svc.Shorten(ctx, "https://example.com/", "busy"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := svc.Hit(ctx, "", "busy"); err != nil {
+		t.Fatalf("hit: %v", err)
+	}
+	url := "https://example.com/moved"
+	l, ok, err := svc.Edit(ctx, "", "busy", shortener.LinkPatch{LongURL: &url})
+	if err != nil || !ok {
+		t.Fatalf("edit: %v", err)
+	}
+	if l.HitCount != 2 || l.LongURL != url {
+		t.Fatalf("edit lost hits: %+v", l)
+	}
+	if stored, _, _ := svc.Resolve(ctx, "", "busy"); stored.HitCount != 2 {
+		t.Fatalf("stored hit count %d, want 2", stored.HitCount)
+	}
+}
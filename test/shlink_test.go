@@ -0,0 +1,190 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"tinygo/internal/config"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+	httphandler "tinygo/internal/transport/http"
+)
+
+func newShlinkServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	logger.Init("error", "text")
+	cfg := config.Default()
+	cfg.Auth.APIKeys = []string{"s3cret"}
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	srv := httptest.NewServer(httphandler.NewMux(httphandler.Services{Links: svc}, cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func shlinkCall(t *testing.T, srv *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+"/rest/v3"+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	req.Header.Set("X-Api-Key", "s3cret")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			t.Fatalf("decode %s: %v", b, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type shlinkURL struct {
+	ShortCode     string  `json:"shortCode"`
+	ShortURL      string  `json:"shortUrl"`
+	LongURL       string  `json:"longUrl"`
+	Title         *string `json:"title"`
+	VisitsSummary struct {
+		Total int64 `json:"total"`
+	} `json:"visitsSummary"`
+}
+
+func TestShlink_CRUD(t *testing.T) {
+	srv := newShlinkServer(t)
+
+	var created shlinkURL
+	status := shlinkCall(t, srv, "POST", "/short-urls", `{"longUrl":"https://example.com/a","customSlug":"docs","title":"Docs"}`, &created)
+	if status != http.StatusOK || created.ShortURL != "http://localhost:8080/docs" || created.Title == nil || *created.Title != "Docs" {
+		t.Fatalf("create: %d %+v", status, created)
+	}
+
+	var problem struct {
+		Type            string   `json:"type"`
+		InvalidElements []string `json:"invalidElements"`
+	}
+	status = shlinkCall(t, srv, "POST", "/short-urls", `{"longUrl":"https://example.com/b","customSlug":"docs"}`, &problem)
+	if status != http.StatusBadRequest || problem.Type != "https://shlink.io/api/error/non-unique-slug" {
+		t.Fatalf("duplicate slug: %d %+v", status, problem)
+	}
+	status = shlinkCall(t, srv, "POST", "/short-urls", `{"longUrl":"nope"}`, &problem)
+	if status != http.StatusBadRequest || len(problem.InvalidElements) != 1 || problem.InvalidElements[0] != "longUrl" {
+		t.Fatalf("invalid url: %d %+v", status, problem)
+	}
+
+	var edited shlinkURL
+	status = shlinkCall(t, srv, "PATCH", "/short-urls/docs", `{"longUrl":"https://example.com/new","title":null}`, &edited)
+	if status != http.StatusOK || edited.LongURL != "https://example.com/new" || edited.Title != nil {
+		t.Fatalf("edit: %d %+v", status, edited)
+	}
+	var got shlinkURL
+	if status := shlinkCall(t, srv, "GET", "/short-urls/docs", "", &got); status != http.StatusOK || got.LongURL != edited.LongURL {
+		t.Fatalf("get: %d %+v", status, got)
+	}
+
+	var visits struct {
+		Visits struct {
+			Data []any `json:"data"`
+		} `json:"visits"`
+	}
+	if status := shlinkCall(t, srv, "GET", "/short-urls/docs/visits", "", &visits); status != http.StatusOK {
+		t.Fatalf("visits: %d", status)
+	}
+
+	if status := shlinkCall(t, srv, "DELETE", "/short-urls/docs", "", nil); status != http.StatusNoContent {
+		t.Fatalf("delete: %d", status)
+	}
+	if status := shlinkCall(t, srv, "GET", "/short-urls/docs", "", &problem); status != http.StatusNotFound ||
+		problem.Type != "https://shlink.io/api/error/short-url-not-found" {
+		t.Fatalf("get deleted: %d %+v", status, problem)
+	}
+}
+
+func TestShlink_ListPagination(t *testing.T) {
+	srv := newShlinkServer(t)
+	for _, slug := range []string{"alpha", "bravo", "charlie", "delta", "echo"} {
+		if status := shlinkCall(t, srv, "POST", "/short-urls", `{"longUrl":"https://example.com/`+slug+`","customSlug":"`+slug+`"}`, nil); status != http.StatusOK {
+			t.Fatalf("create %s: %d", slug, status)
+		}
+	}
+
+	var list struct {
+		ShortUrls struct {
+			Data       []shlinkURL `json:"data"`
+			Pagination struct {
+				CurrentPage        int   `json:"currentPage"`
+				PagesCount         int   `json:"pagesCount"`
+				ItemsInCurrentPage int   `json:"itemsInCurrentPage"`
+				TotalItems         int64 `json:"totalItems"`
+			} `json:"pagination"`
+		} `json:"shortUrls"`
+	}
+	status := shlinkCall(t, srv, "GET", "/short-urls?page=2&itemsPerPage=2&orderBy=shortCode-DESC", "", &list)
+	if status != http.StatusOK {
+		t.Fatalf("list: %d", status)
+	}
+	p := list.ShortUrls.Pagination
+	if p.CurrentPage != 2 || p.PagesCount != 3 || p.TotalItems != 5 || p.ItemsInCurrentPage != 2 {
+		t.Fatalf("unexpected pagination: %+v", p)
+	}
+	if d := list.ShortUrls.Data; d[0].ShortCode != "charlie" || d[1].ShortCode != "bravo" {
+		t.Fatalf("unexpected page: %+v", d)
+	}
+
+	status = shlinkCall(t, srv, "GET", "/short-urls?searchTerm=ELT&itemsPerPage=-1", "", &list)
+	if status != http.StatusOK || len(list.ShortUrls.Data) != 1 || list.ShortUrls.Data[0].ShortCode != "delta" {
+		t.Fatalf("search: %d %+v", status, list.ShortUrls.Data)
+	}
+
+	if status := shlinkCall(t, srv, "GET", "/short-urls?orderBy=bogus-ASC", "", nil); status != http.StatusBadRequest {
+		t.Fatalf("bad order: %d", status)
+	}
+}
+
+func TestShlink_RequiresAPIKey(t *testing.T) {
+	srv := newShlinkServer(t)
+	resp, err := http.Get(srv.URL + "/rest/v3/short-urls")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestService_PageWithoutPager(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	svc := shortener.NewService(store, "http://localhost:8080", 6)
+	for _, code := range []string{"alpha", "bravo", "charlie"} {
+		if _, err := svc.ShortenWith(ctx, "https://example.com/"+code, shortener.ShortenOptions{CustomCode: code, Title: "T " + code}); err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+	}
+	links, total, err := svc.Page(ctx, shortener.PageQuery{Search: "t b", OrderBy: shortener.OrderCode})
+	if err != nil || total != 1 || len(links) != 1 || links[0].Code != "bravo" {
+		t.Fatalf("search: %v %d %+v", err, total, links)
+	}
+	links, total, err = svc.Page(ctx, shortener.PageQuery{OrderBy: shortener.OrderCode, Desc: true, Offset: 1, Limit: 1})
+	if err != nil || total != 3 || len(links) != 1 || links[0].Code != "bravo" {
+		t.Fatalf("page: %v %d %+v", err, total, links)
+	}
+	if _, _, err := svc.Page(ctx, shortener.PageQuery{OrderBy: "nope"}); !errors.Is(err, shortener.ErrPageOrder) {
+		t.Fatalf("expected ErrPageOrder, got %v", err)
+	}
+}
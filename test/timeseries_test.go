@@ -0,0 +1,151 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/storage"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func clickCounts(s analytics.Series) []int64 {
+	counts := make([]int64, len(s.Buckets))
+	for i, b := range s.Buckets {
+		counts[i] = b.Clicks
+	}
+	return counts
+}
+
+func equalCounts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTimeseries(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	services := map[string]*analytics.Service{
+		"gorm": newAnalyticsEnv(t, nil).analytics,
+		"file": analytics.NewService(fileStore),
+	}
+	berlin, kolkata := mustLocation(t, "Europe/Berlin"), mustLocation(t, "Asia/Kolkata")
+
+	for name, svc := range services {
+		for _, at := range []time.Time{
+			time.Date(2026, 3, 28, 22, 30, 0, 0, time.UTC), // 23:30 on the 28th in Berlin
+			time.Date(2026, 3, 28, 23, 30, 0, 0, time.UTC), // 00:30 on the 29th in Berlin
+			time.Date(2026, 3, 29, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 1, 10, 10, 0, 0, time.UTC), // 15:40 in Kolkata
+			time.Date(2026, 3, 1, 10, 40, 0, 0, time.UTC), // 16:10 in Kolkata
+		} {
+			if err := svc.Record(ctx, analytics.Click{Code: "series", At: at, UserAgent: "ua"}); err != nil {
+				t.Fatalf("%s: record: %v", name, err)
+			}
+		}
+		if err := svc.Record(ctx, analytics.Click{Code: "other", At: time.Date(2026, 3, 29, 12, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatalf("%s: record: %v", name, err)
+		}
+
+		// Days across the start of daylight saving time, zero-filled
+		q := analytics.Query{Code: "series", From: time.Date(2026, 3, 27, 0, 0, 0, 0, berlin), To: time.Date(2026, 3, 31, 0, 0, 0, 0, berlin)}
+		s, err := svc.Timeseries(ctx, q, analytics.IntervalDay, berlin)
+		if err != nil {
+			t.Fatalf("%s: days: %v", name, err)
+		}
+		if want := []int64{0, 1, 2, 0}; !equalCounts(clickCounts(s), want) || s.Total != 3 {
+			t.Errorf("%s: days = %v, want %v", name, clickCounts(s), want)
+		}
+		if got := s.Buckets[2].Start; !got.Equal(time.Date(2026, 3, 28, 23, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: third day starts %v", name, got)
+		}
+
+		// Hours of a zone with a half-hour offset
+		q = analytics.Query{Code: "series", From: time.Date(2026, 3, 1, 15, 0, 0, 0, kolkata), To: time.Date(2026, 3, 1, 18, 0, 0, 0, kolkata)}
+		if s, err = svc.Timeseries(ctx, q, analytics.IntervalHour, kolkata); err != nil {
+			t.Fatalf("%s: hours: %v", name, err)
+		}
+		if want := []int64{1, 1, 0}; !equalCounts(clickCounts(s), want) {
+			t.Errorf("%s: hours = %v, want %v", name, clickCounts(s), want)
+		}
+
+		// Weeks start on Monday; all links
+		q = analytics.Query{From: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)}
+		if s, err = svc.Timeseries(ctx, q, analytics.IntervalWeek, time.UTC); err != nil {
+			t.Fatalf("%s: weeks: %v", name, err)
+		}
+		if want := []int64{2, 0, 0, 0, 4}; !equalCounts(clickCounts(s), want) || !s.From.Equal(time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: weeks = %v from %v, want %v", name, clickCounts(s), s.From, want)
+		}
+	}
+}
+
+func TestTimeseries_DaylightSavingHours(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	berlin := mustLocation(t, "Europe/Berlin")
+	// The day daylight saving time ends has 25 hours
+	q := analytics.Query{Code: "none", From: time.Date(2026, 10, 25, 0, 0, 0, 0, berlin), To: time.Date(2026, 10, 26, 0, 0, 0, 0, berlin)}
+	s, err := env.analytics.Timeseries(context.Background(), q, analytics.IntervalHour, berlin)
+	if err != nil {
+		t.Fatalf("timeseries: %v", err)
+	}
+	if len(s.Buckets) != 25 {
+		t.Fatalf("got %d hourly buckets, want 25", len(s.Buckets))
+	}
+}
+
+func TestTimeseriesAPI(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	ctx := context.Background()
+	if _, err := env.links.Shorten(ctx, "https://example.com/", "daily"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	env.visit(t, "daily", map[string]string{"User-Agent": uaChromeWindows})
+	env.visit(t, "daily", map[string]string{"User-Agent": "curl/8.4.0"})
+
+	var s analytics.Series
+	if status := env.getJSON(t, "/api/links/daily/timeseries?interval=hour&tz=America/New_York", &s); status != http.StatusOK {
+		t.Fatalf("timeseries: %d", status)
+	}
+	if s.Interval != analytics.IntervalHour || s.TZ != "America/New_York" || s.Total != 2 || len(s.Buckets) < 24 {
+		t.Fatalf("unexpected series: %+v", s)
+	}
+	if last := s.Buckets[len(s.Buckets)-1]; last.Clicks != 2 {
+		t.Fatalf("current hour has %d clicks", last.Clicks)
+	}
+	if status := env.getJSON(t, "/api/timeseries?class=human", &s); status != http.StatusOK || s.Total != 1 || len(s.Buckets) != 31 {
+		t.Fatalf("global: %d %+v", status, s)
+	}
+	for _, path := range []string{
+		"/api/timeseries?interval=month",
+		"/api/timeseries?tz=Mars/Olympus",
+		"/api/timeseries?from=2026-03-02&to=2026-03-01",
+		"/api/timeseries?interval=hour&from=2020-01-01&to=2026-01-01",
+		"/api/timeseries?class=alien",
+	} {
+		if status := env.getJSON(t, path, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", path, status)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/internal/shortener"
+	"tinygo/internal/storage"
+	"tinygo/internal/transfer"
+	"tinygo/pkg/wordfilter"
+)
+
+func TestTransfer_ExportImportRoundTrip(t *testing.T) {
+	for _, format := range []transfer.Format{transfer.CSV, transfer.NDJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			src := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+			for _, code := range []string{"alpha", "beta"} {
+				if _, err := src.Shorten(ctx, "https://example.com/"+code, code); err != nil {
+					t.Fatalf("shorten: %v", err)
+				}
+			}
+			if _, err := src.Hit(ctx, "", "alpha"); err != nil {
+				t.Fatalf("hit: %v", err)
+			}
+			if _, err := src.BotHit(ctx, "", "alpha"); err != nil {
+				t.Fatalf("bot hit: %v", err)
+			}
+
+			var buf bytes.Buffer
+			w, err := transfer.NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("writer: %v", err)
+			}
+			if n, err := transfer.Export(ctx, src, w); err != nil || n != 2 {
+				t.Fatalf("export: n=%d err=%v", n, err)
+			}
+
+			store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "links.json"))
+			if err != nil {
+				t.Fatalf("file store: %v", err)
+			}
+			dst := shortener.NewService(store, "http://localhost:8080", 6)
+			r, err := transfer.NewReader(bytes.NewReader(buf.Bytes()), format)
+			if err != nil {
+				t.Fatalf("reader: %v", err)
+			}
+			report, err := transfer.Import(ctx, dst, r, transfer.Options{Policy: shortener.ConflictSkip})
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if report.Created != 2 || report.Failed != 0 {
+				t.Fatalf("unexpected report: %+v", report)
+			}
+			got, ok, _ := dst.Resolve(ctx, "", "alpha")
+			want, _, _ := src.Resolve(ctx, "", "alpha")
+			if !ok || got.HitCount != 1 || got.BotHitCount != 1 || !got.CreatedAt.Equal(want.CreatedAt) {
+				t.Fatalf("imported %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTransfer_ImportPolicies(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	if _, err := svc.Shorten(ctx, "https://old.example", "taken"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	input := "code,long_url,hit_count,created_at\n" +
+		"taken,https://new.example,7,2020-01-02T03:04:05Z\n" +
+		"fresh,https://fresh.example,,\n" +
+		"x,https://short.example,,\n" +
+		"\"bad,https://quote.example,,\n"
+
+	read := func() transfer.Reader {
+		r, err := transfer.NewReader(strings.NewReader(input), transfer.CSV)
+		if err != nil {
+			t.Fatalf("reader: %v", err)
+		}
+		return r
+	}
+
+	report, err := transfer.Import(ctx, svc, read(), transfer.Options{Policy: shortener.ConflictOverwrite, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Overwritten != 1 || report.Created != 1 || report.Failed != 2 {
+		t.Fatalf("unexpected dry run report: %+v", report)
+	}
+	if report.Errors[0].Row != 4 || report.Errors[0].Code != "x" {
+		t.Fatalf("unexpected row error: %+v", report.Errors[0])
+	}
+	if l, _, _ := svc.Resolve(ctx, "", "taken"); l.LongURL != "https://old.example" {
+		t.Fatal("dry run modified a link")
+	}
+	if _, ok, _ := svc.Resolve(ctx, "", "fresh"); ok {
+		t.Fatal("dry run created a link")
+	}
+
+	report, err = transfer.Import(ctx, svc, read(), transfer.Options{Policy: shortener.ConflictRename})
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if report.Renamed != 1 || report.Created != 1 || len(report.Renames) != 1 {
+		t.Fatalf("unexpected rename report: %+v", report)
+	}
+	renamed, ok, _ := svc.Resolve(ctx, "", report.Renames[0].To)
+	if !ok || renamed.LongURL != "https://new.example" || renamed.HitCount != 7 {
+		t.Fatalf("unexpected renamed link: %+v", renamed)
+	}
+
+	report, err = transfer.Import(ctx, svc, read(), transfer.Options{Policy: shortener.ConflictOverwrite})
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if report.Overwritten != 2 {
+		t.Fatalf("unexpected overwrite report: %+v", report)
+	}
+	l, _, _ := svc.Resolve(ctx, "", "taken")
+	if l.LongURL != "https://new.example" || l.HitCount != 7 || !l.CreatedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected overwritten link: %+v", l)
+	}
+}
+
+func TestTransfer_ImportChecksBlockedWordsAndEarlierRows(t *testing.T) {
+	ctx := context.Background()
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	svc.SetFilter(wordfilter.New([]string{"fuck"}))
+	input := "code,long_url\n" +
+		"fuck-it,https://blocked.example\n" +
+		"twice,https://first.example\n" +
+		"twice,https://second.example\n"
+	read := func() transfer.Reader {
+		r, err := transfer.NewReader(strings.NewReader(input), transfer.CSV)
+		if err != nil {
+			t.Fatalf("reader: %v", err)
+		}
+		return r
+	}
+
+	report, err := transfer.Import(ctx, svc, read(), transfer.Options{Policy: shortener.ConflictRename, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Created != 1 || report.Renamed != 1 || report.Rejected != 1 || report.Failed != 1 {
+		t.Fatalf("unexpected dry run report: %+v", report)
+	}
+	if !errors.Is(report.Errors[0].Err, shortener.ErrBlockedCode) {
+		t.Fatalf("expected ErrBlockedCode, got %+v", report.Errors[0])
+	}
+
+	imported, err := transfer.Import(ctx, svc, read(), transfer.Options{Policy: shortener.ConflictRename})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if imported.Created != report.Created || imported.Renamed != report.Renamed || imported.Failed != report.Failed {
+		t.Fatalf("dry run %+v differs from import %+v", report, imported)
+	}
+	if _, ok, _ := svc.Resolve(ctx, "", "fuck-it"); ok {
+		t.Fatal("blocked code was imported")
+	}
+}
+
+// brokenStore fails every lookup.
+type brokenStore struct {
+	shortener.Store
+}
+
+func (brokenStore) Get(context.Context, string, string) (shortener.Link, bool, error) {
+	return shortener.Link{}, false, errors.New("database is gone")
+}
+
+func TestTransfer_ImportStopsOnStoreError(t *testing.T) {
+	svc := shortener.NewService(brokenStore{newTempStore(t).Store}, "http://localhost:8080", 6)
+	r, err := transfer.NewReader(strings.NewReader("code,long_url\nfine,https://fine.example\n"), transfer.CSV)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	report, err := transfer.Import(context.Background(), svc, r, transfer.Options{})
+	if !errors.Is(err, transfer.ErrStore) {
+		t.Fatalf("expected ErrStore, got %v", err)
+	}
+	if report.Failed != 0 {
+		t.Fatalf("store error reported as a row error: %+v", report)
+	}
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tinygo/internal/analytics"
+	"tinygo/pkg/useragent"
+)
+
+const (
+	uaChromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	uaSafariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+	uaChromeAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.6167.101 Mobile Safari/537.36"
+)
+
+func TestUserAgentParse(t *testing.T) {
+	p := useragent.Builtin()
+	cases := []struct {
+		ua   string
+		want useragent.Agent
+	}{
+		{uaChromeWindows, useragent.Agent{Browser: "Chrome", BrowserVersion: "120", OS: "Windows", Device: useragent.Desktop, Class: useragent.Human}},
+		{uaSafariIPhone, useragent.Agent{Browser: "Safari", BrowserVersion: "17", OS: "iOS", Device: useragent.Mobile, Class: useragent.Human}},
+		{uaChromeAndroid, useragent.Agent{Browser: "Chrome", BrowserVersion: "121", OS: "Android", Device: useragent.Mobile, Class: useragent.Human}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			useragent.Agent{Browser: "Chrome", BrowserVersion: "120", OS: "Android", Device: useragent.Tablet, Class: useragent.Human}},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			useragent.Agent{Browser: "Safari", BrowserVersion: "16", OS: "iOS", Device: useragent.Tablet, Class: useragent.Human}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			useragent.Agent{Browser: "Edge", BrowserVersion: "120", OS: "Windows", Device: useragent.Desktop, Class: useragent.Human}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.2; rv:121.0) Gecko/20100101 Firefox/121.0",
+			useragent.Agent{Browser: "Firefox", BrowserVersion: "121", OS: "macOS", Device: useragent.Desktop, Class: useragent.Human}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			useragent.Agent{Browser: "Googlebot", OS: useragent.Other, Device: useragent.Bot, Class: useragent.Crawler}},
+		{"curl/8.4.0", useragent.Agent{Browser: "curl", OS: useragent.Other, Device: useragent.Bot, Class: useragent.Crawler}},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			useragent.Agent{Browser: "Slackbot", OS: useragent.Other, Device: useragent.Bot, Class: useragent.Preview}},
+		{"facebookexternalhit/1.1 Facebot Twitterbot/1.0",
+			useragent.Agent{Browser: "Twitterbot", OS: useragent.Other, Device: useragent.Bot, Class: useragent.Preview}},
+		{"", useragent.Agent{Browser: useragent.Other, OS: useragent.Other, Device: useragent.Bot, Class: useragent.Crawler}},
+		{"SomethingNew/1.0", useragent.Agent{Browser: useragent.Other, OS: useragent.Other, Device: useragent.Desktop, Class: useragent.Human}},
+	}
+	for _, c := range cases {
+		if got := p.Parse(c.ua); got != c.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.ua, got, c.want)
+		}
+	}
+}
+
+func TestUserAgentLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `{"browsers": [{"name": "Ladybird", "pattern": "Ladybird/(\\d+)"}], "devices": [{"name": "tablet", "pattern": "TabletOS"}]}`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	p, err := useragent.Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if a := p.Parse("Mozilla/5.0 (X11; Linux x86_64; TabletOS) Ladybird/1.0"); a.Browser != "Ladybird" || a.BrowserVersion != "1" || a.OS != "Linux" || a.Device != useragent.Tablet {
+		t.Fatalf("custom rules not applied: %+v", a)
+	}
+	// Built-in rules still apply after the custom ones
+	if a := p.Parse(uaChromeWindows); a.Browser != "Chrome" {
+		t.Fatalf("built-in rules lost: %+v", a)
+	}
+
+	for _, bad := range []string{`{"browsers": [{"name": "X", "pattern": "("}]}`, `{"devices": [{"name": "phablet", "pattern": "x"}]}`, `not json`} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatalf("write rules: %v", err)
+		}
+		if _, err := useragent.Load(path); err == nil {
+			t.Errorf("Load accepted %s", bad)
+		}
+	}
+}
+
+func TestDeviceBreakdowns(t *testing.T) {
+	env := newAnalyticsEnv(t, nil)
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/app", "download"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	for _, ua := range []string{uaChromeWindows, uaChromeWindows, uaChromeAndroid, uaSafariIPhone, "curl/8.4.0"} {
+		env.visit(t, "download", map[string]string{"User-Agent": ua})
+	}
+
+	var browsers analytics.Tree
+	if status := env.getJSON(t, "/api/links/download/stats/browsers", &browsers); status != http.StatusOK {
+		t.Fatalf("browsers: %d", status)
+	}
+	if browsers.Total != 5 || len(browsers.Items) != 3 {
+		t.Fatalf("unexpected browsers: %+v", browsers)
+	}
+	chrome := browsers.Items[0]
+	if chrome.Value != "Chrome" || chrome.Clicks != 3 || len(chrome.Items) != 2 || chrome.Items[0].Value != "120" || chrome.Items[0].Clicks != 2 {
+		t.Fatalf("unexpected chrome breakdown: %+v", chrome)
+	}
+
+	var devices analytics.Tree
+	if status := env.getJSON(t, "/api/links/download/stats/devices", &devices); status != http.StatusOK {
+		t.Fatalf("devices: %d", status)
+	}
+	want := []analytics.Item{{Value: "desktop", Clicks: 2}, {Value: "mobile", Clicks: 2}, {Value: "bot", Clicks: 1}}
+	if len(devices.Items) != len(want) {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+	for i, it := range want {
+		if devices.Items[i].Value != it.Value || devices.Items[i].Clicks != it.Clicks {
+			t.Fatalf("unexpected devices: %+v", devices)
+		}
+	}
+
+	var oses analytics.Tree
+	if status := env.getJSON(t, "/api/links/download/stats/os", &oses); status != http.StatusOK || oses.Items[0].Value != "Windows" {
+		t.Fatalf("os: %d %+v", status, oses)
+	}
+	if status := env.getJSON(t, "/api/links/download/stats/unknown", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown breakdown: %d", status)
+	}
+}
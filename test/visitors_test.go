@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tinygo/internal/analytics"
+	"tinygo/internal/config"
+	"tinygo/internal/storage"
+	"tinygo/pkg/hll"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHLLCount(t *testing.T) {
+	seed := maphash.MakeSeed()
+	hash := func(i int) uint64 {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		return maphash.Bytes(seed, b[:])
+	}
+	for _, n := range []int{0, 1, 10, 1000, 50000} {
+		s := hll.New()
+		for i := range n {
+			s.Add(hash(i))
+			s.Add(hash(i)) // duplicates do not count
+		}
+		got := float64(s.Count())
+		if math.Abs(got-float64(n)) > 0.05*float64(n)+0.5 {
+			t.Errorf("Count of %d distinct = %v", n, got)
+		}
+
+		b, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		var decoded hll.Sketch
+		if err := decoded.UnmarshalBinary(b); err != nil || decoded.Count() != s.Count() {
+			t.Fatalf("round trip of %d: %v, %d", n, err, decoded.Count())
+		}
+	}
+
+	// Merging overlapping sketches counts the union
+	a, b := hll.New(), hll.New()
+	for i := range 3000 {
+		a.Add(hash(i))
+		b.Add(hash(i + 2000))
+	}
+	a.Merge(b)
+	if got := float64(a.Count()); math.Abs(got-5000) > 250 {
+		t.Errorf("merged count = %v, want about 5000", got)
+	}
+	if err := new(hll.Sketch).UnmarshalBinary([]byte{9, 12}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestUniqueVisitors(t *testing.T) {
+	env := newAnalyticsEnv(t, func(cfg *config.Config) { cfg.Analytics.TrustProxy = true })
+	if _, err := env.links.Shorten(context.Background(), "https://example.com/post", "post"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	// Three visitors, one of them reloading twice
+	for _, v := range []struct{ ip, ua string }{
+		{"192.0.2.1", uaChromeWindows}, {"192.0.2.1", uaChromeWindows}, {"192.0.2.1", uaChromeWindows},
+		{"192.0.2.1", uaSafariIPhone}, {"198.51.100.7", uaChromeWindows},
+	} {
+		env.visit(t, "post", map[string]string{"X-Forwarded-For": v.ip, "User-Agent": v.ua})
+	}
+
+	var stats analytics.VisitorStats
+	if status := env.getJSON(t, "/api/links/post/stats", &stats); status != http.StatusOK {
+		t.Fatalf("stats: %d", status)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if stats.Clicks != 5 || stats.UniqueVisitors != 3 || len(stats.Days) != 1 || stats.Days[0] != (analytics.DayVisitors{Day: today, UniqueVisitors: 3}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if status := env.getJSON(t, "/api/links/missing/stats", nil); status != http.StatusNotFound {
+		t.Fatalf("missing link: %d", status)
+	}
+}
+
+func TestUniqueVisitors_AcrossDays(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	svc := analytics.NewService(store)
+	svc.SetVisitorSecret("test")
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	for i := range 40 {
+		ip := fmt.Sprintf("192.0.2.%d", i)
+		if err := svc.Record(ctx, analytics.Click{Code: "launch", IP: ip, UserAgent: "ua", At: day1}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		if i < 10 {
+			if err := svc.Record(ctx, analytics.Click{Code: "launch", IP: ip, UserAgent: "ua", At: day2}); err != nil {
+				t.Fatalf("record: %v", err)
+			}
+		}
+	}
+
+	// The sketches survive reloading the store
+	store, err = storage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	svc = analytics.NewService(store)
+	stats, err := svc.Visitors(ctx, analytics.Query{Code: "launch"})
+	if err != nil {
+		t.Fatalf("visitors: %v", err)
+	}
+	// Salts differ per day, so returning visitors count once per day
+	if stats.Clicks != 50 || len(stats.Days) != 2 || stats.Days[0].UniqueVisitors != 40 || stats.Days[1].UniqueVisitors != 10 || stats.UniqueVisitors != 50 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	stats, err = svc.Visitors(ctx, analytics.Query{Code: "launch", From: day2.Truncate(24 * time.Hour)})
+	if err != nil || len(stats.Days) != 1 || stats.UniqueVisitors != 10 || stats.Clicks != 10 {
+		t.Fatalf("day two: %v %+v", err, stats)
+	}
+}
+
+func TestUniqueVisitors_SecretKeptAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&analytics.Click{}, &analytics.VisitorSketch{}, &analytics.VisitorSecret{}, &analytics.RollupMark{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	gormStore := storage.NewGormStore()
+	gormStore.SetDB(db)
+	path := filepath.Join(t.TempDir(), "links.json")
+	stores := map[string]func() analytics.Store{
+		"gorm": func() analytics.Store { return gormStore },
+		"file": func() analytics.Store {
+			// Restarts reload the data file
+			store, err := storage.NewFileStore(path)
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			return store
+		},
+	}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, open := range stores {
+		var svc *analytics.Service
+		for restart := range 2 {
+			svc = analytics.NewService(open())
+			if err := svc.LoadVisitorSecret(ctx); err != nil {
+				t.Fatalf("%s: load secret: %v", name, err)
+			}
+			click := analytics.Click{Code: "again", IP: "192.0.2.1", UserAgent: "ua", At: at.Add(time.Duration(restart) * time.Hour)}
+			if err := svc.Record(ctx, click); err != nil {
+				t.Fatalf("%s: record: %v", name, err)
+			}
+		}
+		stats, err := svc.Visitors(ctx, analytics.Query{Code: "again"})
+		if err != nil || stats.Clicks != 2 || stats.UniqueVisitors != 1 {
+			t.Fatalf("%s: %v %+v", name, err, stats)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tinygo/internal/shortener"
+	"tinygo/pkg/wordfilter"
+)
+
+func TestWordFilter_FoldsLeetspeakAndCase(t *testing.T) {
+	f := wordfilter.New([]string{"shit", "slut"})
+	for _, s := range []string{"xSHITx", "a5h1t9", "sh_it", "s1ut", "SLUT"} {
+		if !f.Blocked(s) {
+			t.Errorf("expected %q to be blocked", s)
+		}
+	}
+	for _, s := range []string{"abc123", "shot", "Xy9Qz"} {
+		if f.Blocked(s) {
+			t.Errorf("expected %q to pass", s)
+		}
+	}
+}
+
+func TestWordFilter_BuiltinLists(t *testing.T) {
+	f, err := wordfilter.Load(true)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if f.Len() == 0 {
+		t.Fatal("expected builtin words")
+	}
+	if !f.Blocked("m3rd3") || !f.Blocked("Sch3iss") {
+		t.Fatal("expected non-English words to be blocked")
+	}
+}
+
+func TestService_RejectsBlockedCustomCode(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	svc.SetFilter(wordfilter.New([]string{"fuck"}))
+
+	_, err := svc.Shorten(context.Background(), "https://golang.org", "fuck-it")
+	if !errors.Is(err, shortener.ErrBlockedCode) {
+		t.Fatalf("expected ErrBlockedCode, got %v", err)
+	}
+	if _, err := svc.Shorten(context.Background(), "https://golang.org", "gopher"); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+}
+
+func TestWordFilter_TokensSparseOrdinaryWords(t *testing.T) {
+	f, err := wordfilter.Load(true)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, s := range []string{"document", "title", "analytics", "parser", "grape", "essex", "cocktail", "raccoon", "scunthorpe", "spring-sale"} {
+		if w, ok := f.MatchToken(s); ok {
+			t.Errorf("expected %q to pass, matched %q", s, w)
+		}
+	}
+	for _, s := range []string{"shit", "5h1t", "no-SHIT", "holy_shit", "holyShit"} {
+		if !f.BlockedToken(s) {
+			t.Errorf("expected %q to be blocked", s)
+		}
+	}
+}
+
+func TestService_CustomCodeMayContainBlockedSubstring(t *testing.T) {
+	st := newTempStore(t)
+	svc := shortener.NewService(st.Store, "http://localhost:8080", 6)
+	svc.SetFilter(wordfilter.New([]string{"rape", "cock"}))
+	for _, code := range []string{"grape", "cocktail-bar"} {
+		if _, err := svc.Shorten(context.Background(), "https://golang.org", code); err != nil {
+			t.Errorf("shorten %s: %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/internal/config"
+	"tinygo/internal/logger"
+	"tinygo/internal/shortener"
+	httphandler "tinygo/internal/transport/http"
+)
+
+func newYOURLSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	logger.Init("error", "text")
+	cfg := config.Default()
+	cfg.Auth.APIKeys = []string{"s3cret"}
+	svc := shortener.NewService(newTempStore(t).Store, "http://localhost:8080", 6)
+	srv := httptest.NewServer(httphandler.NewMux(httphandler.Services{Links: svc}, cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func yourlsCall(t *testing.T, srv *httptest.Server, params url.Values) (int, string) {
+	t.Helper()
+	resp, err := http.PostForm(srv.URL+"/yourls-api.php", params)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestYOURLS_ShortenExpandStats(t *testing.T) {
+	srv := newYOURLSServer(t)
+
+	status, body := yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"shorturl"}, "format": {"json"},
+		"url": {"https://example.com/page"}, "keyword": {"docs"}, "title": {"Docs"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("shorturl: %d %s", status, body)
+	}
+	var created struct {
+		Status   string `json:"status"`
+		ShortURL string `json:"shorturl"`
+		URL      struct {
+			Keyword string `json:"keyword"`
+			Title   string `json:"title"`
+		} `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.Status != "success" || created.ShortURL != "http://localhost:8080/docs" || created.URL.Title != "Docs" {
+		t.Fatalf("unexpected shorturl response: %s", body)
+	}
+
+	status, body = yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"shorturl"}, "format": {"json"},
+		"url": {"https://example.com/other"}, "keyword": {"docs"},
+	})
+	if status != http.StatusBadRequest || !strings.Contains(body, `"code":"error:keyword"`) {
+		t.Fatalf("duplicate keyword: %d %s", status, body)
+	}
+
+	status, body = yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"expand"}, "format": {"simple"}, "shorturl": {created.ShortURL},
+	})
+	if status != http.StatusOK || body != "https://example.com/page" {
+		t.Fatalf("expand: %d %q", status, body)
+	}
+
+	status, body = yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"url-stats"}, "shorturl": {"docs"},
+	})
+	if status != http.StatusOK || !strings.Contains(body, "<result>") || !strings.Contains(body, "<clicks>0</clicks>") {
+		t.Fatalf("url-stats: %d %s", status, body)
+	}
+
+	status, body = yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"db-stats"}, "format": {"json"},
+	})
+	if status != http.StatusOK || !strings.Contains(body, `"total_links":"1"`) {
+		t.Fatalf("db-stats: %d %s", status, body)
+	}
+
+	status, body = yourlsCall(t, srv, url.Values{
+		"signature": {"s3cret"}, "action": {"expand"}, "format": {"jsonp"}, "callback": {"cb"}, "shorturl": {"missing"},
+	})
+	if status != http.StatusNotFound || !strings.HasPrefix(body, "cb(") {
+		t.Fatalf("expand missing: %d %s", status, body)
+	}
+}
+
+func TestYOURLS_Auth(t *testing.T) {
+	srv := newYOURLSServer(t)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sum := md5.Sum([]byte(ts + "s3cret"))
+
+	cases := []struct {
+		name   string
+		params url.Values
+		want   int
+	}{
+		{"none", url.Values{}, http.StatusForbidden},
+		{"wrong key", url.Values{"signature": {"nope"}}, http.StatusForbidden},
+		{"timestamped", url.Values{"timestamp": {ts}, "signature": {hex.EncodeToString(sum[:])}}, http.StatusOK},
+		{"expired", url.Values{"timestamp": {"1000"}, "signature": {hex.EncodeToString(sum[:])}}, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.params.Set("action", "db-stats")
+			c.params.Set("format", "json")
+			if status, body := yourlsCall(t, srv, c.params); status != c.want {
+				t.Fatalf("got %d, want %d: %s", status, c.want, body)
+			}
+		})
+	}
+}